@@ -0,0 +1,152 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const application = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: application
+spec:
+  components:
+    - name: component1
+      type: webservice
+      properties:
+        image: nginx:1.20.0 # Image
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-test
+data:
+  cpu: "0.50"
+`
+
+const newSpec = `
+components:
+  - name: component1
+    type: webservice
+    properties:
+      image: nginx:1.21.0
+`
+
+// runCommand executes the command with the arguments received and returns its output
+func runCommand(stdin string, args ...string) (string, error) {
+	*cfg = config{Output: yamlOutput}
+	*paramsCfg = paramsConfig{}
+	*packCfg = packConfig{}
+	*renderCfg = renderConfig{}
+
+	var stdout bytes.Buffer
+	rootCmd.SetIn(strings.NewReader(stdin))
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&bytes.Buffer{})
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+	return stdout.String(), err
+}
+
+var _ = ginkgo.Describe("Command tests", func() {
+
+	var dir string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "commands")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(os.MkdirAll(filepath.Join(dir, "app"), 0755)).Should(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "app", "app.yaml"), []byte(application), 0644)).Should(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	ginkgo.It("Should be able to inspect an application from the standard input", func() {
+		output, err := runCommand(application, "inspect", "-", "-o", "json")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.ContainSubstring(`"name": "component1"`))
+		gomega.Expect(output).Should(gomega.ContainSubstring(`"kind": "ConfigMap"`))
+	})
+
+	ginkgo.It("Should be able to get and set the parameters", func() {
+		output, err := runCommand("", "params", "get", filepath.Join(dir, "app"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.ContainSubstring("# Image"))
+
+		output, err = runCommand(newSpec, "params", "set", filepath.Join(dir, "app"), "--app", "application", "--name", "changed", "--spec", "-")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.ContainSubstring("name: changed"))
+		gomega.Expect(output).Should(gomega.ContainSubstring("nginx:1.21.0"))
+
+		_, err = runCommand("", "params", "set", filepath.Join(dir, "app"), "--app", "not-found", "--name", "changed")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to get the parameters and their schema in JSON", func() {
+		output, err := runCommand(application, "params", "get", "-", "-o", "json")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.ContainSubstring(`"image": "nginx:1.20.0"`))
+
+		output, err = runCommand(application, "params", "schema", "-", "--app", "application", "-o", "json")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.ContainSubstring(`"$schema"`))
+	})
+
+	ginkgo.It("Should be able to pack, unpack and validate an application", func() {
+		tgz := filepath.Join(dir, "app.tgz")
+		_, err := runCommand("", "pack", filepath.Join(dir, "app"), "-f", tgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		output, err := runCommand("", "validate", tgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.ContainSubstring("valid application"))
+
+		_, err = runCommand("", "unpack", tgz, filepath.Join(dir, "unpacked"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(filepath.Join(dir, "unpacked", "app.yaml")).Should(gomega.BeAnExistingFile())
+	})
+
+	ginkgo.It("Should be able to show the differences between two applications", func() {
+		changed := strings.Replace(application, "nginx:1.20.0", "nginx:1.21.0", 1)
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "changed.yaml"), []byte(changed), 0644)).Should(gomega.Succeed())
+
+		output, err := runCommand("", "diff", filepath.Join(dir, "app", "app.yaml"), filepath.Join(dir, "changed.yaml"))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.ContainSubstring("--- Application/application"))
+		gomega.Expect(output).Should(gomega.ContainSubstring("-        image: nginx:1.20.0"))
+		gomega.Expect(output).Should(gomega.ContainSubstring("+        image: nginx:1.21.0"))
+
+		output, err = runCommand("", "diff", filepath.Join(dir, "app", "app.yaml"), filepath.Join(dir, "app"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("Should fail with an invalid output format", func() {
+		_, err := runCommand(application, "inspect", "-", "-o", "xml")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
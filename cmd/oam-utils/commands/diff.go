@@ -0,0 +1,161 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	oam "github.com/napptive/oam-utils/pkg/oam-utils"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff SOURCE1 SOURCE2",
+	Short: "Show the differences between two catalog applications",
+	Long: `Show the differences between the applications and the entities of two catalog applications.
+
+The resources are compared after normalizing their YAML representation. The command fails if there are differences.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if args[0] == stdinSource && args[1] == stdinSource {
+			return fmt.Errorf("only one application can be read from the standard input")
+		}
+		first, err := loadApplication(args[0], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		second, err := loadApplication(args[1], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		firstResources, err := getNormalizedResources(first)
+		if err != nil {
+			return err
+		}
+		secondResources, err := getNormalizedResources(second)
+		if err != nil {
+			return err
+		}
+
+		diff := diffResources(firstResources, secondResources)
+		if diff == "" {
+			return nil
+		}
+		if _, err := fmt.Fprint(cmd.OutOrStdout(), diff); err != nil {
+			return err
+		}
+		return fmt.Errorf("the applications are different")
+	},
+}
+
+// getNormalizedResources returns the YAML of the applications and the entities indexed by kind and name
+func getNormalizedResources(app *oam.Application) (map[string]string, error) {
+	apps, entities, err := app.ToYAML()
+	if err != nil {
+		return nil, err
+	}
+	resources := make(map[string]string, 0)
+	for _, resource := range append(apps, entities...) {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(resource, &obj.Object); err != nil {
+			return nil, err
+		}
+		data, err := marshalYAML(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		resources[fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())] = string(data)
+	}
+	return resources, nil
+}
+
+// diffResources returns the differences between two sets of resources
+func diffResources(first map[string]string, second map[string]string) string {
+	keys := make([]string, 0)
+	for key := range first {
+		keys = append(keys, key)
+	}
+	for key := range second {
+		if _, exists := first[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, key := range keys {
+		if first[key] == second[key] {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", key, key))
+		builder.WriteString(diffLines(splitLines(first[key]), splitLines(second[key])))
+	}
+	return builder.String()
+}
+
+// splitLines returns the lines of a text
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the differences between two lists of lines using the longest common subsequence
+func diffLines(first []string, second []string) string {
+	lcs := make([][]int, len(first)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(second)+1)
+	}
+	for i := len(first) - 1; i >= 0; i-- {
+		for j := len(second) - 1; j >= 0; j-- {
+			if first[i] == second[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var builder strings.Builder
+	i, j := 0, 0
+	for i < len(first) || j < len(second) {
+		switch {
+		case i < len(first) && j < len(second) && first[i] == second[j]:
+			builder.WriteString(fmt.Sprintf(" %s\n", first[i]))
+			i++
+			j++
+		case i < len(first) && (j == len(second) || lcs[i+1][j] >= lcs[i][j+1]):
+			builder.WriteString(fmt.Sprintf("-%s\n", first[i]))
+			i++
+		default:
+			builder.WriteString(fmt.Sprintf("+%s\n", second[j]))
+			j++
+		}
+	}
+	return builder.String()
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
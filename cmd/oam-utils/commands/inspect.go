@@ -0,0 +1,114 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// inspectResult with the summary of a catalog application
+type inspectResult struct {
+	// Applications with the OAM applications
+	Applications []inspectApplication `json:"applications"`
+	// Entities with the bundled entities
+	Entities []inspectEntity `json:"entities"`
+}
+
+// inspectApplication with the summary of an OAM application
+type inspectApplication struct {
+	// Name of the application
+	Name string `json:"name"`
+	// Components of the application
+	Components []inspectComponent `json:"components"`
+}
+
+// inspectComponent with the summary of a component
+type inspectComponent struct {
+	// Name of the component
+	Name string `json:"name"`
+	// Type of the component
+	Type string `json:"type"`
+	// Traits with the types of the traits
+	Traits []string `json:"traits,omitempty"`
+}
+
+// inspectEntity with the summary of an entity
+type inspectEntity struct {
+	// APIVersion of the entity
+	APIVersion string `json:"apiVersion"`
+	// Kind of the entity
+	Kind string `json:"kind"`
+	// Name of the entity
+	Name string `json:"name"`
+}
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect SOURCE",
+	Short: "Show the applications, components and entities of a catalog application",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app, err := loadApplication(args[0], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		result := inspectResult{
+			Applications: make([]inspectApplication, 0),
+			Entities:     make([]inspectEntity, 0),
+		}
+		names := app.GetNames()
+		for _, appName := range getApplicationNames(app) {
+			components, err := app.GetComponents(appName)
+			if err != nil {
+				return err
+			}
+			summary := inspectApplication{Name: names[appName], Components: make([]inspectComponent, 0)}
+			for _, component := range components {
+				traits := make([]string, 0)
+				for _, trait := range component.Traits {
+					traits = append(traits, trait.Type)
+				}
+				summary.Components = append(summary.Components, inspectComponent{Name: component.Name, Type: component.Type, Traits: traits})
+			}
+			result.Applications = append(result.Applications, summary)
+		}
+
+		_, entities, err := app.ToYAML()
+		if err != nil {
+			return err
+		}
+		for _, entity := range entities {
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal(entity, &obj.Object); err != nil {
+				return err
+			}
+			result.Entities = append(result.Entities, inspectEntity{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Name: obj.GetName()})
+		}
+
+		data, err := marshal(result)
+		if err != nil {
+			return err
+		}
+		return writeOutput("", data, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+}
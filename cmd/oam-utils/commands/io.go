@@ -0,0 +1,142 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	oam "github.com/napptive/oam-utils/pkg/oam-utils"
+	yamlV3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// stdinSource with the source name used to read from the standard input
+const stdinSource = "-"
+
+// readSource returns the content of a file or the standard input
+func readSource(source string, stdin io.Reader) ([]byte, error) {
+	if source == stdinSource {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(source)
+}
+
+// loadApplication loads an application from a directory, an archive (tgz, tar, zip or zstd), a YAML or JSON
+// file or the standard input
+func loadApplication(source string, stdin io.Reader) (*oam.Application, error) {
+	if source != stdinSource {
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return oam.NewApplicationFromDirectory(source)
+		}
+	}
+	content, err := readSource(source, stdin)
+	if err != nil {
+		return nil, err
+	}
+	return oam.NewApplicationFromArchive(bytes.NewReader(content))
+}
+
+// writeOutput writes the data in a file or in the standard output if the file is empty or -
+func writeOutput(file string, data []byte, stdout io.Writer) error {
+	if file == "" || file == stdinSource {
+		_, err := stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// marshal converts a value into the output format
+func marshal(value interface{}) ([]byte, error) {
+	raw, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Output == jsonOutput {
+		return append(raw, '\n'), nil
+	}
+	var generic interface{}
+	if err := yamlV3.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return marshalYAML(generic)
+}
+
+// marshalYAML converts a value into YAML with two spaces indentation
+func marshalYAML(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yamlV3.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalDocuments converts a list of resources (as YAML or JSON) into a multi document YAML or a JSON list
+func marshalDocuments(documents [][]byte) ([]byte, error) {
+	resources := make([]interface{}, 0, len(documents))
+	for _, document := range documents {
+		var resource interface{}
+		if err := yaml.Unmarshal(document, &resource); err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	if cfg.Output == jsonOutput {
+		return marshal(resources)
+	}
+	var buf bytes.Buffer
+	for _, resource := range resources {
+		data, err := marshalYAML(resource)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("---\n")
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// getApplicationNames returns the sorted names of the applications (as they were loaded)
+func getApplicationNames(app *oam.Application) []string {
+	names := make([]string, 0)
+	for name := range app.GetNames() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkApplicationName returns an error if the application does not contain an application with that name
+func checkApplicationName(app *oam.Application, name string) error {
+	if _, exists := app.GetNames()[name]; !exists {
+		return fmt.Errorf("application %s not found", name)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+
+	oam "github.com/napptive/oam-utils/pkg/oam-utils"
+	"github.com/spf13/cobra"
+)
+
+// packConfig with the options of the pack command
+type packConfig struct {
+	// File with the output file
+	File string
+}
+
+var packCfg = &packConfig{}
+
+var packCmd = &cobra.Command{
+	Use:   "pack DIRECTORY",
+	Short: "Package the files of a catalog application in a tgz file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := oam.PackDirectory(args[0])
+		if err != nil {
+			return err
+		}
+		return writeOutput(packCfg.File, data, cmd.OutOrStdout())
+	},
+}
+
+var unpackCmd = &cobra.Command{
+	Use:   "unpack SOURCE DIRECTORY",
+	Short: "Extract the files of a packaged catalog application",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := readSource(args[0], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		if err := oam.UnpackTGZ(data, args[1]); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "application extracted in %s\n", args[1])
+		return err
+	},
+}
+
+func init() {
+	packCmd.Flags().StringVarP(&packCfg.File, "file", "f", "", "Output file (standard output by default)")
+
+	rootCmd.AddCommand(packCmd, unpackCmd)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// paramsConfig with the options of the params commands
+type paramsConfig struct {
+	// Application with the name of the application
+	Application string
+	// Name with the new name of the application
+	Name string
+	// Spec with the file that contains the new components spec
+	Spec string
+	// File with the output file
+	File string
+}
+
+var paramsCfg = &paramsConfig{}
+
+var paramsCmd = &cobra.Command{
+	Use:   "params",
+	Short: "Get and set the parameters (components spec) of the applications",
+}
+
+var paramsGetCmd = &cobra.Command{
+	Use:   "get SOURCE",
+	Short: "Show the components spec (with comments) of the applications",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app, err := loadApplication(args[0], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		if paramsCfg.Application != "" {
+			if err := checkApplicationName(app, paramsCfg.Application); err != nil {
+				return err
+			}
+		}
+
+		if cfg.Output == jsonOutput {
+			parameters, err := app.GetParametersJSON()
+			if err != nil {
+				return err
+			}
+			documents := make(map[string]json.RawMessage, 0)
+			for appName, document := range parameters {
+				if paramsCfg.Application == "" || paramsCfg.Application == appName {
+					documents[appName] = json.RawMessage(document)
+				}
+			}
+			data, err := marshal(documents)
+			if err != nil {
+				return err
+			}
+			return writeOutput("", data, cmd.OutOrStdout())
+		}
+		parameters, err := app.GetParameters()
+		if err != nil {
+			return err
+		}
+		var builder strings.Builder
+		for _, appName := range getApplicationNames(app) {
+			spec, exists := parameters[appName]
+			if !exists || (paramsCfg.Application != "" && paramsCfg.Application != appName) {
+				continue
+			}
+			builder.WriteString(fmt.Sprintf("# application: %s\n%s", appName, spec))
+			if paramsCfg.Application == "" {
+				builder.WriteString("---\n")
+			}
+		}
+		return writeOutput("", []byte(builder.String()), cmd.OutOrStdout())
+	},
+}
+
+var paramsSchemaCmd = &cobra.Command{
+	Use:   "schema SOURCE",
+	Short: "Show the JSON Schema of the parameters of the applications",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app, err := loadApplication(args[0], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		schemas, err := app.GetParametersSchema()
+		if err != nil {
+			return err
+		}
+		var result interface{} = schemas
+		if paramsCfg.Application != "" {
+			if err := checkApplicationName(app, paramsCfg.Application); err != nil {
+				return err
+			}
+			result = schemas[paramsCfg.Application]
+		}
+		data, err := marshal(result)
+		if err != nil {
+			return err
+		}
+		return writeOutput("", data, cmd.OutOrStdout())
+	},
+}
+
+var paramsSetCmd = &cobra.Command{
+	Use:   "set SOURCE",
+	Short: "Set the name and the components spec of an application",
+	Long: `Set the name and the components spec of an application.
+
+The result is written as YAML/JSON documents or, if the output file ends with .tgz, as a packaged application.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if paramsCfg.Application == "" {
+			return fmt.Errorf("the application name is required")
+		}
+		if paramsCfg.Spec == stdinSource && args[0] == stdinSource {
+			return fmt.Errorf("the application and the spec cannot be read from the standard input at the same time")
+		}
+		app, err := loadApplication(args[0], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		spec := ""
+		if paramsCfg.Spec != "" {
+			content, err := readSource(paramsCfg.Spec, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			spec = string(content)
+		}
+		if err := app.ApplyParameters(paramsCfg.Application, paramsCfg.Name, spec); err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(paramsCfg.File, ".tgz") {
+			data, err := app.ToTGZ()
+			if err != nil {
+				return err
+			}
+			return writeOutput(paramsCfg.File, data, cmd.OutOrStdout())
+		}
+		apps, entities, err := app.ToYAML()
+		if err != nil {
+			return err
+		}
+		data, err := marshalDocuments(append(apps, entities...))
+		if err != nil {
+			return err
+		}
+		return writeOutput(paramsCfg.File, data, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	paramsGetCmd.Flags().StringVar(&paramsCfg.Application, "app", "", "Name of the application")
+	paramsSchemaCmd.Flags().StringVar(&paramsCfg.Application, "app", "", "Name of the application")
+
+	paramsSetCmd.Flags().StringVar(&paramsCfg.Application, "app", "", "Name of the application")
+	paramsSetCmd.Flags().StringVar(&paramsCfg.Name, "name", "", "New name of the application")
+	paramsSetCmd.Flags().StringVar(&paramsCfg.Spec, "spec", "", "File with the new components spec (- to read it from the standard input)")
+	paramsSetCmd.Flags().StringVarP(&paramsCfg.File, "file", "f", "", "Output file (.tgz to package the application)")
+
+	paramsCmd.AddCommand(paramsGetCmd, paramsSchemaCmd, paramsSetCmd)
+	rootCmd.AddCommand(paramsCmd)
+}
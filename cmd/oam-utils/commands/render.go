@@ -0,0 +1,102 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"sort"
+
+	oam "github.com/napptive/oam-utils/pkg/oam-utils"
+	"github.com/spf13/cobra"
+)
+
+// renderConfig with the options of the render command
+type renderConfig struct {
+	// Application with the name of the application
+	Application string
+}
+
+var renderCfg = &renderConfig{}
+
+var renderCmd = &cobra.Command{
+	Use:   "render SOURCE",
+	Short: "Show the resources generated by the components using the bundled definitions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app, err := loadApplication(args[0], cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		appNames := getApplicationNames(app)
+		if renderCfg.Application != "" {
+			if err := checkApplicationName(app, renderCfg.Application); err != nil {
+				return err
+			}
+			appNames = []string{renderCfg.Application}
+		}
+
+		documents := make([][]byte, 0)
+		for _, appName := range appNames {
+			components, err := app.RenderApplication(appName)
+			if err != nil {
+				return err
+			}
+			for _, component := range components {
+				rendered, err := getRenderedDocuments(component)
+				if err != nil {
+					return err
+				}
+				documents = append(documents, rendered...)
+			}
+		}
+		data, err := marshalDocuments(documents)
+		if err != nil {
+			return err
+		}
+		return writeOutput("", data, cmd.OutOrStdout())
+	},
+}
+
+// getRenderedDocuments returns the output and the outputs (sorted by name) of a rendered component as JSON documents
+func getRenderedDocuments(component *oam.RenderedComponent) ([][]byte, error) {
+	documents := make([][]byte, 0)
+	if component.Output != nil {
+		data, err := component.Output.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, data)
+	}
+	names := make([]string, 0, len(component.Outputs))
+	for name := range component.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := component.Outputs[name].MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, data)
+	}
+	return documents, nil
+}
+
+func init() {
+	renderCmd.Flags().StringVar(&renderCfg.Application, "app", "", "Name of the application")
+
+	rootCmd.AddCommand(renderCmd)
+}
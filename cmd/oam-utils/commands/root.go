@@ -0,0 +1,78 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// yamlOutput with the YAML output format
+	yamlOutput = "yaml"
+	// jsonOutput with the JSON output format
+	jsonOutput = "json"
+)
+
+// config with the global options of the command
+type config struct {
+	// Debug enables the debug logs
+	Debug bool
+	// Output with the output format (yaml or json)
+	Output string
+}
+
+var cfg = &config{}
+
+var rootCmdLongHelp = `oam-utils manages catalog applications: OAM applications packaged with the entities they require.
+
+The SOURCE of an application can be a YAML file, a directory, a tgz file or - to read it from the standard input.`
+
+var rootCmd = &cobra.Command{
+	Use:          "oam-utils",
+	Short:        "Command line tool to manage catalog applications",
+	Long:         rootCmdLongHelp,
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		if cfg.Debug {
+			zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		}
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		if cfg.Output != yamlOutput && cfg.Output != jsonOutput {
+			return fmt.Errorf("invalid output format %s, valid formats are %s and %s", cfg.Output, yamlOutput, jsonOutput)
+		}
+		return nil
+	},
+}
+
+// Execute runs the command
+func Execute(version string, commit string) {
+	rootCmd.Version = fmt.Sprintf("%s (%s)", version, commit)
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&cfg.Debug, "debug", false, "Enable the debug logs")
+	rootCmd.PersistentFlags().StringVarP(&cfg.Output, "output", "o", yamlOutput, "Output format (yaml or json)")
+}
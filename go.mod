@@ -3,10 +3,13 @@ module github.com/napptive/oam-utils
 go 1.16
 
 require (
+	cuelang.org/go v0.4.3
+	github.com/klauspost/compress v1.15.9
 	github.com/napptive/nerrors v1.1.0
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.19.0
 	github.com/rs/zerolog v1.28.0
+	github.com/spf13/cobra v1.5.0
 	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/apimachinery v0.25.0
 )
@@ -0,0 +1,388 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog"
+	yamlV3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// parameterAnnotation with the prefix of the comments that describe a parameter. The annotation is followed by
+// a list of options separated by spaces:
+//
+//	# @param description="Image of the container" required enum=nginx:1.20.0,nginx:1.21.0 min=1 max=10
+//
+// Comments without the annotation are used as the description of the parameter.
+const parameterAnnotation = "@param"
+
+// ParameterMetadata with the metadata of a parameter of a component obtained from the comments of the components spec
+type ParameterMetadata struct {
+	// Component with the name of the component
+	Component string `json:"component"`
+	// Path of the parameter in the component (e.g. properties.ports[0].port)
+	Path string `json:"path"`
+	// Description of the parameter
+	Description string `json:"description,omitempty"`
+	// Required is true if the parameter cannot be empty
+	Required bool `json:"required,omitempty"`
+	// Enum with the allowed values
+	Enum []string `json:"enum,omitempty"`
+	// Min with the minimum value of a numeric parameter
+	Min *float64 `json:"min,omitempty"`
+	// Max with the maximum value of a numeric parameter
+	Max *float64 `json:"max,omitempty"`
+}
+
+// GetParametersMetadata returns the metadata of the parameters indexed by application name
+func (a *Application) GetParametersMetadata() map[string][]*ParameterMetadata {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	metadata := make(map[string][]*ParameterMetadata, 0)
+	for appName, parameters := range a.parametersMetadata {
+		metadata[appName] = append([]*ParameterMetadata{}, parameters...)
+	}
+	return metadata
+}
+
+// getParametersMetadata returns the metadata of the parameters found in the comments of the components spec
+func getParametersMetadata(node *ComponentsNode, logger *zerolog.Logger) []*ParameterMetadata {
+	metadata := make([]*ParameterMetadata, 0)
+	if node == nil {
+		return metadata
+	}
+	for _, component := range node.Spec.Components.Content {
+		if component.Kind != yamlV3.MappingNode {
+			continue
+		}
+		componentName := ""
+		for i := 0; i+1 < len(component.Content); i += 2 {
+			if component.Content[i].Value == "name" {
+				componentName = component.Content[i+1].Value
+			}
+		}
+		metadata = append(metadata, collectParametersMetadata(component, componentName, "", logger)...)
+	}
+	return metadata
+}
+
+// collectParametersMetadata returns the metadata of the fields of a YAML node
+func collectParametersMetadata(node *yamlV3.Node, componentName string, path string, logger *zerolog.Logger) []*ParameterMetadata {
+	metadata := make([]*ParameterMetadata, 0)
+	switch node.Kind {
+	case yamlV3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldPath := joinPath(path, key.Value)
+			comments := []string{key.HeadComment, key.LineComment}
+			if value.Kind == yamlV3.ScalarNode {
+				comments = append(comments, value.LineComment)
+			}
+			if parameter := parseParameterComments(comments, logger); parameter != nil {
+				parameter.Component = componentName
+				parameter.Path = fieldPath
+				metadata = append(metadata, parameter)
+			}
+			metadata = append(metadata, collectParametersMetadata(value, componentName, fieldPath, logger)...)
+		}
+	case yamlV3.SequenceNode:
+		for i, child := range node.Content {
+			metadata = append(metadata, collectParametersMetadata(child, componentName, fmt.Sprintf("%s[%d]", path, i), logger)...)
+		}
+	}
+	return metadata
+}
+
+// parseParameterComments returns the metadata described by the comments of a field, or nil if there are no comments
+func parseParameterComments(comments []string, logger *zerolog.Logger) *ParameterMetadata {
+	var parameter *ParameterMetadata
+	descriptions := make([]string, 0)
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment, "\n") {
+			line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+			if line == "" {
+				continue
+			}
+			if parameter == nil {
+				parameter = &ParameterMetadata{}
+			}
+			if !strings.HasPrefix(line, parameterAnnotation) {
+				descriptions = append(descriptions, line)
+				continue
+			}
+			parseParameterOptions(strings.TrimPrefix(line, parameterAnnotation), parameter, logger)
+		}
+	}
+	if parameter != nil && parameter.Description == "" {
+		parameter.Description = strings.Join(descriptions, " ")
+	}
+	return parameter
+}
+
+// parseParameterOptions reads the options of a parameter annotation
+func parseParameterOptions(options string, parameter *ParameterMetadata, logger *zerolog.Logger) {
+	for _, option := range splitOptions(options) {
+		key, value := option, ""
+		if index := strings.Index(option, "="); index != -1 {
+			key, value = option[:index], strings.Trim(option[index+1:], `"`)
+		}
+		switch key {
+		case "description":
+			parameter.Description = value
+		case "required":
+			parameter.Required = true
+		case "enum":
+			parameter.Enum = strings.Split(value, ",")
+		case "min", "max":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				logger.Warn().Str("option", option).Msg("ignoring invalid parameter option")
+				continue
+			}
+			if key == "min" {
+				parameter.Min = &number
+			} else {
+				parameter.Max = &number
+			}
+		default:
+			logger.Warn().Str("option", option).Msg("ignoring unknown parameter option")
+		}
+	}
+}
+
+// splitOptions splits the options of an annotation by spaces, keeping the quoted values together
+func splitOptions(options string) []string {
+	result := make([]string, 0)
+	var current strings.Builder
+	quoted := false
+	for _, char := range options {
+		switch {
+		case char == '"':
+			quoted = !quoted
+			current.WriteRune(char)
+		case char == ' ' && !quoted:
+			if current.Len() > 0 {
+				result = append(result, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(char)
+		}
+	}
+	if current.Len() > 0 {
+		result = append(result, current.String())
+	}
+	return result
+}
+
+// validateComponentsParameters checks the components spec received in ApplyParameters against the metadata of the parameters
+func validateComponentsParameters(metadata []*ParameterMetadata, rawComponents *runtime.RawExtension) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	components := make([]interface{}, 0)
+	if rawComponents != nil && len(rawComponents.Raw) > 0 {
+		if err := json.Unmarshal(rawComponents.Raw, &components); err != nil {
+			return nerrors.NewInvalidArgumentError("invalid components: %s", err.Error())
+		}
+	}
+	return validateParameters(metadata, components)
+}
+
+// validateParameters checks the components received against the metadata of the parameters
+func validateParameters(metadata []*ParameterMetadata, components []interface{}) error {
+	problems := make([]string, 0)
+	for _, parameter := range metadata {
+		var component interface{}
+		for _, candidate := range components {
+			if candidateMap, ok := candidate.(map[string]interface{}); ok && candidateMap["name"] == parameter.Component {
+				component = candidate
+			}
+		}
+		value, found := lookupParameter(component, parameter.Path)
+		if !found || value == nil || value == "" {
+			if parameter.Required {
+				problems = append(problems, fmt.Sprintf("%s.%s is required", parameter.Component, parameter.Path))
+			}
+			continue
+		}
+		if len(parameter.Enum) > 0 {
+			allowed := false
+			for _, option := range parameter.Enum {
+				if matchesEnumOption(value, option) {
+					allowed = true
+				}
+			}
+			if !allowed {
+				problems = append(problems, fmt.Sprintf("%s.%s must be one of %s", parameter.Component, parameter.Path, strings.Join(parameter.Enum, ", ")))
+			}
+		}
+		if parameter.Min != nil || parameter.Max != nil {
+			number, isNumber := value.(float64)
+			switch {
+			case !isNumber:
+				problems = append(problems, fmt.Sprintf("%s.%s must be a number", parameter.Component, parameter.Path))
+			case parameter.Min != nil && number < *parameter.Min:
+				problems = append(problems, fmt.Sprintf("%s.%s must be greater than or equal to %v", parameter.Component, parameter.Path, *parameter.Min))
+			case parameter.Max != nil && number > *parameter.Max:
+				problems = append(problems, fmt.Sprintf("%s.%s must be less than or equal to %v", parameter.Component, parameter.Path, *parameter.Max))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nerrors.NewInvalidArgumentError("invalid parameters: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// matchesEnumOption returns true if a value is equal to an option of an enum converted to the type of the value
+func matchesEnumOption(value interface{}, option string) bool {
+	switch typed := value.(type) {
+	case string:
+		return typed == option
+	case float64:
+		number, err := strconv.ParseFloat(option, 64)
+		return err == nil && number == typed
+	case bool:
+		boolean, err := strconv.ParseBool(option)
+		return err == nil && boolean == typed
+	default:
+		return fmt.Sprint(value) == option
+	}
+}
+
+// convertEnumOption returns an option of an enum converted to the type of the schema (integer, number or boolean).
+// The options of other types or that cannot be converted are returned as strings.
+func convertEnumOption(option string, schemaType string) interface{} {
+	switch schemaType {
+	case "integer":
+		if integer, err := strconv.ParseInt(option, 10, 64); err == nil {
+			return integer
+		}
+	case "number":
+		if number, err := strconv.ParseFloat(option, 64); err == nil {
+			return number
+		}
+	case "boolean":
+		if boolean, err := strconv.ParseBool(option); err == nil {
+			return boolean
+		}
+	}
+	return option
+}
+
+// pathSegment with a field of a parameter path and the index if the field is a list element
+type pathSegment struct {
+	key   string
+	index int
+}
+
+// splitParameterPath splits a parameter path (e.g. properties.ports[0].port) in segments
+func splitParameterPath(path string) []pathSegment {
+	segments := make([]pathSegment, 0)
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		indexes := make([]int, 0)
+		for strings.HasSuffix(key, "]") {
+			start := strings.LastIndex(key, "[")
+			if start == -1 {
+				break
+			}
+			index, err := strconv.Atoi(key[start+1 : len(key)-1])
+			if err != nil {
+				break
+			}
+			indexes = append([]int{index}, indexes...)
+			key = key[:start]
+		}
+		segments = append(segments, pathSegment{key: key, index: -1})
+		for _, index := range indexes {
+			segments = append(segments, pathSegment{index: index})
+		}
+	}
+	return segments
+}
+
+// lookupParameter returns the value of a parameter path
+func lookupParameter(value interface{}, path string) (interface{}, bool) {
+	current := value
+	for _, segment := range splitParameterPath(path) {
+		if segment.index == -1 {
+			currentMap, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if current, ok = currentMap[segment.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		currentList, ok := current.([]interface{})
+		if !ok || segment.index >= len(currentList) {
+			return nil, false
+		}
+		current = currentList[segment.index]
+	}
+	return current, true
+}
+
+// applyParametersMetadata adds the metadata of the parameters to the schema of a component
+func applyParametersMetadata(schema *JSONSchema, parameter *ParameterMetadata) {
+	segments := splitParameterPath(parameter.Path)
+	parent, current := schema, schema
+	lastKey := ""
+	for _, segment := range segments {
+		parent = current
+		if segment.index == -1 {
+			next, exists := current.Properties[segment.key]
+			if !exists {
+				return
+			}
+			current, lastKey = next, segment.key
+			continue
+		}
+		if segment.index >= len(current.PrefixItems) {
+			return
+		}
+		current, lastKey = current.PrefixItems[segment.index], ""
+	}
+	if parameter.Description != "" {
+		current.Description = parameter.Description
+	}
+	if len(parameter.Enum) > 0 {
+		current.Enum = make([]interface{}, 0, len(parameter.Enum))
+		for _, option := range parameter.Enum {
+			current.Enum = append(current.Enum, convertEnumOption(option, current.Type))
+		}
+	}
+	current.Minimum = parameter.Min
+	current.Maximum = parameter.Max
+	if parameter.Required && lastKey != "" {
+		for _, required := range parent.Required {
+			if required == lastKey {
+				return
+			}
+		}
+		parent.Required = append(parent.Required, lastKey)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const annotatedApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: annotated
+spec:
+  components:
+    - name: web
+      type: webservice
+      properties:
+        # @param description="Image of the container" required enum=nginx:1.20.0,nginx:1.21.0
+        image: nginx:1.20.0
+        ports:
+        - port: 80 # @param min=1 max=65535
+          expose: true
+      traits:
+      - type: scaler
+        properties:
+          # Number of replicas
+          replicas: 1 # @param min=1 max=10
+`
+
+const typedEnumApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: typed
+spec:
+  components:
+    - name: web
+      type: webservice
+      properties:
+        image: nginx:1.20.0
+        debug: false # @param enum=true,false
+        ratio: 0.5 # @param enum=0.5,1.5
+      traits:
+      - type: scaler
+        properties:
+          replicas: 1 # @param enum=1,2,3
+`
+
+var _ = ginkgo.Describe("Annotations tests", func() {
+
+	ginkgo.It("Should be able to read the parameter annotations", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(annotatedApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		metadata := app.GetParametersMetadata()
+		gomega.Expect(metadata).Should(gomega.HaveKey("annotated"))
+		parameters := make(map[string]*ParameterMetadata, 0)
+		for _, parameter := range metadata["annotated"] {
+			gomega.Expect(parameter.Component).Should(gomega.Equal("web"))
+			parameters[parameter.Path] = parameter
+		}
+		gomega.Expect(parameters).Should(gomega.HaveLen(3))
+
+		image := parameters["properties.image"]
+		gomega.Expect(image).ShouldNot(gomega.BeNil())
+		gomega.Expect(image.Description).Should(gomega.Equal("Image of the container"))
+		gomega.Expect(image.Required).Should(gomega.BeTrue())
+		gomega.Expect(image.Enum).Should(gomega.Equal([]string{"nginx:1.20.0", "nginx:1.21.0"}))
+
+		port := parameters["properties.ports[0].port"]
+		gomega.Expect(port).ShouldNot(gomega.BeNil())
+		gomega.Expect(*port.Min).Should(gomega.Equal(1.0))
+		gomega.Expect(*port.Max).Should(gomega.Equal(65535.0))
+
+		replicas := parameters["traits[0].properties.replicas"]
+		gomega.Expect(replicas).ShouldNot(gomega.BeNil())
+		gomega.Expect(replicas.Description).Should(gomega.Equal("Number of replicas"))
+		gomega.Expect(*replicas.Max).Should(gomega.Equal(10.0))
+	})
+
+	ginkgo.It("Should use plain comments as descriptions", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		metadata := app.GetParametersMetadata()["application"]
+		descriptions := make(map[string]string, 0)
+		for _, parameter := range metadata {
+			descriptions[parameter.Path] = parameter.Description
+			gomega.Expect(parameter.Required).Should(gomega.BeFalse())
+		}
+		gomega.Expect(descriptions).Should(gomega.HaveKeyWithValue("properties.image", "Image"))
+		gomega.Expect(descriptions).Should(gomega.HaveKeyWithValue("properties.ports[0].port", "Port"))
+	})
+
+	ginkgo.It("Should validate the parameters against the annotations", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(annotatedApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		valid := `
+components:
+  - name: web
+    type: webservice
+    properties:
+      image: nginx:1.21.0
+      ports:
+      - port: 8080
+    traits:
+    - type: scaler
+      properties:
+        replicas: 3
+`
+		gomega.Expect(app.ApplyParameters("annotated", "", valid)).Should(gomega.Succeed())
+
+		invalid := `
+components:
+  - name: web
+    type: webservice
+    properties:
+      image: httpd
+      ports:
+      - port: 0
+    traits:
+    - type: scaler
+      properties:
+        replicas: 3
+`
+		err = app.ApplyParameters("annotated", "renamed", invalid)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("web.properties.image must be one of"))
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("web.properties.ports[0].port must be greater than or equal to 1"))
+
+		missing := `
+components:
+  - name: web
+    type: webservice
+    properties:
+      ports:
+      - port: 80
+`
+		err = app.ApplyParameters("annotated", "", missing)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("web.properties.image is required"))
+
+		// the invalid parameters are not applied
+		gomega.Expect(app.GetNames()["annotated"]).Should(gomega.Equal("annotated"))
+		components, err := app.GetComponents("annotated")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components[0].Properties["image"]).Should(gomega.Equal("nginx:1.21.0"))
+	})
+
+	ginkgo.It("Should add the annotations to the parameters schema", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(annotatedApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		schemas, err := app.GetParametersSchema()
+		gomega.Expect(err).Should(gomega.Succeed())
+		component := schemas["annotated"].Properties["components"].PrefixItems[0]
+		properties := component.Properties["properties"]
+		gomega.Expect(properties.Required).Should(gomega.ContainElement("image"))
+		gomega.Expect(properties.Properties["image"].Description).Should(gomega.Equal("Image of the container"))
+		gomega.Expect(properties.Properties["image"].Enum).Should(gomega.HaveLen(2))
+		port := properties.Properties["ports"].PrefixItems[0].Properties["port"]
+		gomega.Expect(*port.Minimum).Should(gomega.Equal(1.0))
+		gomega.Expect(*port.Maximum).Should(gomega.Equal(65535.0))
+	})
+
+	ginkgo.It("Should keep the annotations after applying parameters and reloading the application", func() {
+		newSpec := strings.Replace(annotatedApplication[strings.Index(annotatedApplication, "  components:"):], "nginx:1.20.0\n", "nginx:1.21.0\n", 1)
+		// the spec received without comments keeps the annotations of the application
+		plainSpec := `
+components:
+  - name: web
+    type: webservice
+    properties:
+      image: nginx:1.21.0
+      ports:
+      - port: 8080
+        expose: true
+    traits:
+    - type: scaler
+      properties:
+        replicas: 2
+`
+		for _, parameters := range [][]string{{"renamed", ""}, {"", newSpec}, {"renamed", newSpec}, {"", plainSpec}} {
+			app, err := NewApplicationFromYAML([][]byte{[]byte(annotatedApplication)})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(app.ApplyParameters("annotated", parameters[0], parameters[1])).Should(gomega.Succeed())
+
+			raw, err := app.ToTGZ()
+			gomega.Expect(err).Should(gomega.Succeed())
+			loaded, err := NewApplicationFromTGZ(raw)
+			gomega.Expect(err).Should(gomega.Succeed())
+			schemas, err := loaded.GetParametersSchema()
+			gomega.Expect(err).Should(gomega.Succeed())
+			name := "annotated"
+			if parameters[0] != "" {
+				name = parameters[0]
+			}
+			gomega.Expect(schemas).Should(gomega.HaveKey(name))
+			properties := schemas[name].Properties["components"].PrefixItems[0].Properties["properties"]
+			gomega.Expect(properties.Required).Should(gomega.ContainElement("image"))
+			gomega.Expect(properties.Properties["image"].Description).Should(gomega.Equal("Image of the container"))
+			port := properties.Properties["ports"].PrefixItems[0].Properties["port"]
+			gomega.Expect(*port.Maximum).Should(gomega.Equal(65535.0))
+			gomega.Expect(loaded.GetParametersMetadata()[name]).Should(gomega.Equal(app.GetParametersMetadata()["annotated"]))
+		}
+	})
+
+	ginkgo.It("Should use the type of the parameters in the enum options", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(typedEnumApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		schemas, err := app.GetParametersSchema()
+		gomega.Expect(err).Should(gomega.Succeed())
+		component := schemas["typed"].Properties["components"].PrefixItems[0]
+		properties := component.Properties["properties"]
+		gomega.Expect(properties.Properties["debug"].Enum).Should(gomega.Equal([]interface{}{true, false}))
+		gomega.Expect(properties.Properties["ratio"].Enum).Should(gomega.Equal([]interface{}{0.5, 1.5}))
+		replicas := component.Properties["traits"].PrefixItems[0].Properties["properties"].Properties["replicas"]
+		gomega.Expect(replicas.Enum).Should(gomega.Equal([]interface{}{int64(1), int64(2), int64(3)}))
+
+		valid := `
+components:
+  - name: web
+    type: webservice
+    properties:
+      image: nginx:1.20.0
+      debug: true
+      ratio: 1.5
+    traits:
+    - type: scaler
+      properties:
+        replicas: 2
+`
+		gomega.Expect(app.ApplyParameters("typed", "", valid)).Should(gomega.Succeed())
+
+		invalid := `
+components:
+  - name: web
+    type: webservice
+    properties:
+      image: nginx:1.20.0
+      debug: "yes"
+      ratio: 1.5
+    traits:
+    - type: scaler
+      properties:
+        replicas: 4
+`
+		err = app.ApplyParameters("typed", "", invalid)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("web.properties.debug must be one of"))
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("web.traits[0].properties.replicas must be one of"))
+	})
+})
@@ -14,20 +14,24 @@
 package oam_utils
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
-	"io"
-	"path/filepath"
+	"context"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/napptive/nerrors/pkg/nerrors"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
+	yamlV3 "gopkg.in/yaml.v3"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
-// Application with a catalog application
+// Application with a catalog application. The methods of an application can be called concurrently; the
+// content shared with its clones (see Clone) is replaced, not modified, when the application changes.
 type Application struct {
+	// mutex protecting the fields of the application
+	mutex sync.RWMutex
 	// App with a map of OAM applications indexed by application the name
 	apps map[string]*ApplicationDefinition
 	// obj with map of the OAM applications stored as unstructured indexed by the name
@@ -37,6 +41,12 @@ type Application struct {
 	entities [][]byte
 	// componentsYAML with the components YAML spec (with comments) indexed by applicationName
 	componentsYAML map[string]*ComponentsNode
+	// metadata with the ApplicationMetadata entity as it was loaded (nil if the application does not have metadata)
+	metadata []byte
+	// parametersMetadata with the metadata of the parameters (read from the original comments) indexed by applicationName
+	parametersMetadata map[string][]*ParameterMetadata
+	// logger used by the methods of the application (nil to use the global logger)
+	logger *zerolog.Logger
 }
 
 type InstanceConf struct {
@@ -47,47 +57,18 @@ type InstanceConf struct {
 }
 
 // NewApplicationFromTGZ receives a tgz file and returns convert the content into an application
-func NewApplicationFromTGZ(rawApplication []byte) (*Application, error) {
-	files := make([]*ApplicationFile, 0)
-
-	br := bytes.NewReader(rawApplication)
-	uncompressedStream, err := gzip.NewReader(br)
-	if err != nil {
-		log.Error().Err(err).Msg("error creating application from tgz")
-		return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
-	}
-	tarReader := tar.NewReader(uncompressedStream)
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Error().Err(err).Msg("error creating application from tgz")
-			return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
-		}
+func NewApplicationFromTGZ(rawApplication []byte, opts ...LoadOption) (*Application, error) {
+	return NewApplicationFromTGZContext(context.Background(), rawApplication, opts...)
+}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			log.Debug().Str("name", header.Name).Msg("is a directory")
-		case tar.TypeReg:
-			data, err := io.ReadAll(tarReader)
-			if err != nil {
-				return nil, nerrors.NewInternalErrorFrom(err, "error creating application, error reading %s file", header.Name)
-			}
-			files = append(files, &ApplicationFile{
-				FileName: header.Name,
-				Content:  data,
-			})
-		default:
-			log.Warn().Str("type", string(header.Typeflag)).Msg("ignoring compressed type")
-		}
-	}
-	return NewApplication(files)
+// NewApplicationFromTGZContext is NewApplicationFromTGZ with a context. The files are not read after the context
+// is done and the Canceled or DeadlineExceeded error is returned.
+func NewApplicationFromTGZContext(ctx context.Context, rawApplication []byte, opts ...LoadOption) (*Application, error) {
+	return NewApplicationFromTGZReaderContext(ctx, bytes.NewReader(rawApplication), 1, opts...)
 }
 
 // NewApplicationFromYAML receives an array of YAML files and return an application
-func NewApplicationFromYAML(files [][]byte) (*Application, error) {
+func NewApplicationFromYAML(files [][]byte, opts ...LoadOption) (*Application, error) {
 
 	var appFiles []*ApplicationFile
 	for _, file := range files {
@@ -96,82 +77,77 @@ func NewApplicationFromYAML(files [][]byte) (*Application, error) {
 			Content:  file,
 		})
 	}
-	return NewApplication(appFiles)
+	return NewApplication(appFiles, opts...)
 }
 
-// NewApplication converts an oam application from an array of yaml files into an Application
-func NewApplication(files []*ApplicationFile) (*Application, error) {
-
-	apps := make(map[string]*ApplicationDefinition, 0)
-	nodes := make(map[string]*ComponentsNode, 0)
-	var entities [][]byte
-
-	for _, file := range files {
-
-		// check if the file is a yaml File
-		if !isYAMLFile(file.FileName) {
-			log.Info().Str("file", file.FileName).Msg("skipping the file")
-			continue
-		}
+// NewApplicationFromDirectory receives a directory with the files of a catalog application and returns the application
+func NewApplicationFromDirectory(directory string, opts ...LoadOption) (*Application, error) {
+	files, err := readDirectoryFiles(directory)
+	if err != nil {
+		return nil, err
+	}
+	return NewApplication(files, opts...)
+}
 
-		resources, err := splitYAMLFile([]byte(file.Content))
-		if err != nil {
-			log.Error().Err(err).Str("File", file.FileName).Msg("error split application file")
-			return nil, nerrors.NewInternalErrorFrom(err, "cannot create application, error in file: %s", file.FileName)
-		}
+// NewApplication converts an oam application from an array of yaml files into an Application
+func NewApplication(files []*ApplicationFile, opts ...LoadOption) (*Application, error) {
+	return NewApplicationContext(context.Background(), files, opts...)
+}
 
-		for _, entity := range resources {
-
-			gvk, app, err := getGVK(entity)
-			if err != nil {
-				log.Error().Err(err).Str("File", file.FileName).Msg("yaml file without GVK")
-				return nil, nerrors.NewInternalError("cannot create application, error in file: %s - %s", filepath.Base(file.FileName), err.Error())
-			}
-			switch getGVKType(gvk) {
-			// Application
-			case EntityType_APP:
-				var appDefinition ApplicationDefinition
-				if err := convertFromUnstructured(app, &appDefinition); err != nil {
-					log.Error().Err(err).Str("File", file.FileName).Msg("error converting application")
-					return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
-				}
-				apps[appDefinition.Metadata.Name] = &appDefinition
-
-				node, err := getComponentsNodeFromYAML(entity)
-				if err != nil {
-					log.Error().Err(err).Str("File", file.FileName).Msg("error creating application")
-					return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
-				}
-				nodes[appDefinition.Metadata.Name] = node
-
-				// Metadata
-			case EntityType_METADATA:
-				log.Debug().Str("file", file.FileName).Msg("is metadata file")
-				// Others
-			default:
-				entities = append(entities, entity)
-			}
+// NewApplicationContext is NewApplication with a context. The context is checked before decoding each file and
+// document, and the Canceled or DeadlineExceeded error is returned when it is done.
+func NewApplicationContext(ctx context.Context, files []*ApplicationFile, opts ...LoadOption) (*Application, error) {
+	return loadApplication(ctx, sliceFileSource(files), 1, newLoadOptions(opts))
+}
 
-		}
+// Clone returns a copy of the application that can be customized (e.g. with ApplyParameters) without modifying
+// the original one. The copy shares the content with the original until one of them changes it, so cloning
+// a cached application is much cheaper than parsing it again.
+func (a *Application) Clone() *Application {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	apps := make(map[string]*ApplicationDefinition, len(a.apps))
+	for appName, app := range a.apps {
+		apps[appName] = app
+	}
+	nodes := make(map[string]*ComponentsNode, len(a.componentsYAML))
+	for appName, node := range a.componentsYAML {
+		nodes[appName] = node
 	}
-	// a catalog application might not contain oam application.
-	// For example, if a user wants to store their component definitions
-	if len(apps) == 0 {
-		log.Warn().Msg("Error creating application, no application received")
+	return &Application{
+		apps:               apps,
+		entities:           a.entities,
+		componentsYAML:     nodes,
+		metadata:           a.metadata,
+		parametersMetadata: a.parametersMetadata,
+		logger:             a.logger,
 	}
+}
 
-	log.Debug().Int("apps", len(apps)).Int("entities", len(entities)).Msg("Apps configuration")
+// GetMetadata returns the ApplicationMetadata entity of the catalog application
+func (a *Application) GetMetadata() (*ApplicationMetadata, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.getMetadata()
+}
 
-	return &Application{
-		apps:           apps,
-		entities:       entities,
-		componentsYAML: nodes,
-	}, nil
+// getMetadata is GetMetadata without locking the application
+func (a *Application) getMetadata() (*ApplicationMetadata, error) {
+	if a.metadata == nil {
+		return nil, nerrors.NewNotFoundError("the application does not have metadata")
+	}
+	var metadata ApplicationMetadata
+	if err := yaml.Unmarshal(a.metadata, &metadata); err != nil {
+		a.getLogger().Debug().Err(err).Msg("error reading metadata")
+		return nil, nerrors.NewInternalError("error reading the application metadata: %s", err.Error())
+	}
+	return &metadata, nil
 }
 
 // GetNames returns the application name
 func (a *Application) GetNames() map[string]string {
-
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
 	names := make(map[string]string, 0)
 	for name, application := range a.apps {
 		names[name] = application.Metadata.Name
@@ -179,15 +155,26 @@ func (a *Application) GetNames() map[string]string {
 	return names
 }
 
+// GetComponents returns the components of the application named `applicationName`
+func (a *Application) GetComponents(applicationName string) ([]Component, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	app, exists := a.apps[applicationName]
+	if !exists {
+		return nil, nerrors.NewNotFoundError("application %s not found", applicationName)
+	}
+	return app.getComponents()
+}
+
 // GetParameters returns the components spec of an application indexed by application name
 func (a *Application) GetParameters() (map[string]string, error) {
-
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
 	parameters := make(map[string]string, 0)
 	for appName, components := range a.componentsYAML {
 		appParameters, err := components.toYAML()
 		if err != nil {
-			log.Error().Err(err).Str("appName", appName).Msg("error converting to YAML")
-			return nil, nerrors.NewInternalError("error getting the parameters of %s application", appName)
+			return nil, nerrors.NewInternalErrorFrom(err, "error getting the parameters of %s application", appName)
 		}
 		parameters[appName] = appParameters
 	}
@@ -197,12 +184,13 @@ func (a *Application) GetParameters() (map[string]string, error) {
 
 // GetConfigurations return the name and the componentSpec by application
 func (a *Application) GetConfigurations() (map[string]*InstanceConf, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
 	configurations := make(map[string]*InstanceConf, 0)
 	for appName, components := range a.componentsYAML {
 		appParameters, err := components.toYAML()
 		if err != nil {
-			log.Error().Err(err).Str("appName", appName).Msg("error converting to YAML")
-			return nil, nerrors.NewInternalError("error getting the parameters of %s application", appName)
+			return nil, nerrors.NewInternalErrorFrom(err, "error getting the parameters of %s application", appName)
 		}
 		configurations[appName] = &InstanceConf{
 			Name:          appName,
@@ -214,51 +202,65 @@ func (a *Application) GetConfigurations() (map[string]*InstanceConf, error) {
 
 // ApplyParameters overwrite the application name and the components spec in application named `applicationName`
 func (a *Application) ApplyParameters(applicationName string, newName string, newAppSpec string) error {
-
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	if len(a.apps) == 0 {
 		return nerrors.NewNotFoundError("there is no applications to apply parameters")
 	}
 
 	// check if the application exists
-	app, exists := a.apps[applicationName]
+	original, exists := a.apps[applicationName]
 	if !exists {
 		return nerrors.NewNotFoundError("application %s not found", applicationName)
 	}
-	if newName != "" {
-		app.Metadata.Name = newName
-	}
+	app := original.copy()
 	if newAppSpec != "" {
 		spec, err := a.toApplicationSpec(newAppSpec)
 		if err != nil {
 			return nerrors.NewInternalError("Unable to apply parameters: %s", err.Error())
 		}
+		if err := validateComponentsParameters(a.parametersMetadata[applicationName], spec.Components); err != nil {
+			return err
+		}
 		app.Spec.Components = spec.Components
 	}
+	if newName != "" {
+		app.Metadata.Name = newName
+	}
+	a.apps[applicationName] = app
 
-	// update nodes
-	node, err := getComponentsFromYAML([]byte(newAppSpec))
+	// the components spec with comments keeps the comments (and the parameter annotations) of the fields that are
+	// still present, so the parameters metadata is the same after storing and loading the application
+	components, err := getRawComponents(app)
 	if err != nil {
-		return nerrors.NewInternalErrorFrom(err, "error creating application")
+		return err
 	}
-	if node != nil {
-		a.componentsYAML[applicationName] = &ComponentsNode{
-			Spec: *node,
-		}
+	var node *yamlV3.Node
+	if current, exists := a.componentsYAML[applicationName]; exists {
+		node = &current.Spec.Components
 	}
-
+	synced, err := syncYAMLNode(node, components)
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error applying parameters to %s application", applicationName)
+	}
+	a.componentsYAML[applicationName] = &ComponentsNode{Spec: ComponentsYAML{Components: *synced}}
 	return nil
 }
 
 // ToYAML converts the application in YAML
 func (a *Application) ToYAML() ([][]byte, [][]byte, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.toYAML()
+}
 
+// toYAML is ToYAML without locking the application
+func (a *Application) toYAML() ([][]byte, [][]byte, error) {
 	var appsFiles [][]byte
-	for _, app := range a.apps {
-		// Marshal this object into YAML.
-		returned, err := convertToYAML(app)
+	for appName := range a.apps {
+		returned, err := a.applicationToYAML(appName)
 		if err != nil {
-			log.Error().Err(err).Msg("error in Marshal ")
-			return nil, nil, nerrors.NewInternalError("error converting to YAML")
+			return nil, nil, err
 		}
 
 		appsFiles = append(appsFiles, returned)
@@ -267,6 +269,86 @@ func (a *Application) ToYAML() ([][]byte, [][]byte, error) {
 	return appsFiles, a.entities, nil
 }
 
+// ToTGZ packages the application in a tgz file with a YAML file for each OAM application
+// and a multi-document YAML file with the entities
+func (a *Application) ToTGZ() ([]byte, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.toTGZ()
+}
+
+// toTGZ is ToTGZ without locking the application
+func (a *Application) toTGZ() ([]byte, error) {
+	files, err := a.toFiles()
+	if err != nil {
+		return nil, err
+	}
+	return writeTGZ(files)
+}
+
+// toFiles returns a YAML file for each OAM application and a multi-document YAML file with the entities
+func (a *Application) toFiles() ([]*ApplicationFile, error) {
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	files := make([]*ApplicationFile, 0)
+	if a.metadata != nil {
+		files = append(files, &ApplicationFile{FileName: "metadata.yaml", Content: a.metadata})
+	}
+	for _, appName := range appNames {
+		returned, err := a.applicationToYAML(appName)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &ApplicationFile{
+			FileName: fmt.Sprintf("%s.yaml", a.apps[appName].Metadata.Name),
+			Content:  returned,
+		})
+	}
+	if len(a.entities) > 0 {
+		files = append(files, &ApplicationFile{
+			FileName: "entities.yaml",
+			Content:  joinYAMLFiles(a.entities),
+		})
+	}
+	return files, nil
+}
+
+// applicationToYAML converts the OAM application named `appName` into YAML. The components are written from the
+// components spec with comments (see GetParameters), so their descriptions and parameter annotations are kept.
+func (a *Application) applicationToYAML(appName string) ([]byte, error) {
+	returned, err := convertToYAML(a.apps[appName])
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error converting to YAML")
+	}
+	node, exists := a.componentsYAML[appName]
+	if !exists || node.Spec.Components.Kind != yamlV3.SequenceNode {
+		return returned, nil
+	}
+	var document yamlV3.Node
+	if err := yamlV3.Unmarshal(returned, &document); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error converting to YAML")
+	}
+	spec := getMappingValue(document.Content[0], "spec")
+	if spec == nil || spec.Kind != yamlV3.MappingNode {
+		return returned, nil
+	}
+	for i := 0; i+1 < len(spec.Content); i += 2 {
+		if spec.Content[i].Value == "components" {
+			// the encoder does not modify the node, so it can be shared with the clones
+			spec.Content[i+1] = &node.Spec.Components
+		}
+	}
+	withComments, err := encodeYAMLNode(&document)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error converting to YAML")
+	}
+	return withComments, nil
+}
+
 // toApplicationSpec convert a YAML to ApplicationSpec
 func (a *Application) toApplicationSpec(spec string) (*ApplicationSpec, error) {
 
@@ -275,7 +357,7 @@ func (a *Application) toApplicationSpec(spec string) (*ApplicationSpec, error) {
 
 	ext := ApplicationSpec{}
 	if err := d.Decode(&ext); err != nil {
-		log.Error().Err(err).Str("spec", spec).Msg("error in toRawExtension")
+		a.getLogger().Debug().Err(err).Str("spec", spec).Msg("error in toRawExtension")
 		return nil, nerrors.NewInternalError("Error processing %s", err.Error())
 	}
 	return &ext, nil
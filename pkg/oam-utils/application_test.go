@@ -16,6 +16,9 @@ limitations under the License.
 package oam_utils
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog/log"
@@ -320,6 +323,24 @@ var _ = ginkgo.Describe("Handler test on log calls", func() {
 			gomega.Expect(apps).ShouldNot(gomega.BeEmpty())
 			gomega.Expect(entities).ShouldNot(gomega.BeEmpty())
 		})
+		ginkgo.It("Should keep the comments of the components in the packaged application", func() {
+			app, err := NewApplicationFromYAML([][]byte{[]byte(annotatedApplication)})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(app.GetParametersMetadata()["annotated"]).Should(gomega.HaveLen(3))
+			gomega.Expect(app.ApplyParameters("annotated", "renamed", "")).Should(gomega.Succeed())
+
+			tgz, err := app.ToTGZ()
+			gomega.Expect(err).Should(gomega.Succeed())
+			loaded, err := NewApplicationFromTGZ(tgz)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(loaded.GetNames()).Should(gomega.Equal(map[string]string{"renamed": "renamed"}))
+			gomega.Expect(loaded.GetParametersMetadata()["renamed"]).Should(gomega.HaveLen(3))
+			expected, err := app.GetParameters()
+			gomega.Expect(err).Should(gomega.Succeed())
+			parameters, err := loaded.GetParameters()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(parameters["renamed"]).Should(gomega.Equal(expected["annotated"]))
+		})
 	})
 
 	ginkgo.Context("Getting parameters", func() {
@@ -377,4 +398,70 @@ var _ = ginkgo.Describe("Handler test on log calls", func() {
 		})
 	})
 
+	ginkgo.Context("Cloning application", func() {
+		ginkgo.It("Should be able to customize a clone without modifying the original", func() {
+			app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+			gomega.Expect(err).Should(gomega.Succeed())
+			originalParameters, err := app.GetParameters()
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			clone := app.Clone()
+			gomega.Expect(clone.ApplyParameters("application", "renamed", spec)).Should(gomega.Succeed())
+			gomega.Expect(clone.RewriteImages(func(image string) (string, error) {
+				return "registry.local/" + image, nil
+			})).Should(gomega.Succeed())
+			gomega.Expect(clone.GetNames()).Should(gomega.HaveKeyWithValue("application", "renamed"))
+			cloneImages, err := clone.GetImages()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(cloneImages[0].Image).Should(gomega.Equal("registry.local/nginx:1.20.0"))
+
+			gomega.Expect(app.GetNames()).Should(gomega.HaveKeyWithValue("application", "application"))
+			images, err := app.GetImages()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(images[0].Image).Should(gomega.Equal("nginx:1.20.0"))
+			gomega.Expect(app.GetParameters()).Should(gomega.Equal(originalParameters))
+		})
+
+		ginkgo.It("Should be able to customize clones concurrently", func() {
+			app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+			gomega.Expect(err).Should(gomega.Succeed())
+			digest, err := app.Digest()
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			var wg sync.WaitGroup
+			errors := make(chan error, 20)
+			for i := 0; i < 10; i++ {
+				wg.Add(2)
+				go func(i int) {
+					defer wg.Done()
+					clone := app.Clone()
+					if err := clone.ApplyParameters("application", fmt.Sprintf("app-%d", i), spec); err != nil {
+						errors <- err
+						return
+					}
+					if _, err := clone.ToTGZ(); err != nil {
+						errors <- err
+					}
+				}(i)
+				go func() {
+					defer wg.Done()
+					redacted, _, err := app.RedactSecrets()
+					if err != nil {
+						errors <- err
+						return
+					}
+					if _, err := redacted.ToTGZ(); err != nil {
+						errors <- err
+					}
+				}()
+			}
+			wg.Wait()
+			close(errors)
+			for err := range errors {
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+			gomega.Expect(app.Digest()).Should(gomega.Equal(digest))
+		})
+	})
+
 })
@@ -0,0 +1,363 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+const (
+	// sniffLength with the number of bytes read to detect the format of an archive
+	sniffLength = 512
+	// tarMagicOffset with the offset of the magic string in the header of a tar file
+	tarMagicOffset = 257
+	// tarMagic with the magic string of the tar files (POSIX and GNU formats)
+	tarMagic = "ustar"
+	// singleFileName with the name of the file of an application received as a single document
+	singleFileName = "application"
+)
+
+var (
+	// gzipMagic with the magic number of the gzip files
+	gzipMagic = []byte{0x1f, 0x8b}
+	// zstdMagic with the magic number of the zstd frames
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// zipMagic with the signature of the first local file header of a zip file
+	zipMagic = []byte("PK\x03\x04")
+	// emptyZipMagic with the signature of the end of central directory record of an empty zip file
+	emptyZipMagic = []byte("PK\x05\x06")
+)
+
+// NewApplicationFromZIP receives a zip file and returns the application with its files
+func NewApplicationFromZIP(rawApplication []byte, opts ...LoadOption) (*Application, error) {
+	options := newLoadOptions(opts)
+	source, err := zipFileSource(bytes.NewReader(rawApplication), int64(len(rawApplication)), options)
+	if err != nil {
+		return nil, err
+	}
+	return loadApplication(context.Background(), source, 1, options)
+}
+
+// NewApplicationFromArchive reads an application from a stream detecting its format by its first bytes: a tar
+// file (optionally compressed with gzip or zstd), a zip file, or a single YAML or JSON file (optionally
+// compressed). The limits of the options (e.g. WithMaxArchiveSize) are applied to all the formats.
+func NewApplicationFromArchive(reader io.Reader, opts ...LoadOption) (*Application, error) {
+	return NewApplicationFromArchiveContext(context.Background(), reader, opts...)
+}
+
+// NewApplicationFromArchiveContext is NewApplicationFromArchive with a context. The stream is not read after
+// the context is done and the Canceled or DeadlineExceeded error is returned.
+func NewApplicationFromArchiveContext(ctx context.Context, reader io.Reader, opts ...LoadOption) (*Application, error) {
+	options := newLoadOptions(opts)
+	source, err := archiveFileSource(&contextReader{ctx: ctx, reader: reader}, options, true)
+	if err != nil {
+		if ctxErr := checkContext(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return loadApplication(ctx, source, 1, options)
+}
+
+// PackDirectory packages the files of a catalog application stored in a directory into a tgz file.
+// The files are stored as they are (with comments and non YAML files) after checking that they
+// can be loaded as an application (with the options received).
+func PackDirectory(directory string, opts ...LoadOption) ([]byte, error) {
+	files, err := readDirectoryFiles(directory)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := NewApplication(files, opts...); err != nil {
+		return nil, err
+	}
+	return writeTGZ(files)
+}
+
+// UnpackTGZ extracts the files of a packaged catalog application into a directory. Only the logger and the
+// maximum archive size of the options are used.
+func UnpackTGZ(rawApplication []byte, directory string, opts ...LoadOption) error {
+	options := newLoadOptions(opts)
+	logger := options.getLogger()
+	limit := newArchiveLimit(options.maxArchiveSize)
+	uncompressedStream, err := gzip.NewReader(bytes.NewReader(rawApplication))
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error unpacking application")
+	}
+	tarReader := tar.NewReader(uncompressedStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error unpacking application")
+		}
+		path := filepath.Join(directory, header.Name)
+		relative, err := filepath.Rel(directory, path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(os.PathSeparator)) {
+			return nerrors.NewInvalidArgumentError("invalid file name %s", header.Name)
+		}
+		// the root directory entry (./) of the archives created with tar -C dir . is skipped
+		if relative == "." {
+			if header.Typeflag == tar.TypeDir {
+				continue
+			}
+			return nerrors.NewInvalidArgumentError("invalid file name %s", header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error unpacking application")
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error unpacking application")
+			}
+			data, err := limit.read(tarReader, header.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error unpacking application, error writing %s file", header.Name)
+			}
+		default:
+			logger.Warn().Str("type", string(header.Typeflag)).Msg("ignoring compressed type")
+		}
+	}
+}
+
+// readTGZFiles returns the regular files stored in a tgz file
+func readTGZFiles(rawApplication []byte, options *loadOptions) ([]*ApplicationFile, error) {
+	source, err := tgzFileSource(bytes.NewReader(rawApplication), options)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*ApplicationFile, 0)
+	for {
+		file, err := source()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+}
+
+// tgzFileSource returns a source with the regular files of a tgz stream. Each file is read when it is requested.
+func tgzFileSource(reader io.Reader, options *loadOptions) (fileSource, error) {
+	uncompressedStream, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+	}
+	return tarFileSource(uncompressedStream, options), nil
+}
+
+// tarFileSource returns a source with the regular files of a tar stream. Each file is read when it is requested.
+func tarFileSource(reader io.Reader, options *loadOptions) fileSource {
+	logger := options.getLogger()
+	limit := newArchiveLimit(options.maxArchiveSize)
+	tarReader := tar.NewReader(reader)
+	return func() (*ApplicationFile, error) {
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			if err != nil {
+				return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+			}
+
+			switch header.Typeflag {
+			case tar.TypeDir:
+				logger.Debug().Str("name", header.Name).Msg("is a directory")
+			case tar.TypeReg:
+				data, err := limit.read(tarReader, header.Name)
+				if err != nil {
+					return nil, err
+				}
+				return &ApplicationFile{FileName: header.Name, Content: data}, nil
+			default:
+				logger.Warn().Str("type", string(header.Typeflag)).Msg("ignoring compressed type")
+			}
+		}
+	}
+}
+
+// archiveLimit with the number of bytes that can still be read from the files of an archive
+type archiveLimit struct {
+	// remaining bytes (negative for no limit)
+	remaining int64
+}
+
+// newArchiveLimit returns a limit with the maximum size received (0 for no limit)
+func newArchiveLimit(maxSize int64) *archiveLimit {
+	if maxSize <= 0 {
+		return &archiveLimit{remaining: -1}
+	}
+	return &archiveLimit{remaining: maxSize}
+}
+
+// read reads a file of the archive. It fails with a ResourceExhausted error if the maximum size is exceeded,
+// without reading the rest of the file.
+func (al *archiveLimit) read(reader io.Reader, fileName string) ([]byte, error) {
+	if al.remaining < 0 {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading %s file", fileName)
+		}
+		return data, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, al.remaining+1))
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading %s file", fileName)
+	}
+	if int64(len(data)) > al.remaining {
+		return nil, nerrors.NewResourceExhaustedError("the files of the archive exceed the maximum size (file %s)", fileName)
+	}
+	al.remaining -= int64(len(data))
+	return data, nil
+}
+
+// readDirectoryFiles returns the files stored in a directory (and its subdirectories) named by
+// their path relative to the directory
+func readDirectoryFiles(directory string) ([]*ApplicationFile, error) {
+	files := make([]*ApplicationFile, 0)
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, &ApplicationFile{FileName: filepath.ToSlash(relative), Content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading directory %s", directory)
+	}
+	return files, nil
+}
+
+// archiveFileSource returns a source with the files of a stream detecting its format. If decompress is true, the
+// gzip and zstd streams are decompressed and their content detected again.
+func archiveFileSource(reader io.Reader, options *loadOptions, decompress bool) (fileSource, error) {
+	buffered := bufio.NewReaderSize(reader, sniffLength)
+	header, err := buffered.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+	}
+	switch {
+	case decompress && bytes.HasPrefix(header, gzipMagic):
+		uncompressedStream, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+		}
+		return archiveFileSource(uncompressedStream, options, false)
+	case decompress && bytes.HasPrefix(header, zstdMagic):
+		// the stream is decoded synchronously, so the decoder does not start goroutines
+		decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+		}
+		return archiveFileSource(decoder, options, false)
+	case bytes.HasPrefix(header, zipMagic) || bytes.HasPrefix(header, emptyZipMagic):
+		// the zip files are read from their end, so the archive is stored in memory
+		data, err := newArchiveLimit(options.maxArchiveSize).read(buffered, "zip")
+		if err != nil {
+			return nil, err
+		}
+		return zipFileSource(bytes.NewReader(data), int64(len(data)), options)
+	case len(header) >= tarMagicOffset+len(tarMagic) && string(header[tarMagicOffset:tarMagicOffset+len(tarMagic)]) == tarMagic:
+		return tarFileSource(buffered, options), nil
+	default:
+		content, err := newArchiveLimit(options.maxArchiveSize).read(buffered, singleFileName)
+		if err != nil {
+			return nil, err
+		}
+		return sliceFileSource([]*ApplicationFile{{FileName: singleFileName + singleFileExtension(content), Content: content}}), nil
+	}
+}
+
+// singleFileExtension returns the extension of a single file received without name: .json if it starts as a
+// JSON object or array, .yaml otherwise
+func singleFileExtension(content []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(content, utf8BOM))
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return jsonExtension
+	}
+	return defaultExtensions[0]
+}
+
+// zipFileSource returns a source with the regular files of a zip file. Each file is decompressed when it is
+// requested.
+func zipFileSource(reader io.ReaderAt, size int64, options *loadOptions) (fileSource, error) {
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+	}
+	logger := options.getLogger()
+	limit := newArchiveLimit(options.maxArchiveSize)
+	next := 0
+	return func() (*ApplicationFile, error) {
+		for next < len(zipReader.File) {
+			file := zipReader.File[next]
+			next++
+			mode := file.Mode()
+			if mode.IsDir() {
+				logger.Debug().Str("name", file.Name).Msg("is a directory")
+				continue
+			}
+			if !mode.IsRegular() {
+				logger.Warn().Str("type", mode.Type().String()).Msg("ignoring compressed type")
+				continue
+			}
+			content, err := file.Open()
+			if err != nil {
+				return nil, nerrors.NewInternalErrorFrom(err, "error creating application, error reading %s file", file.Name)
+			}
+			data, err := limit.read(content, file.Name)
+			content.Close()
+			if err != nil {
+				return nil, err
+			}
+			return &ApplicationFile{FileName: file.Name, Content: data}, nil
+		}
+		return nil, io.EOF
+	}, nil
+}
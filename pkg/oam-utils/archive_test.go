@@ -0,0 +1,234 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// archiveFiles returns the files of the application used to test the archive formats
+func archiveFiles() []*ApplicationFile {
+	return []*ApplicationFile{
+		{FileName: "app/app.yaml", Content: []byte(applicationFile)},
+		{FileName: "app/metadata.yaml", Content: []byte(metadata)},
+		{FileName: "app/README.md", Content: []byte(readme)}}
+}
+
+// writeTar packs a list of files into a tar file with a directory entry
+func writeTar(files []*ApplicationFile) []byte {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	gomega.Expect(tarWriter.WriteHeader(&tar.Header{Name: "app/", Mode: 0755, Typeflag: tar.TypeDir})).Should(gomega.Succeed())
+	for _, file := range files {
+		gomega.Expect(tarWriter.WriteHeader(&tar.Header{Name: file.FileName, Mode: 0644, Size: int64(len(file.Content)), Typeflag: tar.TypeReg})).Should(gomega.Succeed())
+		_, err := tarWriter.Write(file.Content)
+		gomega.Expect(err).Should(gomega.Succeed())
+	}
+	gomega.Expect(tarWriter.Close()).Should(gomega.Succeed())
+	return buf.Bytes()
+}
+
+// writeZip packs a list of files into a zip file with a directory entry
+func writeZip(files []*ApplicationFile) []byte {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	_, err := zipWriter.Create("app/")
+	gomega.Expect(err).Should(gomega.Succeed())
+	for _, file := range files {
+		writer, err := zipWriter.Create(file.FileName)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = writer.Write(file.Content)
+		gomega.Expect(err).Should(gomega.Succeed())
+	}
+	gomega.Expect(zipWriter.Close()).Should(gomega.Succeed())
+	return buf.Bytes()
+}
+
+// compressGzip compresses a content with gzip
+func compressGzip(content []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(content)
+	gomega.Expect(err).Should(gomega.Succeed())
+	gomega.Expect(writer.Close()).Should(gomega.Succeed())
+	return buf.Bytes()
+}
+
+// compressZstd compresses a content with zstd
+func compressZstd(content []byte) []byte {
+	var buf bytes.Buffer
+	writer, err := zstd.NewWriter(&buf)
+	gomega.Expect(err).Should(gomega.Succeed())
+	_, err = writer.Write(content)
+	gomega.Expect(err).Should(gomega.Succeed())
+	gomega.Expect(writer.Close()).Should(gomega.Succeed())
+	return buf.Bytes()
+}
+
+var _ = ginkgo.Describe("Archive tests", func() {
+
+	var dir string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "archive")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(os.MkdirAll(filepath.Join(dir, "app"), 0755)).Should(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "app", "app.yaml"), []byte(applicationFile), 0644)).Should(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "app", "metadata.yaml"), []byte(metadata), 0644)).Should(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "app", "README.md"), []byte(readme), 0644)).Should(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	ginkgo.It("Should be able to load an application from a directory", func() {
+		app, err := NewApplicationFromDirectory(filepath.Join(dir, "app"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("application"))
+	})
+
+	ginkgo.It("Should be able to pack and unpack a directory", func() {
+		tgz, err := PackDirectory(filepath.Join(dir, "app"))
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		app, err := NewApplicationFromTGZ(tgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("application"))
+
+		target := filepath.Join(dir, "unpacked")
+		gomega.Expect(UnpackTGZ(tgz, target)).Should(gomega.Succeed())
+		gomega.Expect(filepath.Join(target, "README.md")).Should(gomega.BeAnExistingFile())
+		content, err := os.ReadFile(filepath.Join(target, "app.yaml"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(string(content)).Should(gomega.Equal(applicationFile))
+	})
+
+	ginkgo.It("Should be able to unpack an archive with a root directory entry", func() {
+		var buf bytes.Buffer
+		tarWriter := tar.NewWriter(&buf)
+		gomega.Expect(tarWriter.WriteHeader(&tar.Header{Name: "./", Mode: 0755, Typeflag: tar.TypeDir})).Should(gomega.Succeed())
+		gomega.Expect(tarWriter.WriteHeader(&tar.Header{Name: "./app.yaml", Mode: 0644, Size: int64(len(applicationFile)), Typeflag: tar.TypeReg})).Should(gomega.Succeed())
+		_, err := tarWriter.Write([]byte(applicationFile))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(tarWriter.Close()).Should(gomega.Succeed())
+
+		target := filepath.Join(dir, "unpacked")
+		gomega.Expect(UnpackTGZ(compressGzip(buf.Bytes()), target)).Should(gomega.Succeed())
+		gomega.Expect(filepath.Join(target, "app.yaml")).Should(gomega.BeAnExistingFile())
+	})
+
+	ginkgo.It("Should be able to unpack an archive in the working directory", func() {
+		tgz, err := PackDirectory(filepath.Join(dir, "app"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		target := filepath.Join(dir, "unpacked")
+		gomega.Expect(os.MkdirAll(target, 0755)).Should(gomega.Succeed())
+		workingDir, err := os.Getwd()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(os.Chdir(target)).Should(gomega.Succeed())
+		defer os.Chdir(workingDir)
+
+		gomega.Expect(UnpackTGZ(tgz, ".")).Should(gomega.Succeed())
+		gomega.Expect(filepath.Join(target, "app.yaml")).Should(gomega.BeAnExistingFile())
+
+		evil, err := writeTGZ([]*ApplicationFile{{FileName: "../evil.yaml", Content: []byte(cm)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(UnpackTGZ(evil, ".")).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should not be able to unpack files outside the target directory", func() {
+		tgz, err := writeTGZ([]*ApplicationFile{{FileName: "../evil.yaml", Content: []byte(cm)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(UnpackTGZ(tgz, filepath.Join(dir, "unpacked"))).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to load a zip file", func() {
+		app, err := NewApplicationFromZIP(writeZip(archiveFiles()))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("application"))
+		gomega.Expect(app.GetMetadata()).ShouldNot(gomega.BeNil())
+
+		_, err = NewApplicationFromZIP([]byte("not a zip file"))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should detect the format of an archive", func() {
+		expected, err := NewApplication(archiveFiles())
+		gomega.Expect(err).Should(gomega.Succeed())
+		digest, err := expected.Digest()
+		gomega.Expect(err).Should(gomega.Succeed())
+		tarFile := writeTar(archiveFiles())
+
+		archives := map[string][]byte{
+			"tar":      tarFile,
+			"tgz":      compressGzip(tarFile),
+			"tar.zst":  compressZstd(tarFile),
+			"zip":      writeZip(archiveFiles()),
+			"yaml":     []byte(applicationFile),
+			"yaml.gz":  compressGzip([]byte(applicationFile)),
+			"yaml.zst": compressZstd([]byte(applicationFile)),
+		}
+		for format, archive := range archives {
+			app, err := NewApplicationFromArchive(bytes.NewReader(archive))
+			gomega.Expect(err).Should(gomega.Succeed(), format)
+			gomega.Expect(app.GetNames()).Should(gomega.HaveKey("application"), format)
+			if format == "tar" || format == "tgz" || format == "tar.zst" || format == "zip" {
+				gomega.Expect(app.Digest()).Should(gomega.Equal(digest), format)
+			}
+		}
+
+		app, err := NewApplicationFromArchive(bytes.NewReader([]byte(jsonApplication)))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("json-app"))
+
+		_, err = NewApplicationFromArchive(bytes.NewReader(compressGzip([]byte("name: without-gvk"))))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should apply the same limits to all the archive formats", func() {
+		tgz, err := writeTGZ(archiveFiles())
+		gomega.Expect(err).Should(gomega.Succeed())
+		tarFile := writeTar(archiveFiles())
+		limit := WithMaxArchiveSize(int64(len(applicationFile)))
+
+		_, err = NewApplicationFromTGZ(tgz, limit)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		_, err = NewApplicationFromZIP(writeZip(archiveFiles()), limit)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		for _, archive := range [][]byte{tgz, tarFile, compressZstd(tarFile), writeZip(archiveFiles())} {
+			_, err = NewApplicationFromArchive(bytes.NewReader(archive), limit)
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		}
+		_, err = NewApplicationFromArchive(bytes.NewReader(compressGzip([]byte(applicationFile+"\n"))), limit)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		gomega.Expect(UnpackTGZ(tgz, filepath.Join(dir, "unpacked"), limit)).ShouldNot(gomega.Succeed())
+
+		app, err := NewApplicationFromArchive(bytes.NewReader(tgz), WithMaxArchiveSize(int64(len(applicationFile)+len(metadata)+len(readme))))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("application"))
+	})
+})
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"context"
+	"io"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// checkContext returns a Canceled or DeadlineExceeded error if the context is done. The error wraps the context
+// error, so it can be checked with errors.Is(err, context.Canceled) or errors.Is(err, context.DeadlineExceeded).
+func checkContext(ctx context.Context) error {
+	switch err := ctx.Err(); err {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return nerrors.NewDeadlineExceededErrorFrom(err, "operation deadline exceeded")
+	default:
+		return nerrors.NewCanceledErrorFrom(err, "operation canceled")
+	}
+}
+
+// contextReader with a reader that stops reading when the context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Read reads from the underlying reader if the context is not done
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := checkContext(cr.ctx); err != nil {
+		return 0, err
+	}
+	return cr.reader.Read(p)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Context tests", func() {
+
+	var canceled context.Context
+
+	ginkgo.BeforeEach(func() {
+		var cancel context.CancelFunc
+		canceled, cancel = context.WithCancel(context.Background())
+		cancel()
+	})
+
+	ginkgo.It("Should stop loading an application when the context is done", func() {
+		files := []*ApplicationFile{{FileName: "app.yaml", Content: []byte(applicationFile)}}
+		_, err := NewApplicationContext(canceled, files)
+		gomega.Expect(errors.Is(err, context.Canceled)).Should(gomega.BeTrue())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Canceled))
+
+		expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		_, err = NewApplicationContext(expired, files)
+		gomega.Expect(errors.Is(err, context.DeadlineExceeded)).Should(gomega.BeTrue())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.DeadlineExceeded))
+
+		raw, err := writeTGZ(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewApplicationFromTGZContext(canceled, raw)
+		gomega.Expect(errors.Is(err, context.Canceled)).Should(gomega.BeTrue())
+		_, err = NewApplicationFromTGZReaderContext(canceled, bytes.NewReader(raw), 2)
+		gomega.Expect(errors.Is(err, context.Canceled)).Should(gomega.BeTrue())
+
+		app, err := NewApplicationFromTGZContext(context.Background(), raw)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("application"))
+	})
+
+	ginkgo.It("Should stop rendering and validating when the context is done", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(customApplication)},
+			{FileName: "component.yaml", Content: []byte(componentDefinition)},
+			{FileName: "trait.yaml", Content: []byte(traitDefinition)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		_, err = app.RenderContext(canceled)
+		gomega.Expect(errors.Is(err, context.Canceled)).Should(gomega.BeTrue())
+		_, err = app.RenderApplicationContext(canceled, "custom")
+		gomega.Expect(errors.Is(err, context.Canceled)).Should(gomega.BeTrue())
+		err = app.ValidateContext(canceled)
+		gomega.Expect(errors.Is(err, context.Canceled)).Should(gomega.BeTrue())
+		_, err = app.CheckSecurityPolicyContext(canceled, nil)
+		gomega.Expect(errors.Is(err, context.Canceled)).Should(gomega.BeTrue())
+
+		gomega.Expect(app.ValidateContext(context.Background())).Should(gomega.Succeed())
+	})
+})
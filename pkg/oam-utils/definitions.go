@@ -56,3 +56,44 @@ type ApplicationFile struct {
 	FileName string
 	Content  []byte
 }
+
+// componentDefinitionGVK with the KubeVela ComponentDefinition GVK
+var componentDefinitionGVK = []schema.GroupVersionKind{{
+	Group:   "core.oam.dev",
+	Version: "v1beta1",
+	Kind:    "ComponentDefinition",
+}}
+
+// traitDefinitionGVK with the KubeVela TraitDefinition GVK
+var traitDefinitionGVK = []schema.GroupVersionKind{{
+	Group:   "core.oam.dev",
+	Version: "v1beta1",
+	Kind:    "TraitDefinition",
+}}
+
+// policyDefinitionGVK with the KubeVela PolicyDefinition GVK
+var policyDefinitionGVK = []schema.GroupVersionKind{{
+	Group:   "core.oam.dev",
+	Version: "v1beta1",
+	Kind:    "PolicyDefinition",
+}}
+
+// workflowStepDefinitionGVK with the KubeVela WorkflowStepDefinition GVK
+var workflowStepDefinitionGVK = []schema.GroupVersionKind{{
+	Group:   "core.oam.dev",
+	Version: "v1beta1",
+	Kind:    "WorkflowStepDefinition",
+}}
+
+// oamGroups with the API groups of the OAM and Napptive kinds
+var oamGroups = []string{"core.oam.dev", "core.napptive.com"}
+
+// oamEntityGVK with the OAM kinds (besides applications and metadata) that can be bundled as entities
+var oamEntityGVK = []schema.GroupVersionKind{
+	componentDefinitionGVK[0],
+	traitDefinitionGVK[0],
+	policyDefinitionGVK[0],
+	workflowStepDefinitionGVK[0],
+	{Group: "core.oam.dev", Version: "v1beta1", Kind: "WorkloadDefinition"},
+	{Group: "core.oam.dev", Version: "v1beta1", Kind: "ScopeDefinition"},
+}
@@ -14,8 +14,9 @@
 package oam_utils
 
 import (
+	"encoding/json"
+
 	"github.com/napptive/nerrors/pkg/nerrors"
-	"github.com/rs/zerolog/log"
 	yamlV3 "gopkg.in/yaml.v3"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -61,6 +62,76 @@ type ApplicationDefinition struct {
 	Spec ApplicationSpec `json:"spec"`
 }
 
+// copy returns a copy of the application definition that can be modified without changing the original one.
+// The components, policies and workflow are shared because they are replaced, not modified, when the
+// application changes.
+func (ad *ApplicationDefinition) copy() *ApplicationDefinition {
+	result := *ad
+	result.Metadata.Annotations = copyStringMap(ad.Metadata.Annotations)
+	result.Metadata.Labels = copyStringMap(ad.Metadata.Labels)
+	return &result
+}
+
+// ApplicationMetadata with the catalog information of the application (name, version, description, logo...)
+type ApplicationMetadata struct {
+	// ApiVersion
+	ApiVersion string `json:"apiVersion"`
+	// Kind
+	Kind string `json:"kind"`
+	// Name of the catalog application
+	Name string `json:"name,omitempty"`
+	// Version of the catalog application
+	Version string `json:"version,omitempty"`
+	// Description of the catalog application
+	Description string `json:"description,omitempty"`
+	// Keywords with the tags of the catalog application
+	Keywords []string `json:"keywords,omitempty"`
+	// License of the catalog application
+	License string `json:"license,omitempty"`
+	// Url with the home page of the catalog application
+	Url string `json:"url,omitempty"`
+	// Doc with the documentation link of the catalog application
+	Doc string `json:"doc,omitempty"`
+	// Requires with the entities required by the catalog application
+	Requires ApplicationRequirements `json:"requires,omitempty"`
+	// Logo with the logos of the catalog application
+	Logo []ApplicationLogo `json:"logo,omitempty"`
+	// Source with the origin of the catalog application (e.g. the git commit it was loaded from)
+	Source *ApplicationSource `json:"source,omitempty"`
+}
+
+// ApplicationSource with the location a catalog application was loaded from
+type ApplicationSource struct {
+	// Repository with the location of the repository
+	Repository string `json:"repository,omitempty"`
+	// Ref with the reference (branch, tag or commit) requested
+	Ref string `json:"ref,omitempty"`
+	// Commit with the SHA of the commit loaded
+	Commit string `json:"commit,omitempty"`
+	// Path with the directory of the application in the repository
+	Path string `json:"path,omitempty"`
+}
+
+// ApplicationRequirements with the traits, scopes and Kubernetes entities required by a catalog application
+type ApplicationRequirements struct {
+	// Traits required
+	Traits []string `json:"traits,omitempty"`
+	// Scopes required
+	Scopes []string `json:"scopes,omitempty"`
+	// K8s with the Kubernetes entities required
+	K8s []string `json:"k8s,omitempty"`
+}
+
+// ApplicationLogo with a logo of a catalog application
+type ApplicationLogo struct {
+	// Src with the location of the image
+	Src string `json:"src"`
+	// Type with the media type of the image
+	Type string `json:"type,omitempty"`
+	// Size of the image (e.g. 120x120)
+	Size string `json:"size,omitempty"`
+}
+
 // ComponentsNode with the components Spec in YAML (with comments)
 // This struct is required to return Application parameters:
 // components:
@@ -74,12 +145,16 @@ type ComponentsNode struct {
 func (cn *ComponentsNode) toYAML() (string, error) {
 	data, err := yamlV3.Marshal(&ComponentsYAML{Components: cn.Spec.Components})
 	if err != nil {
-		log.Error().Err(err).Msg("error converting to YAML")
-		return "", nerrors.NewInternalError("error converting to YAML")
+		return "", nerrors.NewInternalErrorFrom(err, "error converting to YAML")
 	}
 	return string(data), nil
 }
 
+// copy returns a deep copy of the components node
+func (cn *ComponentsNode) copy() *ComponentsNode {
+	return &ComponentsNode{Spec: ComponentsYAML{Components: *copyYAMLNode(&cn.Spec.Components)}}
+}
+
 // ComponentsYAML with the components in YAML (the array of components)
 type ComponentsYAML struct {
 	Components yamlV3.Node
@@ -90,20 +165,39 @@ func getComponentsNodeFromYAML(app []byte) (*ComponentsNode, error) {
 	var node ComponentsNode
 
 	if err := yamlV3.Unmarshal(app, &node); err != nil {
-		log.Error().Err(err).Msg("Error creating components node")
-		return nil, nerrors.NewInternalError("Error creating componentsNode")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error creating componentsNode")
 	}
 	return &node, nil
 }
 
-// getComponentsFromYAML returns a ComponentsYAML from a YAML file
-func getComponentsFromYAML(app []byte) (*ComponentsYAML, error) {
-	var node ComponentsYAML
+// Component with the specification of an OAM component
+type Component struct {
+	// Name of the component
+	Name string `json:"name"`
+	// Type of the component
+	Type string `json:"type"`
+	// Properties of the component
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	// Traits attached to the component
+	Traits []ComponentTrait `json:"traits,omitempty"`
+}
 
-	if err := yamlV3.Unmarshal(app, &node); err != nil {
-		log.Error().Err(err).Msg("Error creating components yaml")
-		return nil, nerrors.NewInternalError("Error creating ComponentsYAML")
-	}
+// ComponentTrait with the specification of a trait attached to a component
+type ComponentTrait struct {
+	// Type of the trait
+	Type string `json:"type"`
+	// Properties of the trait
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
 
-	return &node, nil
+// getComponents returns the components of an application definition
+func (ad *ApplicationDefinition) getComponents() ([]Component, error) {
+	components := make([]Component, 0)
+	if ad.Spec.Components == nil || len(ad.Spec.Components.Raw) == 0 {
+		return components, nil
+	}
+	if err := json.Unmarshal(ad.Spec.Components.Raw, &components); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading the components of %s application", ad.Metadata.Name)
+	}
+	return components, nil
 }
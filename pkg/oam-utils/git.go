@@ -0,0 +1,206 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	yamlV3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// gitCommand with the git executable used to read the repositories
+	gitCommand = "git"
+	// defaultGitRef with the reference loaded if none is received
+	defaultGitRef = "HEAD"
+	// metadataSourceField with the field of the ApplicationMetadata entity that contains the source
+	metadataSourceField = "source"
+)
+
+// NewApplicationFromGit loads the application stored in a directory (empty for the root directory) of a commit
+// of a local git repository (bare or with a working tree). The ref can be a branch, a tag or a commit (HEAD if
+// it is empty). The files are read from the commit, not from the working tree, and the repository, ref, commit
+// SHA and directory are stored in the source field of the application metadata (created if the application
+// does not have metadata). The git command must be installed.
+func NewApplicationFromGit(repository string, ref string, directory string, opts ...LoadOption) (*Application, error) {
+	return NewApplicationFromGitContext(context.Background(), repository, ref, directory, opts...)
+}
+
+// NewApplicationFromGitContext is NewApplicationFromGit with a context. The git commands are killed when the
+// context is done and the Canceled or DeadlineExceeded error is returned.
+func NewApplicationFromGitContext(ctx context.Context, repository string, ref string, directory string, opts ...LoadOption) (*Application, error) {
+	if ref == "" {
+		ref = defaultGitRef
+	}
+	if strings.HasPrefix(ref, "-") {
+		return nil, nerrors.NewInvalidArgumentError("invalid git reference %s", ref)
+	}
+	treePath := path.Clean(filepath.ToSlash(directory))
+	if treePath == "." {
+		treePath = ""
+	}
+	if path.IsAbs(treePath) || treePath == ".." || strings.HasPrefix(treePath, "../") {
+		return nil, nerrors.NewInvalidArgumentError("invalid directory %s, it must be relative to the repository root", directory)
+	}
+	if _, err := exec.LookPath(gitCommand); err != nil {
+		return nil, nerrors.NewFailedPreconditionErrorFrom(err, "the git command is not installed")
+	}
+
+	if _, err := runGit(ctx, repository, "rev-parse", "--git-dir"); err != nil {
+		if ctxErr := checkContext(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "%s is not a git repository", repository)
+	}
+	output, err := runGit(ctx, repository, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		if ctxErr := checkContext(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, nerrors.NewNotFoundErrorFrom(err, "reference %s not found in %s", ref, repository)
+	}
+	commit := strings.TrimSpace(string(output))
+	// the tree is archived instead of the commit to avoid the pax header with the commit
+	tree := commit + ":" + treePath
+	output, err = runGit(ctx, repository, "cat-file", "-t", tree)
+	if err != nil || strings.TrimSpace(string(output)) != "tree" {
+		if ctxErr := checkContext(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, nerrors.NewNotFoundError("directory %s not found in %s (%s)", directory, ref, commit)
+	}
+
+	app, err := loadGitTree(ctx, repository, tree, newLoadOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	source := &ApplicationSource{Repository: repository, Ref: ref, Commit: commit, Path: treePath}
+	if err := app.setMetadataSource(source); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// runGit runs a git command in a repository and returns its output
+func runGit(ctx context.Context, repository string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, gitCommand, append([]string{"-C", repository}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "git %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// loadGitTree loads the application stored in a tree of a repository reading the tar stream of git archive
+func loadGitTree(ctx context.Context, repository string, tree string, options *loadOptions) (*Application, error) {
+	cmd := exec.CommandContext(ctx, gitCommand, "-C", repository, "archive", "--format=tar", tree)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading the git repository %s", repository)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading the git repository %s", repository)
+	}
+	app, err := loadApplication(ctx, tarFileSource(stdout, options), 1, options)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+	// the padding after the end of the tar file is discarded so the command can finish
+	_, _ = io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := checkContext(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, nerrors.NewInternalErrorFrom(err, "git archive failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return app, nil
+}
+
+// setMetadataSource stores the source in the metadata of the application keeping the rest of the metadata
+// document as it is. If the application does not have metadata, the default one is created (see getOCIMetadata).
+func (a *Application) setMetadataSource(source *ApplicationSource) error {
+	if a.metadata == nil {
+		metadata, err := a.getOCIMetadata()
+		if err != nil {
+			return err
+		}
+		metadata.Source = source
+		raw, err := convertToYAML(metadata)
+		if err != nil {
+			return err
+		}
+		a.metadata = raw
+		return nil
+	}
+
+	var value map[string]interface{}
+	if err := convertToMap(source, &value); err != nil {
+		return err
+	}
+	raw, err := setMetadataField(a.metadata, metadataSourceField, value)
+	if err != nil {
+		return err
+	}
+	a.metadata = raw
+	return nil
+}
+
+// setMetadataField returns the metadata document with a field set to a value keeping the rest of the document
+// as it is (comments and order of the fields)
+func setMetadataField(metadata []byte, field string, value interface{}) ([]byte, error) {
+	var document yamlV3.Node
+	if err := yamlV3.Unmarshal(metadata, &document); err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "error reading the application metadata: %s", err.Error())
+	}
+	if document.Kind != yamlV3.DocumentNode || len(document.Content) == 0 || document.Content[0].Kind != yamlV3.MappingNode {
+		return nil, nerrors.NewInvalidArgumentError("error reading the application metadata: it is not a YAML object")
+	}
+	var valueNode yamlV3.Node
+	if err := valueNode.Encode(value); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error writing the application metadata")
+	}
+
+	mapping := document.Content[0]
+	replaced := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == field {
+			mapping.Content[i+1] = &valueNode
+			replaced = true
+		}
+	}
+	if !replaced {
+		mapping.Content = append(mapping.Content, &yamlV3.Node{Kind: yamlV3.ScalarNode, Tag: "!!str", Value: field}, &valueNode)
+	}
+	raw, err := encodeYAMLNode(&document)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error writing the application metadata")
+	}
+	return raw, nil
+}
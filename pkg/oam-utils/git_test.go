@@ -0,0 +1,145 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const namedMetadata = `# catalog information
+apiVersion: core.napptive.com/v1alpha1
+kind: ApplicationMetadata
+name: my-app
+version: 1.0.0
+`
+
+// git runs a git command in a directory and returns its output
+func git(directory string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", directory, "-c", "user.name=test", "-c", "user.email=test@napptive.com"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	gomega.Expect(err).Should(gomega.Succeed(), string(output))
+	return strings.TrimSpace(string(output))
+}
+
+// commitFiles writes files in the working tree of a repository and commits them
+func commitFiles(repository string, files map[string]string, message string) string {
+	for name, content := range files {
+		path := filepath.Join(repository, name)
+		gomega.Expect(os.MkdirAll(filepath.Dir(path), 0755)).Should(gomega.Succeed())
+		gomega.Expect(os.WriteFile(path, []byte(content), 0644)).Should(gomega.Succeed())
+	}
+	git(repository, "add", "-A")
+	git(repository, "commit", "-q", "-m", message)
+	return git(repository, "rev-parse", "HEAD")
+}
+
+var _ = ginkgo.Describe("Git tests", func() {
+
+	var dir string
+	var repository string
+	var first string
+	var second string
+
+	ginkgo.BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			ginkgo.Skip("git is not installed")
+		}
+		var err error
+		dir, err = os.MkdirTemp("", "git")
+		gomega.Expect(err).Should(gomega.Succeed())
+		repository = filepath.Join(dir, "catalog")
+		gomega.Expect(os.MkdirAll(repository, 0755)).Should(gomega.Succeed())
+		git(repository, "init", "-q")
+
+		first = commitFiles(repository, map[string]string{
+			"apps/my-app/app.yaml":      applicationFile,
+			"apps/my-app/metadata.yaml": namedMetadata,
+			"apps/other/app.yaml":       strings.Replace(applicationFile, "name: application", "name: other", 1),
+			"README.md":                 readme,
+		}, "first version")
+		git(repository, "tag", "v1.0.0")
+		second = commitFiles(repository, map[string]string{
+			"apps/my-app/cm.yaml": strings.Replace(cm, "cm-test", "second-cm", 1),
+		}, "second version")
+		// the working tree is not loaded
+		gomega.Expect(os.WriteFile(filepath.Join(repository, "apps", "my-app", "uncommitted.yaml"), []byte(cm), 0644)).Should(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	ginkgo.It("Should load an application from a directory of a commit", func() {
+		app, err := NewApplicationFromGit(repository, "", "apps/my-app")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.Equal(map[string]string{"application": "application"}))
+		gomega.Expect(app.entities).Should(gomega.HaveLen(2))
+
+		metadata, err := app.GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Name).Should(gomega.Equal("my-app"))
+		gomega.Expect(metadata.Version).Should(gomega.Equal("1.0.0"))
+		gomega.Expect(metadata.Source).Should(gomega.Equal(&ApplicationSource{Repository: repository, Ref: "HEAD", Commit: second, Path: "apps/my-app"}))
+		gomega.Expect(string(app.metadata)).Should(gomega.HavePrefix("# catalog information"))
+
+		app, err = NewApplicationFromGit(repository, "v1.0.0", "apps/my-app/")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.entities).Should(gomega.HaveLen(1))
+		metadata, err = app.GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Source.Commit).Should(gomega.Equal(first))
+		gomega.Expect(metadata.Source.Ref).Should(gomega.Equal("v1.0.0"))
+	})
+
+	ginkgo.It("Should load an application from a bare repository", func() {
+		bare := filepath.Join(dir, "catalog.git")
+		git(dir, "clone", "-q", "--bare", repository, bare)
+
+		app, err := NewApplicationFromGit(bare, first, "apps/other", WithExcludedFiles("*.md"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("other"))
+		metadata, err := app.GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Name).Should(gomega.Equal("other"))
+		gomega.Expect(metadata.Source.Commit).Should(gomega.Equal(first))
+
+		app, err = NewApplicationFromGit(bare, "", "")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("Should fail with invalid repositories, references and directories", func() {
+		_, err := NewApplicationFromGit(dir, "", "")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+		_, err = NewApplicationFromGit(repository, "unknown", "")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		_, err = NewApplicationFromGit(repository, "--output=file", "")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+		_, err = NewApplicationFromGit(repository, "", "apps/unknown")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		_, err = NewApplicationFromGit(repository, "", "apps/my-app/app.yaml")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		_, err = NewApplicationFromGit(repository, "", "../catalog")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+})
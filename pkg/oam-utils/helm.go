@@ -0,0 +1,195 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	yamlV3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// helmChartAPIVersion with the apiVersion of the generated Chart.yaml
+	helmChartAPIVersion = "v2"
+	// helmNamePlaceholder with the placeholder used to replace the application name by its value reference
+	helmNamePlaceholder = "__OAM_UTILS_NAME__"
+	// helmComponentsPlaceholder with the placeholder used to replace the components by its value reference
+	helmComponentsPlaceholder = "__OAM_UTILS_COMPONENTS__"
+)
+
+// HelmChart with the files of a Helm chart generated from an application
+type HelmChart struct {
+	// Name of the chart
+	Name string
+	// Version of the chart
+	Version string
+	// Files with the chart files. The names are relative to the parent directory of the chart.
+	Files []*ApplicationFile
+}
+
+// ToHelmChart converts the application into a Helm chart. The components spec of each application
+// (see GetParameters) is stored in values.yaml indexed by application name, so customizing the values
+// is equivalent to call ApplyParameters.
+func (a *Application) ToHelmChart(chartName string, chartVersion string) (*HelmChart, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if chartName == "" {
+		return nil, nerrors.NewInvalidArgumentError("chart name cannot be empty")
+	}
+	if chartVersion == "" {
+		return nil, nerrors.NewInvalidArgumentError("chart version cannot be empty")
+	}
+
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	chartFile, err := yamlV3.Marshal(map[string]string{
+		"apiVersion":  helmChartAPIVersion,
+		"name":        chartName,
+		"version":     chartVersion,
+		"description": fmt.Sprintf("Helm chart generated from the %s catalog application", chartName),
+		"type":        "application",
+	})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating Chart.yaml")
+	}
+
+	values, err := a.getHelmValues(appNames)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*ApplicationFile{
+		{FileName: filepath.Join(chartName, "Chart.yaml"), Content: chartFile},
+		{FileName: filepath.Join(chartName, "values.yaml"), Content: values},
+	}
+	for _, appName := range appNames {
+		template, err := a.getHelmApplicationTemplate(appName)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &ApplicationFile{
+			FileName: filepath.Join(chartName, "templates", fmt.Sprintf("%s.yaml", appName)),
+			Content:  template,
+		})
+	}
+	if len(a.entities) > 0 {
+		files = append(files, &ApplicationFile{
+			FileName: filepath.Join(chartName, "templates", "entities.yaml"),
+			Content:  []byte(escapeHelmTemplate(string(joinYAMLFiles(a.entities)))),
+		})
+	}
+
+	return &HelmChart{
+		Name:    chartName,
+		Version: chartVersion,
+		Files:   files,
+	}, nil
+}
+
+// ToTGZ returns the chart packaged as a tgz file
+func (hc *HelmChart) ToTGZ() ([]byte, error) {
+	return writeTGZ(hc.Files)
+}
+
+// WriteToDirectory writes the chart files in the directory received. The chart is stored
+// in a subdirectory with the chart name.
+func (hc *HelmChart) WriteToDirectory(directory string) error {
+	for _, file := range hc.Files {
+		path := filepath.Join(directory, file.FileName)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error writing helm chart")
+		}
+		if err := os.WriteFile(path, file.Content, 0644); err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error writing helm chart")
+		}
+	}
+	return nil
+}
+
+// getHelmValues returns the values.yaml content with the name and the components (with comments) of each application
+func (a *Application) getHelmValues(appNames []string) ([]byte, error) {
+	root := &yamlV3.Node{Kind: yamlV3.MappingNode}
+	for _, appName := range appNames {
+		components := &yamlV3.Node{Kind: yamlV3.SequenceNode}
+		if node, exists := a.componentsYAML[appName]; exists && node.Spec.Components.Kind != 0 {
+			components = &node.Spec.Components
+		}
+		appNode := &yamlV3.Node{Kind: yamlV3.MappingNode, Content: []*yamlV3.Node{
+			{Kind: yamlV3.ScalarNode, Value: "name"},
+			{Kind: yamlV3.ScalarNode, Value: a.apps[appName].Metadata.Name},
+			{Kind: yamlV3.ScalarNode, Value: "components"},
+			components,
+		}}
+		root.Content = append(root.Content, &yamlV3.Node{Kind: yamlV3.ScalarNode, Value: appName}, appNode)
+	}
+	values, err := yamlV3.Marshal(&yamlV3.Node{Kind: yamlV3.DocumentNode, Content: []*yamlV3.Node{root}})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating values.yaml")
+	}
+	return values, nil
+}
+
+// getHelmApplicationTemplate returns the template of an application with the name and the components
+// referencing the chart values
+func (a *Application) getHelmApplicationTemplate(appName string) ([]byte, error) {
+	app := *a.apps[appName]
+	app.Metadata.Name = helmNamePlaceholder
+	app.Spec.Components = nil
+
+	var appMap map[string]interface{}
+	if err := convertToMap(app, &appMap); err != nil {
+		return nil, err
+	}
+	spec, _ := appMap["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = make(map[string]interface{}, 0)
+		appMap["spec"] = spec
+	}
+	spec["components"] = helmComponentsPlaceholder
+
+	raw, err := convertToYAML(appMap)
+	if err != nil {
+		return nil, err
+	}
+
+	valuesRef := fmt.Sprintf("(index .Values %q)", appName)
+	lines := strings.Split(escapeHelmTemplate(string(raw)), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.Contains(line, helmNamePlaceholder):
+			lines[i] = strings.Replace(line, helmNamePlaceholder, fmt.Sprintf("{{ %s.name | quote }}", valuesRef), 1)
+		case strings.Contains(line, helmComponentsPlaceholder):
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			lines[i] = fmt.Sprintf("%scomponents: {{- toYaml %s.components | nindent %d }}", line[:indent], valuesRef, indent+2)
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// escapeHelmTemplate escapes the template delimiters of a file to be included in a chart as a literal
+func escapeHelmTemplate(content string) string {
+	return strings.ReplaceAll(content, "{{", `{{ "{{" }}`)
+}
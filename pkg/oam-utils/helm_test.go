@@ -0,0 +1,147 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	yamlV3 "gopkg.in/yaml.v3"
+)
+
+// renderHelmTemplate renders a chart template with the subset of Helm functions used by the generated charts
+func renderHelmTemplate(content []byte, values map[string]interface{}) []byte {
+	funcs := template.FuncMap{
+		"toYaml": func(v interface{}) string {
+			data, err := yamlV3.Marshal(v)
+			gomega.Expect(err).Should(gomega.Succeed())
+			return strings.TrimSuffix(string(data), "\n")
+		},
+		"quote": func(v interface{}) string {
+			return fmt.Sprintf("%q", fmt.Sprint(v))
+		},
+		"nindent": func(spaces int, v string) string {
+			pad := strings.Repeat(" ", spaces)
+			return "\n" + pad + strings.ReplaceAll(v, "\n", "\n"+pad)
+		},
+	}
+	tmpl, err := template.New("chart").Funcs(funcs).Parse(string(content))
+	gomega.Expect(err).Should(gomega.Succeed())
+	var buf bytes.Buffer
+	gomega.Expect(tmpl.Execute(&buf, map[string]interface{}{"Values": values})).Should(gomega.Succeed())
+	return buf.Bytes()
+}
+
+// getChartFile returns the content of a chart file
+func getChartFile(chart *HelmChart, name string) []byte {
+	for _, file := range chart.Files {
+		if file.FileName == name {
+			return file.Content
+		}
+	}
+	return nil
+}
+
+var _ = ginkgo.Describe("Helm chart tests", func() {
+
+	ginkgo.It("Should be able to convert an application into a helm chart", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		chart, err := app.ToHelmChart("nginx", "0.1.0")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(getChartFile(chart, "nginx/Chart.yaml")).ShouldNot(gomega.BeNil())
+		gomega.Expect(getChartFile(chart, "nginx/templates/application.yaml")).ShouldNot(gomega.BeNil())
+		gomega.Expect(getChartFile(chart, "nginx/templates/entities.yaml")).ShouldNot(gomega.BeNil())
+
+		values := getChartFile(chart, "nginx/values.yaml")
+		gomega.Expect(string(values)).Should(gomega.ContainSubstring("# Image"))
+		gomega.Expect(string(values)).Should(gomega.ContainSubstring("# Port"))
+	})
+
+	ginkgo.It("Should render the same application when customizing the values", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		chart, err := app.ToHelmChart("nginx", "0.1.0")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		var specValues map[string]interface{}
+		gomega.Expect(yamlV3.Unmarshal([]byte(spec), &specValues)).Should(gomega.Succeed())
+		values := map[string]interface{}{
+			"application": map[string]interface{}{
+				"name":       "changed",
+				"components": specValues["components"],
+			},
+		}
+		rendered := renderHelmTemplate(getChartFile(chart, "nginx/templates/application.yaml"), values)
+		fromChart, err := NewApplicationFromYAML([][]byte{rendered})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(fromChart.GetNames()).Should(gomega.HaveKey("changed"))
+
+		gomega.Expect(app.ApplyParameters("application", "changed", spec)).Should(gomega.Succeed())
+		expected, err := app.apps["application"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		obtained, err := fromChart.apps["changed"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(obtained).Should(gomega.Equal(expected))
+	})
+
+	ginkgo.It("Should quote the name of the application", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		chart, err := app.ToHelmChart("nginx", "0.1.0")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		for _, name := range []string{"123", "on", "app: injected"} {
+			values := map[string]interface{}{"application": map[string]interface{}{"name": name, "components": []interface{}{}}}
+			rendered := renderHelmTemplate(getChartFile(chart, "nginx/templates/application.yaml"), values)
+			var document map[string]interface{}
+			gomega.Expect(yamlV3.Unmarshal(rendered, &document)).Should(gomega.Succeed())
+			gomega.Expect(document["metadata"]).Should(gomega.HaveKeyWithValue("name", name))
+		}
+	})
+
+	ginkgo.It("Should be able to write the chart as a directory and as a tgz file", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(completeApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		chart, err := app.ToHelmChart("complete", "1.0.0")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		dir, err := os.MkdirTemp("", "helm")
+		gomega.Expect(err).Should(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		gomega.Expect(chart.WriteToDirectory(dir)).Should(gomega.Succeed())
+		gomega.Expect(filepath.Join(dir, "complete", "templates", "app1.yaml")).Should(gomega.BeAnExistingFile())
+		gomega.Expect(filepath.Join(dir, "complete", "templates", "app2.yaml")).Should(gomega.BeAnExistingFile())
+
+		tgz, err := chart.ToTGZ()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(tgz).ShouldNot(gomega.BeEmpty())
+	})
+
+	ginkgo.It("Should not be able to create a chart without name", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = app.ToHelmChart("", "0.1.0")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
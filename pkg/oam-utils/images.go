@@ -0,0 +1,356 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	yamlV3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// defaultRegistry with the registry used by the image references without registry
+	defaultRegistry = "docker.io"
+	// defaultImageTag with the tag used by the image references without tag or digest
+	defaultImageTag = "latest"
+)
+
+// containerListKeys with the keys that contain a list of containers in Kubernetes resources
+var containerListKeys = map[string]bool{
+	"containers":          true,
+	"initContainers":      true,
+	"ephemeralContainers": true,
+}
+
+// ImageReference with an image used by the application and its location
+type ImageReference struct {
+	// Image with the image reference
+	Image string
+	// Application with the name of the OAM application (empty if the image is used by an entity)
+	Application string
+	// Component with the name of the component (empty if the image is used by an entity)
+	Component string
+	// EntityKind with the kind of the entity (empty if the image is used by a component)
+	EntityKind string
+	// EntityName with the name of the entity (empty if the image is used by a component)
+	EntityName string
+	// Path with the location of the image in the application or the entity (e.g. spec.components[0].properties.image)
+	Path string
+}
+
+// ImageRewriteFunc returns the new reference of an image. Returning the received image keeps it unchanged.
+type ImageRewriteFunc func(image string) (string, error)
+
+// ImageMapping with the rules to rewrite the image references
+type ImageMapping struct {
+	// Registries with the mirror hosts (and optional path) indexed by the source registry (e.g. docker.io)
+	Registries map[string]string
+	// Digests with the digests indexed by image reference (name:tag). The references are compared after adding the
+	// implicit registry, library path and latest tag, so nginx, nginx:latest and docker.io/library/nginx:latest are
+	// the same image. The digest is applied before the registry mapping.
+	Digests map[string]string
+}
+
+// Rewrite returns the image reference after applying the mapping
+func (im *ImageMapping) Rewrite(image string) (string, error) {
+	name, tag, digest := splitImageReference(image)
+	if name == "" {
+		return "", nerrors.NewInvalidArgumentError("invalid image reference %s", image)
+	}
+	if newDigest, exists := im.getDigest(image, name, tag, digest); exists {
+		tag, digest = "", newDigest
+	}
+	registry, repository := splitImageName(name)
+	if mirror, exists := im.Registries[registry]; exists {
+		name = fmt.Sprintf("%s/%s", strings.TrimSuffix(mirror, "/"), repository)
+	}
+	switch {
+	case digest != "":
+		return fmt.Sprintf("%s@%s", name, digest), nil
+	case tag != "":
+		return fmt.Sprintf("%s:%s", name, tag), nil
+	default:
+		return name, nil
+	}
+}
+
+// getDigest returns the digest of an image (already split in name, tag and digest) in the mapping. The exact
+// reference is used if it exists, otherwise the normalized references of the image and the keys are compared.
+func (im *ImageMapping) getDigest(image string, name string, tag string, digest string) (string, bool) {
+	if newDigest, exists := im.Digests[image]; exists {
+		return newDigest, true
+	}
+	if digest != "" {
+		return "", false
+	}
+	normalized := normalizeImageReference(name, tag)
+	for key, newDigest := range im.Digests {
+		keyName, keyTag, keyDigest := splitImageReference(key)
+		if keyName != "" && keyDigest == "" && normalizeImageReference(keyName, keyTag) == normalized {
+			return newDigest, true
+		}
+	}
+	return "", false
+}
+
+// normalizeImageReference returns the reference of an image with the registry, the repository and the tag
+// (e.g. docker.io/library/nginx:latest for nginx)
+func normalizeImageReference(name string, tag string) string {
+	registry, repository := splitImageName(name)
+	if tag == "" {
+		tag = defaultImageTag
+	}
+	return fmt.Sprintf("%s/%s:%s", registry, repository, tag)
+}
+
+// splitImageName splits an image name (without tag or digest) in registry and repository
+func splitImageName(name string) (string, string) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0], parts[1]
+	}
+	if len(parts) == 1 {
+		return defaultRegistry, fmt.Sprintf("library/%s", name)
+	}
+	return defaultRegistry, name
+}
+
+// GetImages returns the images used by the components of the OAM applications and the bundled entities
+func (a *Application) GetImages() ([]*ImageReference, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	images := make([]*ImageReference, 0)
+
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		components, err := getRawComponents(a.apps[appName])
+		if err != nil {
+			return nil, err
+		}
+		for i, component := range components {
+			componentName, _ := component.(map[string]interface{})["name"].(string)
+			walkImages(component, fmt.Sprintf("spec.components[%d]", i), true, false, func(path string, image string) string {
+				images = append(images, &ImageReference{
+					Image:       image,
+					Application: a.apps[appName].Metadata.Name,
+					Component:   componentName,
+					Path:        path,
+				})
+				return image
+			})
+		}
+	}
+
+	for _, entity := range a.entities {
+		_, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading entity")
+		}
+		walkImages(obj.Object, "", false, false, func(path string, image string) string {
+			images = append(images, &ImageReference{
+				Image:      image,
+				EntityKind: obj.GetKind(),
+				EntityName: obj.GetName(),
+				Path:       path,
+			})
+			return image
+		})
+	}
+	return images, nil
+}
+
+// RewriteImages replaces the images used by the components and the bundled entities with the value returned by
+// the rewrite function. The components spec with comments (see GetParameters) and the entities keep their comments.
+// The rewrite function is called once for each distinct image.
+func (a *Application) RewriteImages(rewrite ImageRewriteFunc) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	var rewriteErr error
+	// rewritten with the result of the rewrite function indexed by image, shared by the components and their nodes
+	rewritten := make(map[string]string, 0)
+	apply := func(path string, image string) string {
+		if rewriteErr != nil {
+			return image
+		}
+		if newImage, exists := rewritten[image]; exists {
+			return newImage
+		}
+		newImage, err := rewrite(image)
+		if err != nil {
+			rewriteErr = err
+			return image
+		}
+		rewritten[image] = newImage
+		return newImage
+	}
+
+	// the changes are applied to copies (see Clone) that replace the current content when all of them succeed
+	apps := make(map[string]*ApplicationDefinition, len(a.apps))
+	nodes := make(map[string]*ComponentsNode, len(a.componentsYAML))
+	for appName, node := range a.componentsYAML {
+		nodes[appName] = node
+	}
+	for appName, original := range a.apps {
+		app := original.copy()
+		apps[appName] = app
+		components, err := getRawComponents(app)
+		if err != nil {
+			return err
+		}
+		for _, component := range components {
+			walkImages(component, "", true, false, apply)
+		}
+		if rewriteErr != nil {
+			return nerrors.NewInternalErrorFrom(rewriteErr, "error rewriting images of %s application", appName)
+		}
+		raw, err := json.Marshal(components)
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error rewriting images of %s application", appName)
+		}
+		app.Spec.Components = &runtime.RawExtension{Raw: raw}
+
+		if node, exists := nodes[appName]; exists {
+			node = node.copy()
+			for _, component := range node.Spec.Components.Content {
+				walkImageNodes(component, "", true, false, apply)
+			}
+			nodes[appName] = node
+		}
+	}
+
+	entities := append([][]byte{}, a.entities...)
+	for i, entity := range entities {
+		var node yamlV3.Node
+		if err := yamlV3.Unmarshal(entity, &node); err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error rewriting images of entity: %s", err.Error())
+		}
+		changed := walkImageNodes(&node, "", false, false, apply)
+		if rewriteErr != nil {
+			return nerrors.NewInternalErrorFrom(rewriteErr, "error rewriting images of entity")
+		}
+		if !changed {
+			continue
+		}
+		rewritten, err := encodeYAMLNode(&node)
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error rewriting images of entity: %s", err.Error())
+		}
+		entities[i] = rewritten
+	}
+	a.apps, a.componentsYAML, a.entities = apps, nodes, entities
+	return nil
+}
+
+// getRawComponents returns the components of an application definition as generic values
+func getRawComponents(app *ApplicationDefinition) ([]interface{}, error) {
+	components := make([]interface{}, 0)
+	if app.Spec.Components == nil || len(app.Spec.Components.Raw) == 0 {
+		return components, nil
+	}
+	if err := json.Unmarshal(app.Spec.Components.Raw, &components); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading the components of %s application", app.Metadata.Name)
+	}
+	return components, nil
+}
+
+// isImageField returns true if a field contains an image: any image field of a component (properties and traits)
+// or the image of a container
+func isImageField(key string, inComponent bool, inContainer bool) bool {
+	return key == "image" && (inComponent || inContainer)
+}
+
+// walkImages calls fn for each image found in a value, replacing the image with the returned value
+func walkImages(value interface{}, path string, inComponent bool, inContainer bool, fn func(path string, image string) string) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := joinPath(path, key)
+			if image, ok := typed[key].(string); ok && isImageField(key, inComponent, inContainer) {
+				typed[key] = fn(childPath, image)
+				continue
+			}
+			if list, ok := typed[key].([]interface{}); ok && containerListKeys[key] {
+				for i, container := range list {
+					walkImages(container, fmt.Sprintf("%s[%d]", childPath, i), inComponent, true, fn)
+				}
+				continue
+			}
+			walkImages(typed[key], childPath, inComponent, false, fn)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			walkImages(child, fmt.Sprintf("%s[%d]", path, i), inComponent, false, fn)
+		}
+	}
+}
+
+// walkImageNodes calls fn for each image found in a YAML node, replacing the image with the returned value.
+// It returns true if any image has been changed.
+func walkImageNodes(node *yamlV3.Node, path string, inComponent bool, inContainer bool, fn func(path string, image string) string) bool {
+	changed := false
+	switch node.Kind {
+	case yamlV3.DocumentNode:
+		for _, child := range node.Content {
+			changed = walkImageNodes(child, path, inComponent, inContainer, fn) || changed
+		}
+	case yamlV3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			childPath := joinPath(path, key)
+			switch {
+			case value.Kind == yamlV3.ScalarNode && isImageField(key, inComponent, inContainer):
+				if newImage := fn(childPath, value.Value); newImage != value.Value {
+					value.Value = newImage
+					changed = true
+				}
+			case value.Kind == yamlV3.SequenceNode && containerListKeys[key]:
+				for j, container := range value.Content {
+					changed = walkImageNodes(container, fmt.Sprintf("%s[%d]", childPath, j), inComponent, true, fn) || changed
+				}
+			default:
+				changed = walkImageNodes(value, childPath, inComponent, false, fn) || changed
+			}
+		}
+	case yamlV3.SequenceNode:
+		for i, child := range node.Content {
+			changed = walkImageNodes(child, fmt.Sprintf("%s[%d]", path, i), inComponent, false, fn) || changed
+		}
+	}
+	return changed
+}
+
+// joinPath returns the path of a field
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"fmt"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const jobEntity = `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: wait
+        image: busybox:1.35 # wait for the database
+      containers:
+      - name: migrate
+        image: quay.io/example/migrate:v1
+      restartPolicy: Never
+`
+
+var _ = ginkgo.Describe("Image tests", func() {
+
+	ginkgo.It("Should be able to list the images of components and entities", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(fileWithWorkflow)},
+			{FileName: "job.yaml", Content: []byte(jobEntity)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		images, err := app.GetImages()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(images).Should(gomega.HaveLen(4))
+		gomega.Expect(*images[0]).Should(gomega.Equal(ImageReference{
+			Image:       "busybox",
+			Application: "appWithWorkflow",
+			Component:   "component1",
+			Path:        "spec.components[0].properties.image",
+		}))
+		gomega.Expect(*images[2]).Should(gomega.Equal(ImageReference{
+			Image:      "quay.io/example/migrate:v1",
+			EntityKind: "Job",
+			EntityName: "migrate",
+			Path:       "spec.template.spec.containers[0].image",
+		}))
+		gomega.Expect(images[3].Path).Should(gomega.Equal("spec.template.spec.initContainers[0].image"))
+	})
+
+	ginkgo.It("Should be able to rewrite images keeping the comments", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(applicationFile)},
+			{FileName: "job.yaml", Content: []byte(jobEntity)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		mapping := &ImageMapping{
+			Registries: map[string]string{"docker.io": "mirror.local/dockerhub", "quay.io": "mirror.local/quay"},
+			Digests:    map[string]string{"nginx:1.20.0": "sha256:0123"},
+		}
+		gomega.Expect(app.RewriteImages(mapping.Rewrite)).Should(gomega.Succeed())
+
+		images, err := app.GetImages()
+		gomega.Expect(err).Should(gomega.Succeed())
+		found := make([]string, 0)
+		for _, image := range images {
+			found = append(found, image.Image)
+		}
+		gomega.Expect(found).Should(gomega.ConsistOf(
+			"mirror.local/dockerhub/library/nginx@sha256:0123",
+			"mirror.local/quay/example/migrate:v1",
+			"mirror.local/dockerhub/library/busybox:1.35"))
+
+		parameters, err := app.GetParameters()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parameters["application"]).Should(gomega.ContainSubstring("mirror.local/dockerhub/library/nginx@sha256:0123 # Image"))
+
+		_, entities, err := app.ToYAML()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(string(entities[1])).Should(gomega.ContainSubstring("# wait for the database"))
+	})
+
+	ginkgo.It("Should apply the digests to the equivalent image references", func() {
+		mapping := &ImageMapping{Digests: map[string]string{
+			"nginx":                               "sha256:0123",
+			"docker.io/library/busybox:1.35":      "sha256:4567",
+			"registry.local:5000/team/api:v1":     "sha256:89ab",
+			"quay.io/example/migrate@sha256:cdef": "sha256:cdef",
+		}}
+		cases := map[string]string{
+			"nginx:latest":                    "nginx@sha256:0123",
+			"docker.io/library/nginx":         "docker.io/library/nginx@sha256:0123",
+			"nginx:1.20.0":                    "nginx:1.20.0",
+			"busybox:1.35":                    "busybox@sha256:4567",
+			"library/busybox:1.35":            "library/busybox@sha256:4567",
+			"registry.local:5000/team/api:v1": "registry.local:5000/team/api@sha256:89ab",
+			"registry.local:5000/team/api":    "registry.local:5000/team/api",
+			"quay.io/example/migrate:v1":      "quay.io/example/migrate:v1",
+		}
+		for image, expected := range cases {
+			gomega.Expect(mapping.Rewrite(image)).Should(gomega.Equal(expected), image)
+		}
+	})
+
+	ginkgo.It("Should call the rewrite function once for each distinct image", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(applicationFile)},
+			{FileName: "job.yaml", Content: []byte(jobEntity)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		calls := make(map[string]int, 0)
+		err = app.RewriteImages(func(image string) (string, error) {
+			calls[image]++
+			return "mirror.local/" + image, nil
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(calls).Should(gomega.HaveLen(3))
+		for image, count := range calls {
+			gomega.Expect(count).Should(gomega.Equal(1), image)
+		}
+	})
+
+	ginkgo.It("Should return the error of the rewrite function", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		err = app.RewriteImages(func(image string) (string, error) {
+			return "", fmt.Errorf("image %s not mirrored", image)
+		})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to rewrite image references", func() {
+		mapping := &ImageMapping{Registries: map[string]string{"localhost:5000": "mirror.local"}}
+		image, err := mapping.Rewrite("localhost:5000/team/app:v2")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(image).Should(gomega.Equal("mirror.local/team/app:v2"))
+
+		image, err = mapping.Rewrite("ghcr.io/team/app")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(image).Should(gomega.Equal("ghcr.io/team/app"))
+	})
+})
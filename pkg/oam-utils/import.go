@@ -0,0 +1,529 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// webserviceComponentType with the type used for workloads exposed by a service
+	webserviceComponentType = "webservice"
+	// workerComponentType with the type used for workloads without service
+	workerComponentType = "worker"
+	// scalerTraitType with the trait used to set the number of replicas
+	scalerTraitType = "scaler"
+	// labelsTraitType with the trait used to set the labels of the workload
+	labelsTraitType = "labels"
+	// helmChartFile with the file that identifies a Helm chart
+	helmChartFile = "Chart.yaml"
+)
+
+// deploymentGVK with the Kubernetes Deployment GVK
+var deploymentGVK = []schema.GroupVersionKind{{
+	Group:   "apps",
+	Version: "v1",
+	Kind:    "Deployment",
+}}
+
+// serviceGVK with the Kubernetes Service GVK
+var serviceGVK = []schema.GroupVersionKind{{
+	Group:   "",
+	Version: "v1",
+	Kind:    "Service",
+}}
+
+// convertibleDeploymentFields with the fields of a deployment that the components can represent indexed by the
+// path of the object that contains them. The status is ignored.
+var convertibleDeploymentFields = map[string][]string{
+	"":                       {"apiVersion", "kind", "metadata", "spec", "status"},
+	"metadata":               {"name", "labels"},
+	"spec":                   {"replicas", "selector", "template"},
+	"spec.selector":          {"matchLabels"},
+	"spec.template":          {"metadata", "spec"},
+	"spec.template.metadata": {"labels"},
+	"spec.template.spec":     {"containers", "imagePullSecrets"},
+}
+
+// convertibleContainerFields with the fields of a container that the components can represent indexed by the
+// path of the object that contains them
+var convertibleContainerFields = map[string][]string{
+	"":                   {"name", "image", "command", "args", "env", "imagePullPolicy", "ports", "resources"},
+	"resources":          {"requests", "limits"},
+	"resources.requests": {"cpu", "memory"},
+	"resources.limits":   {"cpu", "memory"},
+}
+
+// convertibleServiceFields with the fields of a service that the webservice components can represent indexed by
+// the path of the object that contains them
+var convertibleServiceFields = map[string][]string{
+	"":         {"apiVersion", "kind", "metadata", "spec", "status"},
+	"metadata": {"name"},
+	"spec":     {"selector", "ports", "type"},
+}
+
+// manifest with a Kubernetes resource read from a file
+type manifest struct {
+	raw []byte
+	gvk *schema.GroupVersionKind
+	obj *unstructured.Unstructured
+}
+
+// NewApplicationFromManifests converts a list of plain Kubernetes manifests into a catalog application
+// with an OAM application named `appName`. Deployments are converted into webservice components (if a
+// Service exposes them) or worker components, and the resources that cannot be converted are kept as entities.
+// The conversion is lossless: a deployment with any field that the components cannot represent (e.g. probes or
+// a security context), or selected by a service that the webservice component cannot represent (e.g. a NodePort
+// service, a session affinity or annotations), is kept as entity together with the services that select it.
+// Only plain Kubernetes manifests are imported, the templated files are rejected.
+func NewApplicationFromManifests(appName string, files []*ApplicationFile, opts ...LoadOption) (*Application, error) {
+	if appName == "" {
+		return nil, nerrors.NewInvalidArgumentError("application name cannot be empty")
+	}
+	options := newLoadOptions(opts)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	logger := options.getLogger()
+
+	manifests := make([]*manifest, 0)
+	for _, file := range files {
+		if filepath.Base(file.FileName) == helmChartFile {
+			return nil, nerrors.NewUnimplementedError("helm charts must be rendered (helm template) before importing them")
+		}
+		if !options.acceptsFile(file.FileName) {
+			logger.Debug().Str("file", file.FileName).Msg("skipping the file")
+			continue
+		}
+		resources, err := splitManifestFile(file.FileName, file.Content, options)
+		if err != nil {
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "cannot import manifests, error in file: %s", file.FileName)
+		}
+		for len(resources) > 0 {
+			resource := resources[0]
+			resources = resources[1:]
+			gvk, obj, err := getGVK(resource)
+			if err != nil {
+				return nil, nerrors.NewInternalError("cannot import manifests, error in file: %s - %s", filepath.Base(file.FileName), err.Error())
+			}
+			if isListKind(gvk) {
+				items, err := getListItems(obj)
+				if err != nil {
+					return nil, nerrors.NewInvalidArgumentErrorFrom(err, "cannot import manifests, error in file: %s - %s", file.FileName, err.Error())
+				}
+				resources = append(items, resources...)
+				continue
+			}
+			manifests = append(manifests, &manifest{raw: resource, gvk: gvk, obj: obj})
+		}
+	}
+
+	deployments := make([]*manifest, 0)
+	converted := make(map[*manifest]map[string]interface{}, 0)
+	for _, deployment := range manifests {
+		if !validateType(deployment.gvk, deploymentGVK) {
+			continue
+		}
+		deployments = append(deployments, deployment)
+		component, err := deploymentToComponent(deployment.obj, findServices(deployment, manifests))
+		if err != nil {
+			logger.Debug().Err(err).Str("name", deployment.obj.GetName()).Msg("deployment kept as entity")
+			continue
+		}
+		converted[deployment] = component
+	}
+	// a service is converted with the deployments it selects, so the deployments that share a service with a
+	// deployment kept as entity are kept as entities too
+	for changed := true; changed; {
+		changed = false
+		for _, service := range manifests {
+			if !validateType(service.gvk, serviceGVK) {
+				continue
+			}
+			selected := findDeployments(service, deployments)
+			if isConverted(selected, converted) {
+				continue
+			}
+			for _, deployment := range selected {
+				if _, exists := converted[deployment]; exists {
+					logger.Debug().Str("name", deployment.obj.GetName()).Str("service", service.obj.GetName()).Msg("deployment kept as entity, the service selects other deployments")
+					delete(converted, deployment)
+					changed = true
+				}
+			}
+		}
+	}
+
+	components := make([]interface{}, 0)
+	consumed := make(map[*manifest]bool, 0)
+	for _, resource := range manifests {
+		if component, exists := converted[resource]; exists {
+			components = append(components, component)
+			consumed[resource] = true
+		} else if validateType(resource.gvk, serviceGVK) {
+			selected := findDeployments(resource, deployments)
+			consumed[resource] = len(selected) > 0 && isConverted(selected, converted)
+		}
+	}
+
+	appFile, err := convertToYAML(map[string]interface{}{
+		"apiVersion": fmt.Sprintf("%s/%s", applicationGVK[1].Group, applicationGVK[1].Version),
+		"kind":       applicationGVK[1].Kind,
+		"metadata":   map[string]interface{}{"name": appName},
+		"spec":       map[string]interface{}{"components": components},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	appFiles := []*ApplicationFile{{FileName: fmt.Sprintf("%s.yaml", appName), Content: appFile}}
+	for i, resource := range manifests {
+		if consumed[resource] {
+			continue
+		}
+		appFiles = append(appFiles, &ApplicationFile{
+			FileName: fmt.Sprintf("entity-%d.yaml", i),
+			Content:  resource.raw,
+		})
+	}
+	// the generated files are loaded without the file filters
+	return loadApplication(context.Background(), sliceFileSource(appFiles), 1, options.withoutFileFilters())
+}
+
+// NewApplicationFromManifestsDirectory converts the Kubernetes manifests stored in a directory into a catalog application
+func NewApplicationFromManifestsDirectory(appName string, directory string, opts ...LoadOption) (*Application, error) {
+	files, err := readDirectoryFiles(directory)
+	if err != nil {
+		return nil, err
+	}
+	return NewApplicationFromManifests(appName, files, opts...)
+}
+
+// findServices returns the services of the manifests that select the pods of a deployment
+func findServices(deployment *manifest, manifests []*manifest) []*manifest {
+	services := make([]*manifest, 0)
+	for _, candidate := range manifests {
+		if validateType(candidate.gvk, serviceGVK) && selectsDeployment(candidate, deployment) {
+			services = append(services, candidate)
+		}
+	}
+	return services
+}
+
+// findDeployments returns the deployments whose pods are selected by a service
+func findDeployments(service *manifest, deployments []*manifest) []*manifest {
+	selected := make([]*manifest, 0)
+	for _, deployment := range deployments {
+		if selectsDeployment(service, deployment) {
+			selected = append(selected, deployment)
+		}
+	}
+	return selected
+}
+
+// selectsDeployment checks if a service selects the pods of a deployment
+func selectsDeployment(service *manifest, deployment *manifest) bool {
+	if service.obj.GetNamespace() != deployment.obj.GetNamespace() {
+		return false
+	}
+	selector, found, _ := unstructured.NestedStringMap(service.obj.Object, "spec", "selector")
+	if !found || len(selector) == 0 {
+		return false
+	}
+	podLabels, _, _ := unstructured.NestedStringMap(deployment.obj.Object, "spec", "template", "metadata", "labels")
+	for key, value := range selector {
+		if podLabels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// isConverted checks if all the deployments of a list have been converted into components
+func isConverted(deployments []*manifest, converted map[*manifest]map[string]interface{}) bool {
+	for _, deployment := range deployments {
+		if _, exists := converted[deployment]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// findUnsupportedFields returns the paths of the fields of an object that are not included in the supported
+// fields (indexed by the path of the object that contains them)
+func findUnsupportedFields(object map[string]interface{}, supported map[string][]string) []string {
+	unsupported := make([]string, 0)
+	for path, fields := range supported {
+		value := object
+		if path != "" {
+			nested, found, err := unstructured.NestedFieldNoCopy(object, strings.Split(path, ".")...)
+			if err != nil || !found {
+				continue
+			}
+			if value, _ = nested.(map[string]interface{}); value == nil {
+				continue
+			}
+		}
+		for key := range value {
+			if !containsString(fields, key) {
+				unsupported = append(unsupported, joinPath(path, key))
+			}
+		}
+	}
+	sort.Strings(unsupported)
+	return unsupported
+}
+
+// deploymentToComponent converts a deployment and the services exposing it into a component
+func deploymentToComponent(deployment *unstructured.Unstructured, services []*manifest) (map[string]interface{}, error) {
+	containers, _, err := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) != 1 {
+		return nil, nerrors.NewUnimplementedError("only deployments with one container can be converted")
+	}
+	container, ok := containers[0].(map[string]interface{})
+	if !ok {
+		return nil, nerrors.NewInvalidArgumentError("invalid container specification")
+	}
+	if err := checkConvertibleDeployment(deployment, container); err != nil {
+		return nil, err
+	}
+
+	properties := map[string]interface{}{}
+	image, _, _ := unstructured.NestedString(container, "image")
+	if image == "" {
+		return nil, nerrors.NewInvalidArgumentError("container without image")
+	}
+	properties["image"] = image
+	if command, found, _ := unstructured.NestedStringSlice(container, "command"); found {
+		properties["cmd"] = command
+	}
+	if args, found, _ := unstructured.NestedStringSlice(container, "args"); found {
+		properties["args"] = args
+	}
+	if env, found, _ := unstructured.NestedSlice(container, "env"); found {
+		properties["env"] = env
+	}
+	if policy, found, _ := unstructured.NestedString(container, "imagePullPolicy"); found {
+		properties["imagePullPolicy"] = policy
+	}
+	for _, resource := range []string{"cpu", "memory"} {
+		if value, found, _ := unstructured.NestedFieldNoCopy(container, "resources", "requests", resource); found {
+			properties[resource] = fmt.Sprint(value)
+		} else if value, found, _ := unstructured.NestedFieldNoCopy(container, "resources", "limits", resource); found {
+			properties[resource] = fmt.Sprint(value)
+		}
+	}
+	if secrets, found, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "imagePullSecrets"); found {
+		names := make([]interface{}, 0, len(secrets))
+		for _, secret := range secrets {
+			name, _, _ := unstructured.NestedString(secret.(map[string]interface{}), "name")
+			names = append(names, name)
+		}
+		properties["imagePullSecrets"] = names
+	}
+
+	componentType := workerComponentType
+	if len(services) > 0 {
+		for _, service := range services {
+			if err := checkConvertibleService(service.obj, deployment.GetName()); err != nil {
+				return nil, err
+			}
+		}
+		ports, err := getExposedPorts(container, services)
+		if err != nil {
+			return nil, err
+		}
+		componentType = webserviceComponentType
+		properties["ports"] = ports
+	}
+
+	traits := make([]interface{}, 0)
+	if replicas, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas"); found {
+		traits = append(traits, map[string]interface{}{
+			"type":       scalerTraitType,
+			"properties": map[string]interface{}{"replicas": replicas},
+		})
+	}
+	if labels := deployment.GetLabels(); len(labels) > 0 {
+		traits = append(traits, map[string]interface{}{
+			"type":       labelsTraitType,
+			"properties": labels,
+		})
+	}
+
+	component := map[string]interface{}{
+		"name":       deployment.GetName(),
+		"type":       componentType,
+		"properties": properties,
+	}
+	if len(traits) > 0 {
+		component["traits"] = traits
+	}
+	return component, nil
+}
+
+// checkConvertibleDeployment returns an Unimplemented error if a deployment has any field that the components
+// cannot represent
+func checkConvertibleDeployment(deployment *unstructured.Unstructured, container map[string]interface{}) error {
+	unsupported := findUnsupportedFields(deployment.Object, convertibleDeploymentFields)
+	for _, field := range findUnsupportedFields(container, convertibleContainerFields) {
+		unsupported = append(unsupported, joinPath("spec.template.spec.containers[0]", field))
+	}
+	if len(unsupported) > 0 {
+		return nerrors.NewUnimplementedError("deployment fields not supported by the components: %s", strings.Join(unsupported, ", "))
+	}
+
+	// the workload and its container are named after the component
+	if name, _, _ := unstructured.NestedString(container, "name"); name != "" && name != deployment.GetName() {
+		return nerrors.NewUnimplementedError("the container name %s is different from the deployment name", name)
+	}
+	// the pods get the labels of the labels trait and the selector of the component
+	podLabels, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "template", "metadata", "labels")
+	selector, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "selector", "matchLabels")
+	for key, value := range podLabels {
+		if deployment.GetLabels()[key] != value && selector[key] != value {
+			return nerrors.NewUnimplementedError("the pod label %s is not a label of the deployment", key)
+		}
+	}
+	for _, resource := range []string{"cpu", "memory"} {
+		request, hasRequest, _ := unstructured.NestedFieldNoCopy(container, "resources", "requests", resource)
+		limit, hasLimit, _ := unstructured.NestedFieldNoCopy(container, "resources", "limits", resource)
+		if hasRequest && hasLimit && fmt.Sprint(request) != fmt.Sprint(limit) {
+			return nerrors.NewUnimplementedError("different %s request and limit", resource)
+		}
+	}
+	env, _, _ := unstructured.NestedSlice(container, "env")
+	for _, raw := range env {
+		variable, ok := raw.(map[string]interface{})
+		if !ok {
+			return nerrors.NewInvalidArgumentError("invalid environment variable")
+		}
+		if fields := findUnsupportedFields(variable, map[string][]string{
+			"":          {"name", "value", "valueFrom"},
+			"valueFrom": {"secretKeyRef", "configMapKeyRef"},
+		}); len(fields) > 0 {
+			return nerrors.NewUnimplementedError("environment variable fields not supported by the components: %s", strings.Join(fields, ", "))
+		}
+	}
+	ports, _, _ := unstructured.NestedSlice(container, "ports")
+	for _, raw := range ports {
+		port, ok := raw.(map[string]interface{})
+		if !ok {
+			return nerrors.NewInvalidArgumentError("invalid container port")
+		}
+		if fields := findUnsupportedFields(port, map[string][]string{"": {"containerPort", "protocol"}}); len(fields) > 0 {
+			return nerrors.NewUnimplementedError("container port fields not supported by the components: %s", strings.Join(fields, ", "))
+		}
+	}
+	secrets, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "imagePullSecrets")
+	for _, raw := range secrets {
+		secret, ok := raw.(map[string]interface{})
+		if !ok || len(secret) != 1 {
+			return nerrors.NewUnimplementedError("image pull secrets must only have a name")
+		}
+		if _, isString := secret["name"].(string); !isString {
+			return nerrors.NewUnimplementedError("image pull secrets must only have a name")
+		}
+	}
+	return nil
+}
+
+// checkConvertibleService returns an Unimplemented error if a service has any field that the webservice component
+// named `componentName` cannot represent. The component creates a ClusterIP service named after it.
+func checkConvertibleService(service *unstructured.Unstructured, componentName string) error {
+	if unsupported := findUnsupportedFields(service.Object, convertibleServiceFields); len(unsupported) > 0 {
+		return nerrors.NewUnimplementedError("service fields not supported by the components: %s", strings.Join(unsupported, ", "))
+	}
+	if service.GetName() != componentName {
+		return nerrors.NewUnimplementedError("the service name %s is different from the deployment name", service.GetName())
+	}
+	if serviceType, _, _ := unstructured.NestedString(service.Object, "spec", "type"); serviceType != "" && serviceType != "ClusterIP" {
+		return nerrors.NewUnimplementedError("services of type %s cannot be converted", serviceType)
+	}
+	ports, _, _ := unstructured.NestedSlice(service.Object, "spec", "ports")
+	for _, raw := range ports {
+		port, ok := raw.(map[string]interface{})
+		if !ok {
+			return nerrors.NewInvalidArgumentError("invalid service port")
+		}
+		if fields := findUnsupportedFields(port, map[string][]string{"": {"port", "targetPort", "protocol"}}); len(fields) > 0 {
+			return nerrors.NewUnimplementedError("service port fields not supported by the components: %s", strings.Join(fields, ", "))
+		}
+	}
+	return nil
+}
+
+// getExposedPorts returns the webservice ports of a container exposed by a list of services. The services can only
+// be converted if they use the container port as service port.
+func getExposedPorts(container map[string]interface{}, services []*manifest) ([]interface{}, error) {
+	exposed := make(map[int64]string, 0)
+	for _, service := range services {
+		servicePorts, _, _ := unstructured.NestedSlice(service.obj.Object, "spec", "ports")
+		for _, raw := range servicePorts {
+			servicePort, _ := raw.(map[string]interface{})
+			port, _, _ := unstructured.NestedInt64(servicePort, "port")
+			if target, found, _ := unstructured.NestedFieldNoCopy(servicePort, "targetPort"); found {
+				if targetPort, ok := target.(int64); !ok || targetPort != port {
+					return nil, nerrors.NewUnimplementedError("services with a target port different from the port cannot be converted")
+				}
+			}
+			protocol, _, _ := unstructured.NestedString(servicePort, "protocol")
+			exposed[port] = protocol
+		}
+	}
+
+	ports := make([]interface{}, 0)
+	containerPorts, _, _ := unstructured.NestedSlice(container, "ports")
+	for _, raw := range containerPorts {
+		containerPort, _ := raw.(map[string]interface{})
+		port, _, _ := unstructured.NestedInt64(containerPort, "containerPort")
+		entry := map[string]interface{}{"port": port, "expose": false}
+		if protocol, found := exposed[port]; found {
+			entry["expose"] = true
+			if protocol != "" {
+				entry["protocol"] = protocol
+			}
+			delete(exposed, port)
+		}
+		ports = append(ports, entry)
+	}
+	// ports exposed by the service but not declared in the container
+	remaining := make([]int64, 0, len(exposed))
+	for port := range exposed {
+		remaining = append(remaining, port)
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i] < remaining[j] })
+	for _, port := range remaining {
+		entry := map[string]interface{}{"port": port, "expose": true}
+		if exposed[port] != "" {
+			entry["protocol"] = exposed[port]
+		}
+		ports = append(ports, entry)
+	}
+	return ports, nil
+}
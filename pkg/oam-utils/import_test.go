@@ -0,0 +1,243 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const exposedDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    app: nginx
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: nginx
+  template:
+    metadata:
+      labels:
+        app: nginx
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.20.0
+        env:
+        - name: MODE
+          value: production
+        resources:
+          requests:
+            cpu: 250m
+            memory: 128Mi
+        ports:
+        - containerPort: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+spec:
+  selector:
+    app: nginx
+  ports:
+  - port: 80
+    targetPort: 80
+`
+
+const workerDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: sleeper
+spec:
+  selector:
+    matchLabels:
+      app: sleeper
+  template:
+    metadata:
+      labels:
+        app: sleeper
+    spec:
+      containers:
+      - name: sleeper
+        image: busybox
+        command: ["sleep", "86400"]
+`
+
+const multiContainerDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: sidecar
+spec:
+  selector:
+    matchLabels:
+      app: sidecar
+  template:
+    metadata:
+      labels:
+        app: sidecar
+    spec:
+      containers:
+      - name: main
+        image: busybox
+      - name: proxy
+        image: envoyproxy/envoy
+`
+
+// probedDeployment with a deployment exposed by the service of exposedDeployment that has a readiness probe
+const probedDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: probed
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  template:
+    metadata:
+      labels:
+        app: nginx
+    spec:
+      containers:
+      - name: probed
+        image: nginx:1.20.0
+        readinessProbe:
+          httpGet:
+            path: /
+            port: 80
+`
+
+var _ = ginkgo.Describe("Manifest import tests", func() {
+
+	ginkgo.It("Should be able to convert a deployment with a service into a webservice", func() {
+		files := []*ApplicationFile{
+			{FileName: "nginx.yaml", Content: []byte(exposedDeployment)},
+			{FileName: "cm.yaml", Content: []byte(cm)}}
+		app, err := NewApplicationFromManifests("imported", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("imported"))
+
+		components, err := app.apps["imported"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components).Should(gomega.HaveLen(1))
+		gomega.Expect(components[0].Type).Should(gomega.Equal("webservice"))
+		gomega.Expect(components[0].Properties).Should(gomega.HaveKeyWithValue("image", "nginx:1.20.0"))
+		gomega.Expect(components[0].Properties).Should(gomega.HaveKeyWithValue("cpu", "250m"))
+		gomega.Expect(components[0].Properties["ports"]).Should(gomega.HaveLen(1))
+		gomega.Expect(components[0].Traits).Should(gomega.HaveLen(2))
+		gomega.Expect(components[0].Traits[0].Type).Should(gomega.Equal("scaler"))
+
+		// the config map is kept as entity, the service is part of the component
+		gomega.Expect(app.entities).Should(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("Should be able to convert a deployment without service into a worker", func() {
+		files := []*ApplicationFile{{FileName: "worker.yaml", Content: []byte(workerDeployment)}}
+		app, err := NewApplicationFromManifests("imported", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		components, err := app.apps["imported"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components).Should(gomega.HaveLen(1))
+		gomega.Expect(components[0].Type).Should(gomega.Equal("worker"))
+		gomega.Expect(components[0].Properties).Should(gomega.HaveKey("cmd"))
+
+		parameters, err := app.GetParameters()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parameters["imported"]).Should(gomega.ContainSubstring("busybox"))
+	})
+
+	ginkgo.It("Should keep as entities the deployments that cannot be converted", func() {
+		files := []*ApplicationFile{{FileName: "sidecar.yaml", Content: []byte(multiContainerDeployment)}}
+		app, err := NewApplicationFromManifests("imported", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		components, err := app.apps["imported"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components).Should(gomega.BeEmpty())
+		gomega.Expect(app.entities).Should(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("Should keep as entities the deployments with fields the components cannot represent", func() {
+		files := []*ApplicationFile{{FileName: "worker.yaml", Content: []byte(strings.Replace(workerDeployment,
+			"        command:", "        securityContext:\n          runAsNonRoot: true\n        command:", 1))}}
+		app, err := NewApplicationFromManifests("imported", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.entities).Should(gomega.HaveLen(1))
+
+		limited := strings.Replace(exposedDeployment, "            memory: 128Mi\n", "            memory: 128Mi\n          limits:\n            cpu: 500m\n", 1)
+		app, err = NewApplicationFromManifests("imported", []*ApplicationFile{{FileName: "nginx.yaml", Content: []byte(limited)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entityNames(app)).Should(gomega.Equal([]string{"nginx", "nginx"}))
+	})
+
+	ginkgo.It("Should keep the services that select deployments kept as entities", func() {
+		files := []*ApplicationFile{{FileName: "nginx.yaml", Content: []byte(exposedDeployment + "---" + probedDeployment)}}
+		app, err := NewApplicationFromManifests("imported", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		components, err := app.apps["imported"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components).Should(gomega.BeEmpty())
+		gomega.Expect(entityNames(app)).Should(gomega.Equal([]string{"nginx", "nginx", "probed"}))
+	})
+
+	ginkgo.It("Should keep as entities the services that cannot be converted without loss", func() {
+		services := []string{
+			strings.Replace(exposedDeployment, "  ports:\n  - port: 80\n", "  type: NodePort\n  ports:\n  - port: 80\n    nodePort: 30080\n", 1),
+			strings.Replace(exposedDeployment, "  ports:\n", "  sessionAffinity: ClientIP\n  ports:\n", 1),
+			strings.Replace(exposedDeployment, "  name: nginx\nspec:\n  selector", "  name: nginx\n  annotations:\n    cloud.google.com/neg: '{\"ingress\": true}'\nspec:\n  selector", 1),
+			strings.Replace(exposedDeployment, "  name: nginx\nspec:\n  selector", "  name: frontend\nspec:\n  selector", 1),
+		}
+		for _, manifests := range services {
+			files := []*ApplicationFile{{FileName: "nginx.yaml", Content: []byte(manifests)}}
+			app, err := NewApplicationFromManifests("imported", files)
+			gomega.Expect(err).Should(gomega.Succeed())
+			components, err := app.apps["imported"].getComponents()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(components).Should(gomega.BeEmpty())
+			gomega.Expect(app.entities).Should(gomega.HaveLen(2))
+		}
+	})
+
+	ginkgo.It("Should be able to import the manifests of a directory", func() {
+		dir, err := os.MkdirTemp("", "manifests")
+		gomega.Expect(err).Should(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "nginx.yaml"), []byte(exposedDeployment), 0644)).Should(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0644)).Should(gomega.Succeed())
+
+		app, err := NewApplicationFromManifestsDirectory("imported", dir)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("imported"))
+	})
+
+	ginkgo.It("Should not be able to import a helm chart", func() {
+		files := []*ApplicationFile{{FileName: "chart/Chart.yaml", Content: []byte("apiVersion: v2\nname: chart\n")}}
+		_, err := NewApplicationFromManifests("imported", files)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
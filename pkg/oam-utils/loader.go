@@ -0,0 +1,363 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog"
+)
+
+// fileSource returns the next file of an application or io.EOF when there are no more files
+type fileSource func() (*ApplicationFile, error)
+
+// decodedFile with the resources of an application file
+type decodedFile struct {
+	// fileName with the name of the file
+	fileName string
+	// apps with the OAM applications
+	apps []*ApplicationDefinition
+	// nodes with the components YAML spec of the OAM applications (in the same order as apps)
+	nodes []*ComponentsNode
+	// metadata with the ApplicationMetadata entities
+	metadata [][]byte
+	// entities with the rest of the entities
+	entities [][]byte
+}
+
+// decodeResult with the result of decoding a file in a worker
+type decodeResult struct {
+	decoded *decodedFile
+	err     error
+}
+
+// decodeJob with a file to decode and the channel where the result is sent
+type decodeJob struct {
+	file   *ApplicationFile
+	result chan decodeResult
+}
+
+// NewApplicationWithWorkers converts an oam application from an array of yaml files into an Application decoding
+// the files in parallel with the number of workers received. The result is the same as NewApplication.
+func NewApplicationWithWorkers(files []*ApplicationFile, workers int, opts ...LoadOption) (*Application, error) {
+	return loadApplication(context.Background(), sliceFileSource(files), workers, newLoadOptions(opts))
+}
+
+// NewApplicationFromTGZReader reads a tgz file from a stream and returns the application. The files are decoded
+// as they are read (in parallel if workers is greater than 1), so the tgz and its files are never fully stored
+// in memory.
+func NewApplicationFromTGZReader(reader io.Reader, workers int, opts ...LoadOption) (*Application, error) {
+	return NewApplicationFromTGZReaderContext(context.Background(), reader, workers, opts...)
+}
+
+// NewApplicationFromTGZReaderContext is NewApplicationFromTGZReader with a context. The stream is not read after
+// the context is done and the Canceled or DeadlineExceeded error is returned.
+func NewApplicationFromTGZReaderContext(ctx context.Context, reader io.Reader, workers int, opts ...LoadOption) (*Application, error) {
+	options := newLoadOptions(opts)
+	source, err := tgzFileSource(&contextReader{ctx: ctx, reader: reader}, options)
+	if err != nil {
+		if ctxErr := checkContext(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return loadApplication(ctx, source, workers, options)
+}
+
+// sliceFileSource returns a source with the files of an array
+func sliceFileSource(files []*ApplicationFile) fileSource {
+	next := 0
+	return func() (*ApplicationFile, error) {
+		if next >= len(files) {
+			return nil, io.EOF
+		}
+		next++
+		return files[next-1], nil
+	}
+}
+
+// loadApplication decodes the files of a source and builds the application. The files are decoded by the number
+// of workers received, but their resources are added in the order of the source. The context is checked
+// before reading each file and decoding each document.
+func loadApplication(ctx context.Context, source fileSource, workers int, options *loadOptions) (*Application, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	loader := newApplicationLoader(options)
+	if workers <= 1 {
+		for {
+			file, err := nextFile(ctx, source)
+			if err == io.EOF {
+				return loader.application()
+			}
+			if err != nil {
+				return nil, err
+			}
+			decoded, err := decodeFile(ctx, file, options)
+			if err != nil {
+				return nil, err
+			}
+			if err := loader.add(decoded); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the shared context is canceled on the first error to stop reading and decoding the rest of the files
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan *decodeJob)
+	ordered := make(chan chan decodeResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := checkContext(ctx); err != nil {
+					job.result <- decodeResult{err: err}
+					continue
+				}
+				decoded, err := decodeFile(ctx, job.file, options)
+				job.result <- decodeResult{decoded: decoded, err: err}
+			}
+		}()
+	}
+
+	// the results are collected in the order the files were read
+	var decodeErr error
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for result := range ordered {
+			received := <-result
+			if decodeErr == nil && received.err != nil {
+				decodeErr = received.err
+			}
+			if decodeErr == nil {
+				decodeErr = loader.add(received.decoded)
+			}
+			if decodeErr != nil {
+				cancel()
+			}
+		}
+	}()
+
+	var sourceErr error
+	for {
+		file, err := nextFile(ctx, source)
+		if err != nil {
+			if err != io.EOF {
+				sourceErr = err
+			}
+			break
+		}
+		result := make(chan decodeResult, 1)
+		ordered <- result
+		jobs <- &decodeJob{file: file, result: result}
+	}
+	close(jobs)
+	wg.Wait()
+	close(ordered)
+	<-collected
+
+	// the decode error is returned first, as it causes the cancellation of the source
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if sourceErr != nil {
+		return nil, sourceErr
+	}
+	return loader.application()
+}
+
+// nextFile returns the next file of a source if the context is not done. The errors caused by a done context
+// (e.g. a canceled read) are returned as the context error.
+func nextFile(ctx context.Context, source fileSource) (*ApplicationFile, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	file, err := source()
+	if err != nil && err != io.EOF {
+		if ctxErr := checkContext(ctx); ctxErr != nil {
+			return nil, ctxErr
+		}
+	}
+	return file, err
+}
+
+// decodeFile splits a YAML or JSON file and classifies its resources (expanding the Kubernetes lists). It returns
+// nil if the file is not loaded according to the options.
+func decodeFile(ctx context.Context, file *ApplicationFile, options *loadOptions) (*decodedFile, error) {
+	logger := options.getLogger()
+	if !options.acceptsFile(file.FileName) {
+		logger.Debug().Str("file", file.FileName).Msg("skipping the file")
+		return nil, nil
+	}
+
+	resources, err := splitManifestFile(file.FileName, file.Content, options)
+	if err != nil {
+		logger.Debug().Err(err).Str("File", file.FileName).Msg("error split application file")
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "cannot create application, error in file: %s", file.FileName)
+	}
+	if options.maxDocuments > 0 && len(resources) > options.maxDocuments {
+		return nil, nerrors.NewResourceExhaustedError("cannot create application, more than %d documents", options.maxDocuments)
+	}
+	if options.variables != nil {
+		for i, resource := range resources {
+			if resources[i], err = substituteDocumentVariables(resource, options.variables); err != nil {
+				return nil, nerrors.NewInvalidArgumentError("cannot create application, error in file %s: %s", file.FileName, err.Error())
+			}
+		}
+	}
+
+	decoded := &decodedFile{fileName: file.FileName}
+	for len(resources) > 0 {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		entity := resources[0]
+		resources = resources[1:]
+		gvk, app, err := getGVK(entity)
+		if err != nil {
+			logger.Debug().Err(err).Str("File", file.FileName).Msg("yaml file without GVK")
+			return nil, nerrors.NewInternalError("cannot create application, error in file: %s - %s", filepath.Base(file.FileName), err.Error())
+		}
+		if isListKind(gvk) {
+			items, err := getListItems(app)
+			if err != nil {
+				return nil, nerrors.NewInvalidArgumentErrorFrom(err, "cannot create application, error in file: %s - %s", file.FileName, err.Error())
+			}
+			// the items are decoded before the next documents to keep the order of the file
+			resources = append(items, resources...)
+			continue
+		}
+		if !options.acceptsKind(gvk) {
+			return nil, nerrors.NewInvalidArgumentError("cannot create application, unknown kind %s in file: %s", gvk.String(), file.FileName)
+		}
+		switch getGVKType(gvk) {
+		// Application
+		case EntityType_APP:
+			var appDefinition ApplicationDefinition
+			if err := convertFromUnstructured(app, &appDefinition); err != nil {
+				logger.Debug().Err(err).Str("File", file.FileName).Msg("error converting application")
+				return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+			}
+			node, err := getComponentsNodeFromYAML(entity)
+			if err != nil {
+				logger.Debug().Err(err).Str("File", file.FileName).Msg("error creating application")
+				return nil, nerrors.NewInternalErrorFrom(err, "error creating application")
+			}
+			decoded.apps = append(decoded.apps, &appDefinition)
+			decoded.nodes = append(decoded.nodes, node)
+		// Metadata
+		case EntityType_METADATA:
+			logger.Debug().Str("file", file.FileName).Msg("is metadata file")
+			decoded.metadata = append(decoded.metadata, entity)
+		// Others
+		default:
+			if options.dropComments {
+				if entity, err = withoutYAMLComments(entity); err != nil {
+					return nil, nerrors.NewInternalErrorFrom(err, "cannot create application, error in file: %s", file.FileName)
+				}
+			}
+			decoded.entities = append(decoded.entities, entity)
+		}
+	}
+	return decoded, nil
+}
+
+// applicationLoader with the resources of the decoded files of an application
+type applicationLoader struct {
+	options   *loadOptions
+	logger    *zerolog.Logger
+	documents int
+	apps      map[string]*ApplicationDefinition
+	nodes     map[string]*ComponentsNode
+	entities  [][]byte
+	metadata  []byte
+}
+
+// newApplicationLoader returns an empty loader with the options received
+func newApplicationLoader(options *loadOptions) *applicationLoader {
+	return &applicationLoader{
+		options: options,
+		logger:  options.getLogger(),
+		apps:    make(map[string]*ApplicationDefinition, 0),
+		nodes:   make(map[string]*ComponentsNode, 0),
+	}
+}
+
+// add adds the resources of a decoded file (nil for the skipped files). It fails if the maximum number of
+// documents is exceeded.
+func (al *applicationLoader) add(decoded *decodedFile) error {
+	if decoded == nil {
+		return nil
+	}
+	al.documents += len(decoded.apps) + len(decoded.metadata) + len(decoded.entities)
+	if al.options.maxDocuments > 0 && al.documents > al.options.maxDocuments {
+		return nerrors.NewResourceExhaustedError("cannot create application, more than %d documents", al.options.maxDocuments)
+	}
+	for i, app := range decoded.apps {
+		al.apps[app.Metadata.Name] = app
+		al.nodes[app.Metadata.Name] = decoded.nodes[i]
+	}
+	for _, metadata := range decoded.metadata {
+		if al.metadata != nil {
+			al.logger.Warn().Str("file", decoded.fileName).Msg("more than one metadata entity, the last one is used")
+		}
+		al.metadata = metadata
+	}
+	al.entities = append(al.entities, decoded.entities...)
+	return nil
+}
+
+// application returns the application with the resources added. It fails in strict mode if there are no OAM
+// applications.
+func (al *applicationLoader) application() (*Application, error) {
+	// a catalog application might not contain oam application.
+	// For example, if a user wants to store their component definitions
+	if len(al.apps) == 0 {
+		if al.options.strict {
+			return nil, nerrors.NewInvalidArgumentError("cannot create application, no application received")
+		}
+		al.logger.Warn().Msg("Error creating application, no application received")
+	}
+
+	al.logger.Debug().Int("apps", len(al.apps)).Int("entities", len(al.entities)).Msg("Apps configuration")
+
+	metadata := make(map[string][]*ParameterMetadata, 0)
+	for appName, node := range al.nodes {
+		metadata[appName] = getParametersMetadata(node, al.logger)
+		if al.options.dropComments {
+			removeYAMLComments(&node.Spec.Components)
+		}
+	}
+
+	return &Application{
+		apps:               al.apps,
+		entities:           al.entities,
+		componentsYAML:     al.nodes,
+		metadata:           al.metadata,
+		parametersMetadata: metadata,
+		logger:             al.logger,
+	}, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// largePackage returns the files of a catalog application with the number of files received, each one with
+// an OAM application and the number of entities received
+func largePackage(files int, entitiesPerFile int) []*ApplicationFile {
+	result := make([]*ApplicationFile, 0, files)
+	for i := 0; i < files; i++ {
+		var content strings.Builder
+		content.WriteString(strings.Replace(applicationFile, "name: application", fmt.Sprintf("name: application-%d", i), 1))
+		for j := 0; j < entitiesPerFile; j++ {
+			content.WriteString("---")
+			content.WriteString(strings.Replace(cm, "name: cm-test", fmt.Sprintf("name: cm-%d-%d", i, j), 1))
+		}
+		result = append(result, &ApplicationFile{FileName: fmt.Sprintf("app-%d.yaml", i), Content: []byte(content.String())})
+	}
+	return result
+}
+
+var _ = ginkgo.Describe("Loader tests", func() {
+
+	ginkgo.It("Should be able to split YAML files", func() {
+		documents, err := splitYAMLFile([]byte("---\na: 1\n--- # comment\n\n---\nb: 2\n---\n"))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(documents).Should(gomega.Equal([][]byte{[]byte("a: 1"), []byte("b: 2")}))
+		gomega.Expect(cap(documents[0])).Should(gomega.Equal(len(documents[0])))
+
+		documents, err = splitYAMLFile([]byte(applicationFile))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(documents).Should(gomega.HaveLen(2))
+		gomega.Expect(string(documents[1])).Should(gomega.HavePrefix("apiVersion: core.oam.dev/v1beta1"))
+	})
+
+	ginkgo.It("Should load the same application in parallel", func() {
+		files := largePackage(20, 5)
+		sequential, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		parallel, err := NewApplicationWithWorkers(files, 4)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		gomega.Expect(parallel.GetNames()).Should(gomega.HaveLen(20))
+		gomega.Expect(parallel.entities).Should(gomega.HaveLen(120))
+		gomega.Expect(parallel.entities).Should(gomega.Equal(sequential.entities))
+		digest, err := sequential.Digest()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parallel.Digest()).Should(gomega.Equal(digest))
+
+		files = append(files, &ApplicationFile{FileName: "invalid.yaml", Content: []byte("name: without-gvk")})
+		_, err = NewApplicationWithWorkers(files, 4)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should stop reading the files after the first decode error", func() {
+		files := append([]*ApplicationFile{{FileName: "invalid.yaml", Content: []byte("name: without-gvk")}}, largePackage(1000, 1)...)
+		source := sliceFileSource(files)
+		read := 0
+		counted := func() (*ApplicationFile, error) {
+			read++
+			return source()
+		}
+		_, err := loadApplication(context.Background(), counted, 4, newLoadOptions(nil))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("invalid.yaml"))
+		gomega.Expect(read).Should(gomega.BeNumerically("<", len(files)))
+	})
+
+	ginkgo.It("Should be able to load a tgz stream", func() {
+		raw, err := writeTGZ(append(largePackage(10, 2), &ApplicationFile{FileName: "README.md", Content: []byte(readme)}))
+		gomega.Expect(err).Should(gomega.Succeed())
+		expected, err := NewApplicationFromTGZ(raw)
+		gomega.Expect(err).Should(gomega.Succeed())
+		digest, err := expected.Digest()
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		for _, workers := range []int{1, 3} {
+			app, err := NewApplicationFromTGZReader(bytes.NewReader(raw), workers)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(app.GetNames()).Should(gomega.HaveLen(10))
+			gomega.Expect(app.Digest()).Should(gomega.Equal(digest))
+		}
+
+		_, err = NewApplicationFromTGZReader(bytes.NewReader(raw[:len(raw)/2]), 3)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
+
+// benchmarkLoad measures the time to load a package with thousands of resources
+func benchmarkLoad(b *testing.B, workers int) {
+	raw, err := writeTGZ(largePackage(100, 30))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewApplicationFromTGZReader(bytes.NewReader(raw), workers); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadSequential(b *testing.B) {
+	benchmarkLoad(b, 1)
+}
+
+func BenchmarkLoadParallel(b *testing.B) {
+	benchmarkLoad(b, 8)
+}
+
+func BenchmarkSplitYAMLFile(b *testing.B) {
+	file := largePackage(1, 5000)[0].Content
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := splitYAMLFile(file); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// jsonExtension with the extension of the JSON files
+	jsonExtension = ".json"
+	// listKind with the kind of the Kubernetes lists (v1 List) whose items are loaded as documents
+	listKind = "List"
+)
+
+// utf8BOM with the byte order mark that some editors add at the beginning of the files
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// splitManifestFile returns the documents of a YAML or JSON file (by extension). The byte order marks are
+// removed and the CRLF line endings are converted to LF. A JSON file can contain an object, an array of objects
+// or several concatenated objects. The values that are not Kubernetes objects (without apiVersion and kind, e.g.
+// a package.json file) are skipped, and return an InvalidArgument error in strict mode.
+func splitManifestFile(fileName string, content []byte, options *loadOptions) ([][]byte, error) {
+	content = normalizeLineEndings(bytes.TrimPrefix(content, utf8BOM))
+	if hasExtension(fileName, []string{jsonExtension}) {
+		return splitJSONFile(fileName, content, options)
+	}
+	documents, err := splitYAMLFile(content)
+	if err != nil {
+		return nil, err
+	}
+	for i, document := range documents {
+		// concatenated files might include the byte order mark of each file
+		documents[i] = bytes.TrimPrefix(document, utf8BOM)
+	}
+	return documents, nil
+}
+
+// normalizeLineEndings converts the CRLF line endings to LF. The content is only copied if it contains CRLF.
+func normalizeLineEndings(content []byte) []byte {
+	if !bytes.Contains(content, []byte("\r\n")) {
+		return content
+	}
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// splitJSONFile returns the Kubernetes objects stored in a JSON file
+func splitJSONFile(fileName string, content []byte, options *loadOptions) ([][]byte, error) {
+	documents := make([][]byte, 0)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			return documents, nil
+		} else if err != nil {
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid JSON file: %s", err.Error())
+		}
+		values := []json.RawMessage{value}
+		if trimmed := bytes.TrimSpace(value); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(value, &values); err != nil {
+				return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid JSON file: %s", err.Error())
+			}
+		}
+		for _, object := range values {
+			if !isKubernetesObject(object) {
+				if options.strict {
+					return nil, nerrors.NewInvalidArgumentError("invalid JSON file: %s is not a Kubernetes object", firstLine(string(bytes.TrimSpace(object))))
+				}
+				options.getLogger().Debug().Str("file", fileName).Msg("skipping a JSON value that is not a Kubernetes object")
+				continue
+			}
+			documents = append(documents, object)
+		}
+	}
+}
+
+// isKubernetesObject checks if a JSON value is an object with apiVersion and kind
+func isKubernetesObject(value json.RawMessage) bool {
+	var typeMeta struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}
+	if err := json.Unmarshal(value, &typeMeta); err != nil {
+		return false
+	}
+	return typeMeta.APIVersion != "" && typeMeta.Kind != ""
+}
+
+// isListKind checks if a Group Version Kind is a Kubernetes list (v1 List)
+func isListKind(gvk *schema.GroupVersionKind) bool {
+	return gvk.Group == "" && gvk.Kind == listKind
+}
+
+// getListItems returns the items of a Kubernetes list as JSON documents
+func getListItems(list *unstructured.Unstructured) ([][]byte, error) {
+	items, _, err := unstructured.NestedSlice(list.Object, "items")
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid list %s: %s", list.GetName(), err.Error())
+	}
+	documents := make([][]byte, 0, len(items))
+	for _, item := range items {
+		document, err := json.Marshal(item)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading the items of a list")
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const configMapList = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: first
+- apiVersion: v1
+  kind: List
+  items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: nested
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: second
+`
+
+const jsonEntities = `[
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "from-array"}},
+  {"apiVersion": "v1", "kind": "List", "items": [{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "from-list"}}]}
+]
+{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "concatenated"}}
+`
+
+// entityNames returns the names of the entities of an application
+func entityNames(app *Application) []string {
+	names := make([]string, 0, len(app.entities))
+	for _, entity := range app.entities {
+		_, obj, err := getGVK(entity)
+		gomega.Expect(err).Should(gomega.Succeed())
+		names = append(names, obj.GetName())
+	}
+	return names
+}
+
+var _ = ginkgo.Describe("Manifest formats tests", func() {
+
+	ginkgo.It("Should load JSON files", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.json", Content: []byte(jsonApplication)},
+			{FileName: "entities.json", Content: []byte(jsonEntities)},
+			{FileName: SignatureFile, Content: []byte(`{"digest": "sha256:0123"}`)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("json-app"))
+		gomega.Expect(entityNames(app)).Should(gomega.Equal([]string{"from-array", "from-list", "concatenated"}))
+
+		parameters, err := app.GetParameters()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parameters["json-app"]).Should(gomega.ContainSubstring("nginx:1.21.0"))
+
+		_, err = NewApplication([]*ApplicationFile{{FileName: "invalid.json", Content: []byte(`{"apiVersion": `)}})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		withPackage := []*ApplicationFile{
+			{FileName: "app.json", Content: []byte(jsonApplication)},
+			{FileName: "package.json", Content: []byte(`{"name": "catalog"}`)},
+			{FileName: "values.schema.json", Content: []byte(`{"$schema": "https://json-schema.org/draft-07/schema#"}`)},
+		}
+		app, err = NewApplication(withPackage)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("json-app"))
+
+		_, err = NewApplication(withPackage, WithStrictMode(true))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+
+	ginkgo.It("Should expand the items of the lists", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(applicationFile)},
+			{FileName: "list.yaml", Content: []byte(configMapList + "---" + cm)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entityNames(app)).Should(gomega.Equal([]string{"cm-test", "first", "nested", "second", "cm-test"}))
+
+		_, err = NewApplication([]*ApplicationFile{{FileName: "list.yaml", Content: []byte(configMapList)}}, WithMaxDocuments(2))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		imported, err := NewApplicationFromManifests("imported", []*ApplicationFile{
+			{FileName: "list.yaml", Content: []byte("apiVersion: v1\nkind: List\nitems:\n" + indentYAML(workerDeployment, "- ", "  "))}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(imported.entities).Should(gomega.BeEmpty())
+		gomega.Expect(imported.GetNames()).Should(gomega.HaveKey("imported"))
+	})
+
+	ginkgo.It("Should load files with byte order marks and CRLF line endings", func() {
+		expected, err := NewApplication([]*ApplicationFile{{FileName: "app.yaml", Content: []byte(annotatedApplication + "---" + cm)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		digest, err := expected.Digest()
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		windows := "\xef\xbb\xbf" + strings.ReplaceAll(annotatedApplication+"---\n\xef\xbb\xbf"+cm, "\n", "\r\n")
+		app, err := NewApplication([]*ApplicationFile{{FileName: "app.yaml", Content: []byte(windows)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.Digest()).Should(gomega.Equal(digest))
+		gomega.Expect(app.GetParametersMetadata()).Should(gomega.Equal(expected.GetParametersMetadata()))
+		gomega.Expect(string(app.entities[0])).ShouldNot(gomega.ContainSubstring("\r"))
+
+		app, err = NewApplication([]*ApplicationFile{{FileName: "app.json", Content: []byte("\xef\xbb\xbf" + strings.ReplaceAll(jsonApplication, "\n", "\r\n"))}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("json-app"))
+	})
+})
+
+// indentYAML indents a YAML document to include it as an item of a sequence
+func indentYAML(document string, first string, rest string) string {
+	lines := strings.Split(strings.Trim(document, "\n"), "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = first + line
+		} else {
+			lines[i] = rest + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
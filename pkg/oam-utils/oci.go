@@ -0,0 +1,371 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+const (
+	// OCIArtifactType with the artifact type of the catalog applications
+	OCIArtifactType = "application/vnd.napptive.catalog.application.v1"
+	// OCIConfigMediaType with the media type of the config blob (the application metadata in JSON)
+	OCIConfigMediaType = "application/vnd.napptive.catalog.config.v1+json"
+	// OCILayerMediaType with the media type of the layer that contains the application tgz file
+	OCILayerMediaType = "application/vnd.napptive.catalog.layer.v1.tar+gzip"
+	// DefaultOCIReference with the reference used if the application does not have a version
+	DefaultOCIReference = "latest"
+)
+
+const (
+	// ociLayoutVersion with the version of the OCI image layout
+	ociLayoutVersion = "1.0.0"
+	// ociLayoutFile with the name of the file that identifies an OCI image layout
+	ociLayoutFile = "oci-layout"
+	// ociIndexFile with the name of the index of an OCI image layout
+	ociIndexFile = "index.json"
+	// ociBlobsDirectory with the directory that contains the blobs of an OCI image layout
+	ociBlobsDirectory = "blobs"
+	// ociManifestMediaType with the media type of an OCI image manifest
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// ociIndexMediaType with the media type of an OCI image index
+	ociIndexMediaType = "application/vnd.oci.image.index.v1+json"
+	// ociRefNameAnnotation with the annotation that contains the reference of a manifest in the index
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+	// ociTitleAnnotation with the annotation that contains the title of the artifact
+	ociTitleAnnotation = "org.opencontainers.image.title"
+	// ociVersionAnnotation with the annotation that contains the version of the artifact
+	ociVersionAnnotation = "org.opencontainers.image.version"
+	// ociDescriptionAnnotation with the annotation that contains the description of the artifact
+	ociDescriptionAnnotation = "org.opencontainers.image.description"
+)
+
+// ociDigestRegex matches the digests supported in the blobs of the layout
+var ociDigestRegex = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// OCIDescriptor with the reference to a blob of an OCI image layout
+type OCIDescriptor struct {
+	// MediaType of the blob
+	MediaType string `json:"mediaType"`
+	// ArtifactType of the manifest
+	ArtifactType string `json:"artifactType,omitempty"`
+	// Digest of the blob
+	Digest string `json:"digest"`
+	// Size of the blob in bytes
+	Size int64 `json:"size"`
+	// Annotations of the blob
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest with an OCI image manifest
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        OCIDescriptor     `json:"config"`
+	Layers        []OCIDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ociIndex with an OCI image index
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []OCIDescriptor `json:"manifests"`
+}
+
+// ociLayout with the content of the oci-layout file
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+// ociBlob with the content of a blob and its descriptor
+type ociBlob struct {
+	descriptor OCIDescriptor
+	content    []byte
+}
+
+// ociArtifact with the blobs of an application stored as an OCI artifact
+type ociArtifact struct {
+	// reference with the tag of the manifest
+	reference string
+	// config with the metadata of the application in JSON
+	config *ociBlob
+	// layer with the application tgz file
+	layer *ociBlob
+	// manifest referencing the config and the layer
+	manifest *ociBlob
+}
+
+// ToOCILayout stores the application as an OCI artifact in an OCI image layout directory. The application tgz
+// file is stored as the only layer and the metadata (in JSON) as the config blob. The manifest is tagged with the
+// reference received or, if it is empty, with the version of the application (DefaultOCIReference if the
+// application does not have version). Other manifests of the layout are kept, except the one with the same reference.
+func (a *Application) ToOCILayout(directory string, reference string) (*OCIDescriptor, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	artifact, err := a.newOCIArtifact(reference)
+	if err != nil {
+		return nil, err
+	}
+	for _, blob := range []*ociBlob{artifact.config, artifact.layer, artifact.manifest} {
+		if err := writeOCIBlob(directory, blob); err != nil {
+			return nil, err
+		}
+	}
+	manifestDescriptor := artifact.manifest.descriptor
+	manifestDescriptor.ArtifactType = OCIArtifactType
+	manifestDescriptor.Annotations = map[string]string{ociRefNameAnnotation: artifact.reference}
+
+	index := &ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType}
+	if _, err := os.Stat(filepath.Join(directory, ociIndexFile)); err == nil {
+		if index, err = readOCIIndex(directory); err != nil {
+			return nil, err
+		}
+	}
+	manifests := make([]OCIDescriptor, 0, len(index.Manifests)+1)
+	for _, descriptor := range index.Manifests {
+		if descriptor.Annotations[ociRefNameAnnotation] != artifact.reference {
+			manifests = append(manifests, descriptor)
+		}
+	}
+	index.Manifests = append(manifests, manifestDescriptor)
+
+	if err := writeOCIJSON(filepath.Join(directory, ociIndexFile), index); err != nil {
+		return nil, err
+	}
+	if err := writeOCIJSON(filepath.Join(directory, ociLayoutFile), &ociLayout{ImageLayoutVersion: ociLayoutVersion}); err != nil {
+		return nil, err
+	}
+	return &manifestDescriptor, nil
+}
+
+// NewApplicationFromOCILayout loads the application stored with a reference in an OCI image layout directory.
+// If the reference is empty, the layout must contain only one manifest. The digests of the blobs are verified.
+func NewApplicationFromOCILayout(directory string, reference string, opts ...LoadOption) (*Application, error) {
+	index, err := readOCIIndex(directory)
+	if err != nil {
+		return nil, err
+	}
+	var manifestDescriptor *OCIDescriptor
+	if reference == "" {
+		if len(index.Manifests) != 1 {
+			return nil, nerrors.NewInvalidArgumentError("the OCI layout contains %d manifests, a reference is required", len(index.Manifests))
+		}
+		manifestDescriptor = &index.Manifests[0]
+	}
+	for i, descriptor := range index.Manifests {
+		if reference != "" && descriptor.Annotations[ociRefNameAnnotation] == reference {
+			manifestDescriptor = &index.Manifests[i]
+		}
+	}
+	if manifestDescriptor == nil {
+		return nil, nerrors.NewNotFoundError("application %s not found in the OCI layout", reference)
+	}
+
+	rawManifest, err := readOCIBlob(directory, manifestDescriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+	return loadOCIManifest(rawManifest, func(descriptor *OCIDescriptor) ([]byte, error) {
+		return readOCIBlob(directory, descriptor.Digest)
+	}, opts)
+}
+
+// newOCIArtifact returns the blobs of the application stored as an OCI artifact. If the reference is empty, the
+// version of the application is used (DefaultOCIReference if the application does not have version).
+func (a *Application) newOCIArtifact(reference string) (*ociArtifact, error) {
+	metadata, err := a.getOCIMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if reference == "" {
+		reference = metadata.Version
+	}
+	if reference == "" {
+		reference = DefaultOCIReference
+	}
+
+	config, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating the OCI config")
+	}
+	layer, err := a.toTGZ()
+	if err != nil {
+		return nil, err
+	}
+	artifact := &ociArtifact{
+		reference: reference,
+		config:    newOCIBlob(OCIConfigMediaType, config),
+		layer:     newOCIBlob(OCILayerMediaType, layer),
+	}
+	artifact.layer.descriptor.Annotations = map[string]string{ociTitleAnnotation: fmt.Sprintf("%s.tgz", metadata.Name)}
+
+	annotations := map[string]string{ociTitleAnnotation: metadata.Name}
+	if metadata.Version != "" {
+		annotations[ociVersionAnnotation] = metadata.Version
+	}
+	if metadata.Description != "" {
+		annotations[ociDescriptionAnnotation] = metadata.Description
+	}
+	manifest, err := json.Marshal(&ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  OCIArtifactType,
+		Config:        artifact.config.descriptor,
+		Layers:        []OCIDescriptor{artifact.layer.descriptor},
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating the OCI manifest")
+	}
+	artifact.manifest = newOCIBlob(ociManifestMediaType, manifest)
+	return artifact, nil
+}
+
+// loadOCIManifest loads the application stored in the layer of an OCI manifest. The blobs are read with the
+// function received, that must verify their digests.
+func loadOCIManifest(rawManifest []byte, readBlob func(descriptor *OCIDescriptor) ([]byte, error), opts []LoadOption) (*Application, error) {
+	var manifest ociManifest
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return nil, nerrors.NewInvalidArgumentError("invalid OCI manifest: %s", err.Error())
+	}
+	if manifest.ArtifactType != OCIArtifactType && manifest.Config.MediaType != OCIConfigMediaType {
+		return nil, nerrors.NewInvalidArgumentError("the OCI artifact is not a catalog application")
+	}
+	for i, layer := range manifest.Layers {
+		if layer.MediaType != OCILayerMediaType {
+			continue
+		}
+		rawApplication, err := readBlob(&manifest.Layers[i])
+		if err != nil {
+			return nil, err
+		}
+		return NewApplicationFromTGZ(rawApplication, opts...)
+	}
+	return nil, nerrors.NewInvalidArgumentError("the OCI artifact does not contain the application layer")
+}
+
+// getOCIMetadata returns the metadata stored in the OCI config blob. Applications without metadata use the
+// names of their OAM applications.
+func (a *Application) getOCIMetadata() (*ApplicationMetadata, error) {
+	if a.metadata != nil {
+		return a.getMetadata()
+	}
+	names := make([]string, 0, len(a.apps))
+	for _, app := range a.apps {
+		names = append(names, app.Metadata.Name)
+	}
+	sort.Strings(names)
+	return &ApplicationMetadata{
+		ApiVersion: metadataGKV[0].GroupVersion().String(),
+		Kind:       metadataGKV[0].Kind,
+		Name:       strings.Join(names, "-"),
+	}, nil
+}
+
+// newOCIBlob returns a blob with its descriptor
+func newOCIBlob(mediaType string, content []byte) *ociBlob {
+	hash := sha256.Sum256(content)
+	return &ociBlob{
+		descriptor: OCIDescriptor{
+			MediaType: mediaType,
+			Digest:    fmt.Sprintf("%s:%s", digestAlgorithm, hex.EncodeToString(hash[:])),
+			Size:      int64(len(content)),
+		},
+		content: content,
+	}
+}
+
+// writeOCIBlob stores a blob in the layout
+func writeOCIBlob(directory string, blob *ociBlob) error {
+	blobsDirectory := filepath.Join(directory, ociBlobsDirectory, digestAlgorithm)
+	if err := os.MkdirAll(blobsDirectory, 0755); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error creating the OCI layout")
+	}
+	encoded := strings.TrimPrefix(blob.descriptor.Digest, digestAlgorithm+":")
+	if err := os.WriteFile(filepath.Join(blobsDirectory, encoded), blob.content, 0644); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error writing OCI blob")
+	}
+	return nil
+}
+
+// readOCIBlob returns the content of a blob of the layout checking its digest
+func readOCIBlob(directory string, digest string) ([]byte, error) {
+	if !ociDigestRegex.MatchString(digest) {
+		return nil, nerrors.NewInvalidArgumentError("unsupported OCI digest %s", digest)
+	}
+	encoded := strings.TrimPrefix(digest, digestAlgorithm+":")
+	content, err := os.ReadFile(filepath.Join(directory, ociBlobsDirectory, digestAlgorithm, encoded))
+	if err != nil {
+		return nil, nerrors.NewNotFoundErrorFrom(err, "OCI blob %s not found", digest)
+	}
+	if err := verifyOCIBlob(digest, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// verifyOCIBlob checks that the content of a blob matches its digest
+func verifyOCIBlob(digest string, content []byte) error {
+	if !ociDigestRegex.MatchString(digest) {
+		return nerrors.NewInvalidArgumentError("unsupported OCI digest %s", digest)
+	}
+	hash := sha256.Sum256(content)
+	if hex.EncodeToString(hash[:]) != strings.TrimPrefix(digest, digestAlgorithm+":") {
+		return nerrors.NewDataLossError("the content of the OCI blob %s does not match its digest", digest)
+	}
+	return nil
+}
+
+// readOCIIndex returns the index of a layout
+func readOCIIndex(directory string) (*ociIndex, error) {
+	content, err := os.ReadFile(filepath.Join(directory, ociIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nerrors.NewNotFoundError("OCI index not found in %s", directory)
+		}
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading the OCI index")
+	}
+	var index ociIndex
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, nerrors.NewInvalidArgumentError("invalid OCI index: %s", err.Error())
+	}
+	return &index, nil
+}
+
+// writeOCIJSON stores a JSON file of the layout
+func writeOCIJSON(path string, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error writing %s", filepath.Base(path))
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error writing %s", filepath.Base(path))
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// ociMaxManifestSize with the maximum size of the manifests read from a registry
+const ociMaxManifestSize = 4 * 1024 * 1024
+
+var (
+	// ociRepositoryRegex matches the repository names of the OCI distribution specification
+	ociRepositoryRegex = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	// ociTagRegex matches the tags of the OCI distribution specification
+	ociTagRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+// OCIRegistry with a registry that implements the OCI distribution API, used to push and pull the applications
+// stored as OCI artifacts.
+type OCIRegistry struct {
+	// URL of the registry (e.g. https://registry.example.com)
+	URL string
+	// Client used to send the requests (nil to use http.DefaultClient). The authentication is delegated to the
+	// transport of the client.
+	Client *http.Client
+}
+
+// ToOCIRegistry pushes the application as an OCI artifact to a repository of a registry. The artifact is the one
+// stored by ToOCILayout and the manifest is tagged with the same reference. The blobs that already exist in the
+// repository are not uploaded again.
+func (a *Application) ToOCIRegistry(registry *OCIRegistry, repository string, reference string) (*OCIDescriptor, error) {
+	return a.ToOCIRegistryContext(context.Background(), registry, repository, reference)
+}
+
+// ToOCIRegistryContext is ToOCIRegistry with a context. The requests are canceled when the context is done.
+func (a *Application) ToOCIRegistryContext(ctx context.Context, registry *OCIRegistry, repository string, reference string) (*OCIDescriptor, error) {
+	if !ociRepositoryRegex.MatchString(repository) {
+		return nil, nerrors.NewInvalidArgumentError("invalid OCI repository %s", repository)
+	}
+	if reference != "" && !ociTagRegex.MatchString(reference) {
+		return nil, nerrors.NewInvalidArgumentError("invalid OCI tag %s", reference)
+	}
+	a.mutex.RLock()
+	artifact, err := a.newOCIArtifact(reference)
+	a.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	for _, blob := range []*ociBlob{artifact.config, artifact.layer} {
+		if err := registry.pushBlob(ctx, repository, blob); err != nil {
+			return nil, err
+		}
+	}
+	manifestURL, err := registry.getURL(fmt.Sprintf("/v2/%s/manifests/%s", repository, artifact.reference))
+	if err != nil {
+		return nil, err
+	}
+	response, err := registry.send(ctx, http.MethodPut, manifestURL, ociManifestMediaType, artifact.manifest.content)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		return nil, getOCIRegistryError(response, "error pushing the OCI manifest")
+	}
+	manifestDescriptor := artifact.manifest.descriptor
+	manifestDescriptor.ArtifactType = OCIArtifactType
+	manifestDescriptor.Annotations = map[string]string{ociRefNameAnnotation: artifact.reference}
+	return &manifestDescriptor, nil
+}
+
+// NewApplicationFromOCIRegistry pulls the application stored with a reference (a tag or a digest) in a repository
+// of a registry. The digests of the blobs are verified.
+func NewApplicationFromOCIRegistry(registry *OCIRegistry, repository string, reference string, opts ...LoadOption) (*Application, error) {
+	return NewApplicationFromOCIRegistryContext(context.Background(), registry, repository, reference, opts...)
+}
+
+// NewApplicationFromOCIRegistryContext is NewApplicationFromOCIRegistry with a context. The requests are canceled
+// when the context is done.
+func NewApplicationFromOCIRegistryContext(ctx context.Context, registry *OCIRegistry, repository string, reference string, opts ...LoadOption) (*Application, error) {
+	if !ociRepositoryRegex.MatchString(repository) {
+		return nil, nerrors.NewInvalidArgumentError("invalid OCI repository %s", repository)
+	}
+	if !ociTagRegex.MatchString(reference) && !ociDigestRegex.MatchString(reference) {
+		return nil, nerrors.NewInvalidArgumentError("invalid OCI reference %s", reference)
+	}
+	manifestURL, err := registry.getURL(fmt.Sprintf("/v2/%s/manifests/%s", repository, reference))
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, err := registry.get(ctx, manifestURL, ociManifestMediaType, ociMaxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	if ociDigestRegex.MatchString(reference) {
+		if err := verifyOCIBlob(reference, rawManifest); err != nil {
+			return nil, err
+		}
+	}
+	return loadOCIManifest(rawManifest, func(descriptor *OCIDescriptor) ([]byte, error) {
+		if !ociDigestRegex.MatchString(descriptor.Digest) {
+			return nil, nerrors.NewInvalidArgumentError("unsupported OCI digest %s", descriptor.Digest)
+		}
+		blobURL, err := registry.getURL(fmt.Sprintf("/v2/%s/blobs/%s", repository, descriptor.Digest))
+		if err != nil {
+			return nil, err
+		}
+		content, err := registry.get(ctx, blobURL, "", descriptor.Size)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyOCIBlob(descriptor.Digest, content); err != nil {
+			return nil, err
+		}
+		return content, nil
+	}, opts)
+}
+
+// pushBlob uploads a blob to a repository (monolithic upload) if the repository does not contain it
+func (r *OCIRegistry) pushBlob(ctx context.Context, repository string, blob *ociBlob) error {
+	blobURL, err := r.getURL(fmt.Sprintf("/v2/%s/blobs/%s", repository, blob.descriptor.Digest))
+	if err != nil {
+		return err
+	}
+	response, err := r.send(ctx, http.MethodHead, blobURL, "", nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	uploadURL, err := r.getURL(fmt.Sprintf("/v2/%s/blobs/uploads/", repository))
+	if err != nil {
+		return err
+	}
+	response, err = r.send(ctx, http.MethodPost, uploadURL, "", nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusAccepted {
+		return getOCIRegistryError(response, "error pushing the OCI blob %s", blob.descriptor.Digest)
+	}
+	location, err := response.Location()
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error pushing the OCI blob %s, invalid upload location", blob.descriptor.Digest)
+	}
+	query := location.Query()
+	query.Set("digest", blob.descriptor.Digest)
+	location.RawQuery = query.Encode()
+	response, err = r.send(ctx, http.MethodPut, location.String(), "application/octet-stream", blob.content)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		return getOCIRegistryError(response, "error pushing the OCI blob %s", blob.descriptor.Digest)
+	}
+	return nil
+}
+
+// get returns the content of a manifest or a blob of the registry. The content larger than the maximum size
+// received returns a ResourceExhausted error.
+func (r *OCIRegistry) get(ctx context.Context, target string, accept string, maxSize int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid OCI registry request")
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	response, err := r.getClient().Do(request)
+	if err != nil {
+		return nil, getOCIRequestError(ctx, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, getOCIRegistryError(response, "error pulling %s", request.URL.Path)
+	}
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, getOCIRequestError(ctx, err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, nerrors.NewResourceExhaustedError("%s is larger than %d bytes", request.URL.Path, maxSize)
+	}
+	return content, nil
+}
+
+// send sends a request to the registry. The caller must close the body of the response.
+func (r *OCIRegistry) send(ctx context.Context, method string, target string, contentType string, content []byte) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(content))
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid OCI registry request")
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	response, err := r.getClient().Do(request)
+	if err != nil {
+		return nil, getOCIRequestError(ctx, err)
+	}
+	return response, nil
+}
+
+// getURL returns the URL of a path of the registry API
+func (r *OCIRegistry) getURL(path string) (string, error) {
+	base, err := url.Parse(r.URL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return "", nerrors.NewInvalidArgumentError("invalid OCI registry URL %s", r.URL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + path
+	return base.String(), nil
+}
+
+// getClient returns the HTTP client of the registry
+func (r *OCIRegistry) getClient() *http.Client {
+	if r.Client == nil {
+		return http.DefaultClient
+	}
+	return r.Client
+}
+
+// getOCIRequestError returns the error of a request that could not be completed
+func getOCIRequestError(ctx context.Context, err error) error {
+	if ctxErr := checkContext(ctx); ctxErr != nil {
+		return ctxErr
+	}
+	return nerrors.NewUnavailableErrorFrom(err, "error connecting to the OCI registry")
+}
+
+// getOCIRegistryError returns the error of an unexpected response of the registry
+func getOCIRegistryError(response *http.Response, format string, a ...interface{}) error {
+	message := fmt.Sprintf("%s: %s", fmt.Sprintf(format, a...), response.Status)
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return nerrors.NewNotFoundError("%s", message)
+	case http.StatusUnauthorized:
+		return nerrors.NewUnauthenticatedError("%s", message)
+	case http.StatusForbidden:
+		return nerrors.NewPermissionDeniedError("%s", message)
+	case http.StatusBadRequest:
+		return nerrors.NewInvalidArgumentError("%s", message)
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return nerrors.NewUnavailableError("%s", message)
+	default:
+		return nerrors.NewInternalError("%s", message)
+	}
+}
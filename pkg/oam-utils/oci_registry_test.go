@@ -0,0 +1,177 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// testRegistry with an in-memory registry that implements the subset of the OCI distribution API used to push
+// and pull the applications
+type testRegistry struct {
+	sync.Mutex
+	// blobs indexed by digest
+	blobs map[string][]byte
+	// manifests indexed by repository and reference (tag and digest)
+	manifests map[string][]byte
+	// uploads with the number of blobs uploaded
+	uploads int
+}
+
+// newTestRegistry returns an empty registry
+func newTestRegistry() *testRegistry {
+	return &testRegistry{blobs: make(map[string][]byte, 0), manifests: make(map[string][]byte, 0)}
+}
+
+// ServeHTTP serves the requests of the OCI distribution API
+func (tr *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tr.Lock()
+	defer tr.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case strings.HasSuffix(path, "/blobs/uploads/") && r.Method == http.MethodPost:
+		w.Header().Set("Location", fmt.Sprintf("/v2/%suuid?state=1", path))
+		w.WriteHeader(http.StatusAccepted)
+	case strings.Contains(path, "/blobs/uploads/") && r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		digest := r.URL.Query().Get("digest")
+		if r.URL.Query().Get("state") != "1" || verifyOCIBlob(digest, content) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tr.blobs[digest] = content
+		tr.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		content, found := tr.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	case strings.Contains(path, "/manifests/") && r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != ociManifestMediaType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		repository := path[:strings.Index(path, "/manifests/")]
+		tr.manifests[path] = content
+		tr.manifests[fmt.Sprintf("%s/manifests/%s", repository, newOCIBlob(ociManifestMediaType, content).descriptor.Digest)] = content
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/manifests/") && r.Method == http.MethodGet:
+		content, found := tr.manifests[path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ociManifestMediaType)
+		_, _ = w.Write(content)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+var _ = ginkgo.Describe("OCI registry tests", func() {
+
+	var registry *testRegistry
+	var server *httptest.Server
+
+	ginkgo.BeforeEach(func() {
+		registry = newTestRegistry()
+		server = httptest.NewServer(registry)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.It("Should be able to push and pull an application", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(completeMetadata), []byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		target := &OCIRegistry{URL: server.URL, Client: server.Client()}
+
+		descriptor, err := app.ToOCIRegistry(target, "catalog/nginx", "")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(descriptor.Annotations[ociRefNameAnnotation]).Should(gomega.Equal("1.2.0"))
+		gomega.Expect(registry.uploads).Should(gomega.Equal(2))
+
+		// the existing blobs are not uploaded again
+		_, err = app.ToOCIRegistry(target, "catalog/nginx", "stable")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(registry.uploads).Should(gomega.Equal(2))
+
+		digest, err := app.Digest()
+		gomega.Expect(err).Should(gomega.Succeed())
+		for _, reference := range []string{"1.2.0", "stable", descriptor.Digest} {
+			loaded, err := NewApplicationFromOCIRegistry(target, "catalog/nginx", reference)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(loaded.GetNames()).Should(gomega.HaveKey("application"))
+			gomega.Expect(loaded.Digest()).Should(gomega.Equal(digest))
+		}
+	})
+
+	ginkgo.It("Should fail if the reference does not exist or is not valid", func() {
+		target := &OCIRegistry{URL: server.URL, Client: server.Client()}
+		_, err := NewApplicationFromOCIRegistry(target, "catalog/nginx", "missing")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+
+		_, err = NewApplicationFromOCIRegistry(target, "catalog/nginx", "")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+		_, err = NewApplicationFromOCIRegistry(target, "../nginx", "latest")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+
+	ginkgo.It("Should fail if a blob does not match its digest", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		target := &OCIRegistry{URL: server.URL, Client: server.Client()}
+		_, err = app.ToOCIRegistry(target, "catalog/nginx", "")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		for digest, content := range registry.blobs {
+			registry.blobs[digest] = append([]byte("modified"), content[len("modified"):]...)
+		}
+		_, err = NewApplicationFromOCIRegistry(target, "catalog/nginx", DefaultOCIReference)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should stop when the context is canceled", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = app.ToOCIRegistryContext(ctx, &OCIRegistry{URL: server.URL, Client: server.Client()}, "catalog/nginx", "")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Canceled))
+	})
+})
@@ -0,0 +1,175 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const completeMetadata = `
+apiVersion: core.napptive.com/v1alpha1
+kind: ApplicationMetadata
+name: "Nginx"
+version: 1.2.0
+description: Customized version of nginx
+keywords:
+  - "web"
+license: "Apache License Version 2.0"
+url: "https://nginx.org"
+requires:
+  traits:
+    - scaler
+logo:
+  - src: "https://nginx.org/logo.png"
+    type: "image/png"
+    size: "120x120"
+`
+
+var _ = ginkgo.Describe("OCI tests", func() {
+
+	var dir string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "oci")
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	ginkgo.It("Should keep the application metadata", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(completeMetadata), []byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		metadata, err := app.GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Name).Should(gomega.Equal("Nginx"))
+		gomega.Expect(metadata.Version).Should(gomega.Equal("1.2.0"))
+		gomega.Expect(metadata.Requires.Traits).Should(gomega.Equal([]string{"scaler"}))
+		gomega.Expect(metadata.Logo[0].Size).Should(gomega.Equal("120x120"))
+
+		raw, err := app.ToTGZ()
+		gomega.Expect(err).Should(gomega.Succeed())
+		loaded, err := NewApplicationFromTGZ(raw)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(loaded.GetMetadata()).Should(gomega.Equal(metadata))
+
+		withoutMetadata, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = withoutMetadata.GetMetadata()
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to store and load an application in an OCI layout", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(completeMetadata), []byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		descriptor, err := app.ToOCILayout(dir, "")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(descriptor.Annotations[ociRefNameAnnotation]).Should(gomega.Equal("1.2.0"))
+		gomega.Expect(filepath.Join(dir, ociLayoutFile)).Should(gomega.BeAnExistingFile())
+
+		rawManifest, err := readOCIBlob(dir, descriptor.Digest)
+		gomega.Expect(err).Should(gomega.Succeed())
+		var manifest ociManifest
+		gomega.Expect(json.Unmarshal(rawManifest, &manifest)).Should(gomega.Succeed())
+		gomega.Expect(manifest.ArtifactType).Should(gomega.Equal(OCIArtifactType))
+		gomega.Expect(manifest.Annotations).Should(gomega.HaveKeyWithValue(ociTitleAnnotation, "Nginx"))
+		gomega.Expect(manifest.Annotations).Should(gomega.HaveKeyWithValue(ociVersionAnnotation, "1.2.0"))
+		gomega.Expect(manifest.Layers).Should(gomega.HaveLen(1))
+		rawConfig, err := readOCIBlob(dir, manifest.Config.Digest)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(string(rawConfig)).Should(gomega.ContainSubstring(`"license":"Apache License Version 2.0"`))
+
+		loaded, err := NewApplicationFromOCILayout(dir, "")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(loaded.GetNames()).Should(gomega.HaveKey("application"))
+		digest, err := app.Digest()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(loaded.Digest()).Should(gomega.Equal(digest))
+	})
+
+	ginkgo.It("Should keep several references in the same layout", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		descriptor, err := app.ToOCILayout(dir, "")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(descriptor.Annotations[ociRefNameAnnotation]).Should(gomega.Equal(DefaultOCIReference))
+
+		gomega.Expect(app.ApplyParameters("application", "renamed", "")).Should(gomega.Succeed())
+		_, err = app.ToOCILayout(dir, "v2")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		latest, err := NewApplicationFromOCILayout(dir, DefaultOCIReference)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(latest.GetNames()).Should(gomega.HaveKeyWithValue("application", "application"))
+		v2, err := NewApplicationFromOCILayout(dir, "v2")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(v2.GetNames()).Should(gomega.HaveKey("renamed"))
+
+		// the reference is required if the layout has more than one manifest
+		_, err = NewApplicationFromOCILayout(dir, "")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		_, err = NewApplicationFromOCILayout(dir, "v3")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should require a reference if the layout has several manifests without reference", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = app.ToOCILayout(dir, "v1")
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = app.ToOCILayout(dir, "v2")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		index, err := readOCIIndex(dir)
+		gomega.Expect(err).Should(gomega.Succeed())
+		index.Manifests[0].Annotations = nil
+		gomega.Expect(writeOCIJSON(filepath.Join(dir, ociIndexFile), index)).Should(gomega.Succeed())
+
+		_, err = NewApplicationFromOCILayout(dir, "")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+		_, err = NewApplicationFromOCILayout(dir, "v2")
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("Should fail if a blob has been modified", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		descriptor, err := app.ToOCILayout(dir, "")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		rawManifest, err := readOCIBlob(dir, descriptor.Digest)
+		gomega.Expect(err).Should(gomega.Succeed())
+		var manifest ociManifest
+		gomega.Expect(json.Unmarshal(rawManifest, &manifest)).Should(gomega.Succeed())
+		layerPath := filepath.Join(dir, ociBlobsDirectory, digestAlgorithm, strings.TrimPrefix(manifest.Layers[0].Digest, "sha256:"))
+		gomega.Expect(os.WriteFile(layerPath, []byte("modified"), 0644)).Should(gomega.Succeed())
+
+		_, err = NewApplicationFromOCILayout(dir, "")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
@@ -0,0 +1,247 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"path"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultExtensions with the extensions of the files loaded by default
+var defaultExtensions = []string{".yaml", ".yml", jsonExtension}
+
+// LoadOption with an option of the functions that load an application (NewApplication, NewApplicationFromTGZ...)
+type LoadOption func(*loadOptions)
+
+// loadOptions with the options of the functions that load an application
+type loadOptions struct {
+	// logger used to load the application and by its methods (nil to use the global logger)
+	logger *zerolog.Logger
+	// strict fails on unknown kinds and on packages without OAM applications
+	strict bool
+	// knownKinds with the kinds of the entities accepted in strict mode (empty to accept any non OAM kind)
+	knownKinds []schema.GroupVersionKind
+	// includedFiles with the patterns of the files loaded (empty to load all the files)
+	includedFiles []string
+	// excludedFiles with the patterns of the files ignored
+	excludedFiles []string
+	// extensions with the extensions of the files loaded
+	extensions []string
+	// maxDocuments with the maximum number of documents of the application (0 for no limit)
+	maxDocuments int
+	// dropComments removes the comments of the components spec and entities
+	dropComments bool
+	// maxArchiveSize with the maximum size of the files read from an archive (0 for no limit)
+	maxArchiveSize int64
+	// variables with the values of the variable placeholders of the files (nil to load the files as they are)
+	variables map[string]string
+}
+
+// WithLogger sets the logger used to load the application and by its methods. The fields of the logger (e.g. the
+// package name) are included in all the messages.
+func WithLogger(logger zerolog.Logger) LoadOption {
+	return func(options *loadOptions) {
+		options.logger = &logger
+	}
+}
+
+// WithStrictMode sets if the application is loaded in strict mode. In strict mode, the load fails if the files
+// do not contain OAM applications or if they contain entities of unknown kinds: OAM kinds (core.oam.dev and
+// core.napptive.com groups) not supported by the library, or kinds not included in WithKnownKinds if it is used.
+// By default, the application is loaded in lenient mode and these entities are stored as they are.
+func WithStrictMode(strict bool) LoadOption {
+	return func(options *loadOptions) {
+		options.strict = strict
+	}
+}
+
+// WithKnownKinds sets the kinds of the entities (besides the OAM kinds supported by the library) accepted in
+// strict mode
+func WithKnownKinds(kinds ...schema.GroupVersionKind) LoadOption {
+	return func(options *loadOptions) {
+		options.knownKinds = append(options.knownKinds, kinds...)
+	}
+}
+
+// WithIncludedFiles sets the glob patterns (see path.Match) of the files loaded. The patterns without a slash
+// are also matched against the base name of the file (e.g. "*.yaml" matches "dir/app.yaml").
+func WithIncludedFiles(patterns ...string) LoadOption {
+	return func(options *loadOptions) {
+		options.includedFiles = append(options.includedFiles, patterns...)
+	}
+}
+
+// WithExcludedFiles sets the glob patterns of the files ignored (see WithIncludedFiles)
+func WithExcludedFiles(patterns ...string) LoadOption {
+	return func(options *loadOptions) {
+		options.excludedFiles = append(options.excludedFiles, patterns...)
+	}
+}
+
+// WithExtensions sets the extensions (e.g. ".yaml") of the files loaded. By default, the YAML (.yaml and .yml)
+// and JSON (.json) files are loaded.
+func WithExtensions(extensions ...string) LoadOption {
+	return func(options *loadOptions) {
+		options.extensions = extensions
+	}
+}
+
+// WithMaxDocuments sets the maximum number of documents (OAM applications, metadata and entities) of the
+// application. The load fails with a ResourceExhausted error if it is exceeded.
+func WithMaxDocuments(maxDocuments int) LoadOption {
+	return func(options *loadOptions) {
+		options.maxDocuments = maxDocuments
+	}
+}
+
+// WithComments sets if the comments of the components spec and the entities are kept (the default). The
+// parameter annotations (see GetParametersMetadata) are read before removing the comments.
+func WithComments(keep bool) LoadOption {
+	return func(options *loadOptions) {
+		options.dropComments = !keep
+	}
+}
+
+// WithMaxArchiveSize sets the maximum size (uncompressed, in bytes) of the files read from an archive (tgz,
+// tar, zip or zstd). The load fails with a ResourceExhausted error if it is exceeded, without reading the rest
+// of the archive.
+func WithMaxArchiveSize(maxSize int64) LoadOption {
+	return func(options *loadOptions) {
+		options.maxArchiveSize = maxSize
+	}
+}
+
+// WithVariables sets the values of the variable placeholders (see SubstituteVariables) of the YAML and JSON files.
+// The placeholders are replaced in the keys and values of the documents before decoding them: the comments are
+// not changed, and the values are inserted as scalars, so they cannot change the structure of the documents.
+func WithVariables(variables map[string]string) LoadOption {
+	return func(options *loadOptions) {
+		if options.variables == nil {
+			options.variables = make(map[string]string, len(variables))
+		}
+		for name, value := range variables {
+			options.variables[name] = value
+		}
+	}
+}
+
+// newLoadOptions returns the options with the default values and the options received applied
+func newLoadOptions(opts []LoadOption) *loadOptions {
+	options := &loadOptions{extensions: defaultExtensions}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// validate checks the file patterns of the options
+func (lo *loadOptions) validate() error {
+	for _, pattern := range append(append([]string{}, lo.includedFiles...), lo.excludedFiles...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nerrors.NewInvalidArgumentErrorFrom(err, "invalid file pattern %s", pattern)
+		}
+	}
+	return nil
+}
+
+// withoutFileFilters returns a copy of the options that loads all the files, used to load the files generated
+// by the library
+func (lo *loadOptions) withoutFileFilters() *loadOptions {
+	options := *lo
+	options.includedFiles = nil
+	options.excludedFiles = nil
+	options.extensions = defaultExtensions
+	return &options
+}
+
+// acceptsFile checks if a file is loaded according to its extension and the included and excluded patterns. The
+// signature of a package (SignatureFile) is never loaded.
+func (lo *loadOptions) acceptsFile(fileName string) bool {
+	if fileName == SignatureFile || !hasExtension(fileName, lo.extensions) {
+		return false
+	}
+	if len(lo.includedFiles) > 0 && !matchesFile(fileName, lo.includedFiles) {
+		return false
+	}
+	return !matchesFile(fileName, lo.excludedFiles)
+}
+
+// acceptsKind checks if an entity of a kind can be loaded. All the kinds are accepted in lenient mode.
+func (lo *loadOptions) acceptsKind(gvk *schema.GroupVersionKind) bool {
+	if !lo.strict || getGVKType(gvk) != EntityType_UNKNOWN || validateType(gvk, oamEntityGVK) {
+		return true
+	}
+	if len(lo.knownKinds) > 0 {
+		return validateType(gvk, lo.knownKinds)
+	}
+	return !isOAMGroup(gvk.Group)
+}
+
+// hasExtension checks if the name of a file ends with one of the extensions (case insensitive)
+func hasExtension(fileName string, extensions []string) bool {
+	lowerName := strings.ToLower(fileName)
+	for _, extension := range extensions {
+		if strings.HasSuffix(lowerName, strings.ToLower(extension)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFile checks if the name of a file matches one of the patterns (already validated)
+func matchesFile(fileName string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, fileName); matched {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := path.Match(pattern, path.Base(fileName)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getLogger returns the logger of the options or the global logger
+func (lo *loadOptions) getLogger() *zerolog.Logger {
+	if lo.logger != nil {
+		return lo.logger
+	}
+	return &log.Logger
+}
+
+// WithLogger returns a clone of the application (see Clone) that logs with the logger received. It can be used
+// to add per-call fields, e.g. app.WithLogger(logger.With().Str("request", id).Logger()).Render()
+func (a *Application) WithLogger(logger zerolog.Logger) *Application {
+	clone := a.Clone()
+	clone.logger = &logger
+	return clone
+}
+
+// getLogger returns the logger of the application or the global logger
+func (a *Application) getLogger() *zerolog.Logger {
+	if a.logger != nil {
+		return a.logger
+	}
+	return &log.Logger
+}
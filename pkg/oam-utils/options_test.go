@@ -0,0 +1,216 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const definitionWithoutTemplate = `
+apiVersion: core.oam.dev/v1beta1
+kind: TraitDefinition
+metadata:
+  name: without-template
+spec:
+  appliesToWorkloads:
+    - deployments.apps
+`
+
+const jsonApplication = `{
+  "apiVersion": "core.oam.dev/v1beta1",
+  "kind": "Application",
+  "metadata": {"name": "json-app"},
+  "spec": {"components": [{"name": "web", "type": "webservice", "properties": {"image": "nginx:1.21.0"}}]}
+}`
+
+const unknownOAMKind = `
+apiVersion: core.oam.dev/v1beta1
+kind: ApplicationRevision
+metadata:
+  name: revision
+`
+
+var _ = ginkgo.Describe("Options tests", func() {
+
+	var global zerolog.Logger
+	var globalOutput *bytes.Buffer
+	var output *bytes.Buffer
+	var logger zerolog.Logger
+
+	ginkgo.BeforeEach(func() {
+		global = log.Logger
+		globalOutput = &bytes.Buffer{}
+		log.Logger = zerolog.New(globalOutput)
+		output = &bytes.Buffer{}
+		logger = zerolog.New(output).With().Str("package", "annotated").Logger()
+	})
+
+	ginkgo.AfterEach(func() {
+		log.Logger = global
+	})
+
+	ginkgo.It("Should log the load messages with the logger received", func() {
+		invalidOption := strings.Replace(annotatedApplication, "min=1 max=10", "min=one", 1)
+		_, err := NewApplicationFromYAML([][]byte{[]byte(invalidOption)}, WithLogger(logger))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output.String()).Should(gomega.ContainSubstring("ignoring invalid parameter option"))
+		gomega.Expect(output.String()).Should(gomega.ContainSubstring(`"package":"annotated"`))
+		gomega.Expect(globalOutput.Len()).Should(gomega.Equal(0))
+
+		raw, err := writeTGZ([]*ApplicationFile{{FileName: "cm.yaml", Content: []byte(cm)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewApplicationFromTGZ(raw, WithLogger(logger))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output.String()).Should(gomega.ContainSubstring("no application received"))
+		gomega.Expect(globalOutput.Len()).Should(gomega.Equal(0))
+	})
+
+	ginkgo.It("Should use the global logger by default", func() {
+		_, err := NewApplication([]*ApplicationFile{{FileName: "cm.yaml", Content: []byte(cm)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(globalOutput.String()).Should(gomega.ContainSubstring("no application received"))
+	})
+
+	ginkgo.It("Should log the messages of the methods with per-call fields", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(applicationFile)},
+			{FileName: "trait.yaml", Content: []byte(definitionWithoutTemplate)}}, WithLogger(logger))
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		_, err = app.WithLogger(logger.With().Str("request", "r-1").Logger()).GetDefinitions()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output.String()).Should(gomega.ContainSubstring("definition without cue template"))
+		gomega.Expect(output.String()).Should(gomega.ContainSubstring(`"request":"r-1"`))
+
+		output.Reset()
+		_, err = app.GetDefinitions()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(output.String()).Should(gomega.ContainSubstring("definition without cue template"))
+		gomega.Expect(output.String()).ShouldNot(gomega.ContainSubstring("request"))
+		gomega.Expect(globalOutput.Len()).Should(gomega.Equal(0))
+	})
+
+	ginkgo.Context("Load options", func() {
+
+		ginkgo.It("Should fail on unknown kinds and packages without applications in strict mode", func() {
+			entities := []*ApplicationFile{{FileName: "cm.yaml", Content: []byte(cm)}}
+			_, err := NewApplication(entities)
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = NewApplication(entities, WithStrictMode(true))
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+
+			files := []*ApplicationFile{
+				{FileName: "app.yaml", Content: []byte(applicationFile)},
+				{FileName: "cm.yaml", Content: []byte(cm)},
+				{FileName: "component.yaml", Content: []byte(componentDefinition)}}
+			_, err = NewApplication(files, WithStrictMode(true))
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			revision := append(files, &ApplicationFile{FileName: "revision.yaml", Content: []byte(unknownOAMKind)})
+			_, err = NewApplication(revision)
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = NewApplication(revision, WithStrictMode(true))
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+			gomega.Expect(err.Error()).Should(gomega.ContainSubstring("ApplicationRevision"))
+
+			configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+			_, err = NewApplication(files, WithStrictMode(true), WithKnownKinds(configMap))
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = NewApplication(files, WithStrictMode(true), WithKnownKinds(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}))
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+			raw, err := writeTGZ(entities)
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = NewApplicationFromTGZ(raw, WithStrictMode(true))
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		})
+
+		ginkgo.It("Should filter the files by pattern and extension", func() {
+			files := []*ApplicationFile{
+				{FileName: "app.yaml", Content: []byte(applicationFile)},
+				{FileName: "entities/cm.yaml", Content: []byte(cm)},
+				{FileName: "json/app.json", Content: []byte(jsonApplication)}}
+
+			app, err := NewApplication(files, WithExtensions(".yaml"))
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(app.GetNames()).ShouldNot(gomega.HaveKey("json-app"))
+			gomega.Expect(app.entities).Should(gomega.HaveLen(2))
+
+			app, err = NewApplication(files, WithExcludedFiles("entities/*", "*.json"))
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(app.entities).Should(gomega.HaveLen(1))
+
+			app, err = NewApplication(files, WithIncludedFiles("*.json", "cm.yaml"), WithExtensions(".yaml", ".JSON"))
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(app.GetNames()).Should(gomega.Equal(map[string]string{"json-app": "json-app"}))
+			gomega.Expect(app.entities).Should(gomega.HaveLen(1))
+
+			_, err = NewApplication(files, WithIncludedFiles("["))
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+
+			manifests := []*ApplicationFile{
+				{FileName: "deployment.yaml", Content: []byte(workerDeployment)},
+				{FileName: "cm.yaml", Content: []byte(cm)}}
+			app, err = NewApplicationFromManifests("imported", manifests, WithExcludedFiles("cm.yaml"))
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(app.GetNames()).Should(gomega.HaveKey("imported"))
+			gomega.Expect(app.entities).Should(gomega.BeEmpty())
+		})
+
+		ginkgo.It("Should limit the number of documents", func() {
+			files := largePackage(2, 5)
+			_, err := NewApplication(files, WithMaxDocuments(14))
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = NewApplication(files, WithMaxDocuments(13))
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+			_, err = NewApplicationWithWorkers(files, 2, WithMaxDocuments(13))
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+			_, err = NewApplication(files, WithMaxDocuments(6))
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		})
+
+		ginkgo.It("Should remove the comments if requested", func() {
+			commented := "# configuration of the application\n" + cm
+			files := []*ApplicationFile{
+				{FileName: "app.yaml", Content: []byte(annotatedApplication)},
+				{FileName: "cm.yaml", Content: []byte(commented)}}
+
+			app, err := NewApplication(files)
+			gomega.Expect(err).Should(gomega.Succeed())
+			parameters, err := app.GetParameters()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(parameters["annotated"]).Should(gomega.ContainSubstring("@param"))
+			gomega.Expect(string(app.entities[0])).Should(gomega.ContainSubstring("# configuration"))
+
+			app, err = NewApplication(files, WithComments(false))
+			gomega.Expect(err).Should(gomega.Succeed())
+			parameters, err = app.GetParameters()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(parameters["annotated"]).ShouldNot(gomega.ContainSubstring("#"))
+			gomega.Expect(app.GetParametersMetadata()["annotated"]).Should(gomega.HaveLen(3))
+			gomega.Expect(string(app.entities[0])).ShouldNot(gomega.ContainSubstring("#"))
+			gomega.Expect(string(app.entities[0])).Should(gomega.ContainSubstring("name: cm-test"))
+		})
+	})
+})
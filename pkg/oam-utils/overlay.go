@@ -0,0 +1,523 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	yamlV3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// OverlayFile with the name of the file that describes an overlay inside an overlay directory
+const OverlayFile = "overlay.yaml"
+
+// Overlay with the customizations applied to a base application to obtain a variant of it
+type Overlay struct {
+	// NamePrefix added to the name of the applications and the namespaced workload entities (see renamableKinds)
+	NamePrefix string `json:"namePrefix,omitempty"`
+	// NameSuffix added to the name of the applications and the namespaced workload entities (see renamableKinds)
+	NameSuffix string `json:"nameSuffix,omitempty"`
+	// CommonLabels added to the applications and the entities
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	// Images with the image overrides
+	Images []ImageOverride `json:"images,omitempty"`
+	// Replicas with the replica overrides
+	Replicas []ReplicaOverride `json:"replicas,omitempty"`
+	// Patches with the paths (relative to the overlay directory) of the patch files
+	Patches []string `json:"patches,omitempty"`
+	// patches with the content of the patch files
+	patches [][]byte
+}
+
+// ImageOverride with the new values of the images named `Name`
+type ImageOverride struct {
+	// Name of the image to override (without tag or digest)
+	Name string `json:"name"`
+	// NewName with the new name of the image
+	NewName string `json:"newName,omitempty"`
+	// NewTag with the new tag of the image
+	NewTag string `json:"newTag,omitempty"`
+	// Digest with the new digest of the image. It takes precedence over the tag.
+	Digest string `json:"digest,omitempty"`
+}
+
+// ReplicaOverride with the number of replicas of a component or a workload entity
+type ReplicaOverride struct {
+	// Name of the component or the entity
+	Name string `json:"name"`
+	// Count with the number of replicas
+	Count int64 `json:"count"`
+}
+
+// scalableKinds with the kinds of the workload entities whose replicas can be overridden by an overlay
+var scalableKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "ReplicationController"}: true,
+	{Group: "apps", Kind: "Deployment"}:        true,
+	{Group: "apps", Kind: "StatefulSet"}:       true,
+	{Group: "apps", Kind: "ReplicaSet"}:        true,
+}
+
+// renamableKinds with the kinds of the namespaced workload entities renamed by an overlay. The definitions, the
+// custom resource definitions and the cluster scoped or unknown kinds keep their names.
+var renamableKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "ConfigMap"}:                          true,
+	{Group: "", Kind: "Secret"}:                             true,
+	{Group: "", Kind: "Service"}:                            true,
+	{Group: "", Kind: "PersistentVolumeClaim"}:              true,
+	{Group: "apps", Kind: "Deployment"}:                     true,
+	{Group: "apps", Kind: "StatefulSet"}:                    true,
+	{Group: "apps", Kind: "DaemonSet"}:                      true,
+	{Group: "apps", Kind: "ReplicaSet"}:                     true,
+	{Group: "batch", Kind: "Job"}:                           true,
+	{Group: "batch", Kind: "CronJob"}:                       true,
+	{Group: "networking.k8s.io", Kind: "Ingress"}:           true,
+	{Group: "policy", Kind: "PodDisruptionBudget"}:          true,
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}: true,
+}
+
+// LoadOverlay reads the overlay stored in a directory
+func LoadOverlay(directory string) (*Overlay, error) {
+	content, err := os.ReadFile(filepath.Join(directory, OverlayFile))
+	if err != nil {
+		return nil, nerrors.NewNotFoundErrorFrom(err, "overlay not found in %s", directory)
+	}
+	overlay, err := NewOverlay(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, patch := range overlay.Patches {
+		patchContent, err := os.ReadFile(filepath.Join(directory, patch))
+		if err != nil {
+			return nil, nerrors.NewNotFoundErrorFrom(err, "patch %s not found", patch)
+		}
+		if err := overlay.AddPatch(patchContent); err != nil {
+			return nil, err
+		}
+	}
+	return overlay, nil
+}
+
+// NewOverlay creates an overlay from its YAML definition. The patches declared on it are not loaded.
+func NewOverlay(content []byte) (*Overlay, error) {
+	overlay := &Overlay{}
+	if err := yaml.Unmarshal(content, overlay); err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid overlay: %s", err.Error())
+	}
+	return overlay, nil
+}
+
+// AddPatch adds a patch file to the overlay. Each YAML document of the file is merged into the application
+// or entity with the same apiVersion, kind and name.
+func (o *Overlay) AddPatch(content []byte) error {
+	documents, err := splitYAMLFile(content)
+	if err != nil {
+		return nerrors.NewInvalidArgumentError("invalid patch: %s", err.Error())
+	}
+	o.patches = append(o.patches, documents...)
+	return nil
+}
+
+// ApplyOverlay returns a new application with the result of applying the overlay to the current one. The
+// comments of the components and the entities, the parameters metadata, the application metadata and the logger
+// of the current application are kept.
+func (a *Application) ApplyOverlay(overlay *Overlay) (*Application, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	// the applications are the first objects, followed by the entities in the same order
+	objects := make([]*unstructured.Unstructured, 0, len(appNames)+len(a.entities))
+	for _, appName := range appNames {
+		var content map[string]interface{}
+		if err := convertToMap(a.apps[appName], &content); err != nil {
+			return nil, err
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: content})
+	}
+	for _, entity := range a.entities {
+		_, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error applying overlay")
+		}
+		objects = append(objects, obj)
+	}
+
+	for _, patch := range overlay.patches {
+		if err := applyPatch(objects, patch); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, obj := range objects {
+		isApp := i < len(appNames)
+		if len(overlay.Images) > 0 {
+			if err := overrideImages(obj, isApp, overlay.Images); err != nil {
+				return nil, err
+			}
+		}
+		if len(overlay.Replicas) > 0 {
+			if err := overrideReplicas(obj, isApp, overlay.Replicas); err != nil {
+				return nil, err
+			}
+		}
+		if len(overlay.CommonLabels) > 0 {
+			labels := obj.GetLabels()
+			if labels == nil {
+				labels = make(map[string]string, 0)
+			}
+			for key, value := range overlay.CommonLabels {
+				labels[key] = value
+			}
+			obj.SetLabels(labels)
+		}
+	}
+	if overlay.NamePrefix != "" || overlay.NameSuffix != "" {
+		renameObjects(objects, len(appNames), overlay.NamePrefix, overlay.NameSuffix)
+	}
+
+	result := &Application{
+		apps:               make(map[string]*ApplicationDefinition, len(appNames)),
+		entities:           make([][]byte, 0, len(a.entities)),
+		componentsYAML:     make(map[string]*ComponentsNode, len(appNames)),
+		metadata:           a.metadata,
+		parametersMetadata: make(map[string][]*ParameterMetadata, len(appNames)),
+		logger:             a.logger,
+	}
+	for i, appName := range appNames {
+		var app ApplicationDefinition
+		if err := convertFromUnstructured(objects[i], &app); err != nil {
+			return nil, err
+		}
+		node, err := a.overlayComponentsNode(appName, objects[i])
+		if err != nil {
+			return nil, err
+		}
+		result.apps[app.Metadata.Name] = &app
+		result.componentsYAML[app.Metadata.Name] = node
+		result.parametersMetadata[app.Metadata.Name] = getParametersMetadata(node, a.getLogger())
+	}
+	for i, entity := range a.entities {
+		overlaid, err := overlayEntity(entity, objects[len(appNames)+i])
+		if err != nil {
+			return nil, err
+		}
+		result.entities = append(result.entities, overlaid)
+	}
+	return result, nil
+}
+
+// renameObjects adds a prefix and a suffix to the name of the applications (the first `appCount` objects) and the
+// entities of a renamable kind, and updates the references to them found in the applications (see
+// walkApplicationReferences), the entity specs and the EntitiesAnnotation and ApplicationsAnnotation annotations
+func renameObjects(objects []*unstructured.Unstructured, appCount int, prefix string, suffix string) {
+	renamedApps := make(map[string]string, appCount)
+	renamedEntities := make(map[EntityID]string, 0)
+	for i, obj := range objects {
+		name := obj.GetName()
+		newName := prefix + name + suffix
+		if i < appCount {
+			renamedApps[name] = newName
+		} else if renamableKinds[obj.GroupVersionKind().GroupKind()] {
+			renamedEntities[EntityID{Kind: obj.GetKind(), Name: name}] = newName
+		} else {
+			continue
+		}
+		obj.SetName(newName)
+	}
+
+	rename := func(path string, kind string, name string) string {
+		if newName, renamed := renamedEntities[EntityID{Kind: kind, Name: name}]; renamed {
+			return newName
+		}
+		return name
+	}
+	for i, obj := range objects {
+		annotations := obj.GetAnnotations()
+		if i >= appCount {
+			walkEntityReferences(obj.Object["spec"], "spec", rename)
+			if value, exists := annotations[ApplicationsAnnotation]; exists {
+				names := splitAnnotation(value)
+				for j, name := range names {
+					if newName, renamed := renamedApps[name]; renamed {
+						names[j] = newName
+					}
+				}
+				annotations[ApplicationsAnnotation] = strings.Join(names, ",")
+				obj.SetAnnotations(annotations)
+			}
+			continue
+		}
+		walkApplicationReferences(obj.Object, func(component string, path string, kind string, name string) string {
+			return rename(path, kind, name)
+		})
+		if value, exists := annotations[EntitiesAnnotation]; exists {
+			entities := splitAnnotation(value)
+			for j, entity := range entities {
+				if parts := strings.SplitN(entity, "/", 2); len(parts) == 2 {
+					entities[j] = parts[0] + "/" + rename("", parts[0], parts[1])
+				}
+			}
+			annotations[EntitiesAnnotation] = strings.Join(entities, ",")
+			obj.SetAnnotations(annotations)
+		}
+	}
+}
+
+// overlayComponentsNode returns the components spec with comments of an application after applying an overlay
+func (a *Application) overlayComponentsNode(appName string, obj *unstructured.Unstructured) (*ComponentsNode, error) {
+	node := &ComponentsNode{}
+	components, found, err := unstructured.NestedSlice(obj.Object, "spec", "components")
+	if err != nil || !found {
+		return node, nil
+	}
+	var original *yamlV3.Node
+	if current, exists := a.componentsYAML[appName]; exists {
+		original = &current.Spec.Components
+	}
+	synced, err := syncYAMLNode(original, components)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error applying overlay to %s application", appName)
+	}
+	node.Spec.Components = *synced
+	return node, nil
+}
+
+// overlayEntity returns an entity after applying an overlay keeping its comments
+func overlayEntity(entity []byte, obj *unstructured.Unstructured) ([]byte, error) {
+	var document yamlV3.Node
+	if err := yamlV3.Unmarshal(entity, &document); err != nil || document.Kind != yamlV3.DocumentNode || len(document.Content) == 0 {
+		return convertToYAML(obj.Object)
+	}
+	synced, err := syncYAMLNode(document.Content[0], obj.Object)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error applying overlay to entity %s", obj.GetName())
+	}
+	document.Content[0] = synced
+	overlaid, err := encodeYAMLNode(&document)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error applying overlay to entity %s", obj.GetName())
+	}
+	return overlaid, nil
+}
+
+// ApplyOverlayDirectory returns a new application with the result of applying the overlays stored
+// in the directories received (in order) to the current one
+func (a *Application) ApplyOverlayDirectory(directories ...string) (*Application, error) {
+	result := a
+	for _, directory := range directories {
+		overlay, err := LoadOverlay(directory)
+		if err != nil {
+			return nil, err
+		}
+		result, err = result.ApplyOverlay(overlay)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// applyPatch merges a patch document into the object with the same apiVersion, kind and name
+func applyPatch(objects []*unstructured.Unstructured, patch []byte) error {
+	_, patchObj, err := getGVK(patch)
+	if err != nil {
+		return nerrors.NewInvalidArgumentError("invalid patch: %s", err.Error())
+	}
+	for _, obj := range objects {
+		if obj.GetAPIVersion() == patchObj.GetAPIVersion() && obj.GetKind() == patchObj.GetKind() && obj.GetName() == patchObj.GetName() {
+			obj.Object = mergePatch(obj.Object, patchObj.Object).(map[string]interface{})
+			return nil
+		}
+	}
+	return nerrors.NewNotFoundError("patch target %s %s not found", patchObj.GetKind(), patchObj.GetName())
+}
+
+// mergePatch merges a patch into a value following the JSON merge patch rules (RFC 7386), except for
+// lists whose elements have a name, that are merged element by element.
+func mergePatch(original interface{}, patch interface{}) interface{} {
+	switch patchValue := patch.(type) {
+	case map[string]interface{}:
+		originalMap, ok := original.(map[string]interface{})
+		if !ok {
+			originalMap = make(map[string]interface{}, 0)
+		}
+		for key, value := range patchValue {
+			if value == nil {
+				delete(originalMap, key)
+				continue
+			}
+			originalMap[key] = mergePatch(originalMap[key], value)
+		}
+		return originalMap
+	case []interface{}:
+		originalList, ok := original.([]interface{})
+		if !ok || !isNamedList(originalList) || !isNamedList(patchValue) {
+			return patchValue
+		}
+		for _, element := range patchValue {
+			name := element.(map[string]interface{})["name"]
+			merged := false
+			for i, originalElement := range originalList {
+				if originalElement.(map[string]interface{})["name"] == name {
+					originalList[i] = mergePatch(originalElement, element)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				originalList = append(originalList, element)
+			}
+		}
+		return originalList
+	default:
+		return patch
+	}
+}
+
+// isNamedList returns true if all the elements of a list are maps with a name
+func isNamedList(list []interface{}) bool {
+	for _, element := range list {
+		elementMap, ok := element.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, hasName := elementMap["name"]; !hasName {
+			return false
+		}
+	}
+	return true
+}
+
+// overrideImages applies the image overrides to the components of an application or the containers of an entity
+func overrideImages(obj *unstructured.Unstructured, isApp bool, overrides []ImageOverride) error {
+	apply := func(path string, image string) string {
+		return applyImageOverrides(image, overrides)
+	}
+	if !isApp {
+		walkImages(obj.Object, "", false, false, apply)
+		return nil
+	}
+	components, _, err := unstructured.NestedSlice(obj.Object, "spec", "components")
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error overriding images")
+	}
+	for _, component := range components {
+		walkImages(component, "", true, false, apply)
+	}
+	return unstructured.SetNestedSlice(obj.Object, components, "spec", "components")
+}
+
+// applyImageOverrides returns the image reference after applying the first matching override
+func applyImageOverrides(image string, overrides []ImageOverride) string {
+	name, tag, digest := splitImageReference(image)
+	for _, override := range overrides {
+		if override.Name != name {
+			continue
+		}
+		if override.NewName != "" {
+			name = override.NewName
+		}
+		if override.NewTag != "" {
+			tag = override.NewTag
+		}
+		if override.Digest != "" {
+			return name + "@" + override.Digest
+		}
+		if digest != "" {
+			return name + "@" + digest
+		}
+		if tag != "" {
+			return name + ":" + tag
+		}
+		return name
+	}
+	return image
+}
+
+// splitImageReference splits an image reference in name, tag and digest
+func splitImageReference(image string) (string, string, string) {
+	name, digest := image, ""
+	if index := strings.Index(name, "@"); index != -1 {
+		name, digest = name[:index], name[index+1:]
+	}
+	tag := ""
+	// the tag is after the last colon that is not part of the registry host (host:port/name)
+	if index := strings.LastIndex(name, ":"); index != -1 && !strings.Contains(name[index:], "/") {
+		name, tag = name[:index], name[index+1:]
+	}
+	return name, tag, digest
+}
+
+// overrideReplicas applies the replica overrides to the components of an application (scaler trait) or to a workload entity
+// of the scalableKinds. The replicas of the entities are set even if the manifest does not define them (default 1).
+func overrideReplicas(obj *unstructured.Unstructured, isApp bool, overrides []ReplicaOverride) error {
+	if !isApp {
+		for _, override := range overrides {
+			if override.Name != obj.GetName() {
+				continue
+			}
+			// the other entities with the same name (e.g. the service of a deployment) are not scaled
+			if scalableKinds[obj.GroupVersionKind().GroupKind()] {
+				return unstructured.SetNestedField(obj.Object, override.Count, "spec", "replicas")
+			}
+		}
+		return nil
+	}
+
+	components, _, err := unstructured.NestedSlice(obj.Object, "spec", "components")
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error overriding replicas")
+	}
+	for _, raw := range components {
+		component, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, override := range overrides {
+			if component["name"] != override.Name {
+				continue
+			}
+			traits, _, _ := unstructured.NestedSlice(component, "traits")
+			updated := false
+			for _, rawTrait := range traits {
+				if trait, ok := rawTrait.(map[string]interface{}); ok && trait["type"] == scalerTraitType {
+					_ = unstructured.SetNestedField(trait, override.Count, "properties", "replicas")
+					updated = true
+				}
+			}
+			if !updated {
+				traits = append(traits, map[string]interface{}{
+					"type":       scalerTraitType,
+					"properties": map[string]interface{}{"replicas": override.Count},
+				})
+			}
+			component["traits"] = traits
+		}
+	}
+	return unstructured.SetNestedSlice(obj.Object, components, "spec", "components")
+}
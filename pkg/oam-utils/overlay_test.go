@@ -0,0 +1,233 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const prodOverlay = `
+namePrefix: prod-
+commonLabels:
+  env: prod
+images:
+  - name: nginx
+    newName: registry.example.com/nginx
+    newTag: 1.21.0
+replicas:
+  - name: component1
+    count: 3
+patches:
+  - patch.yaml
+`
+
+const prodPatch = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-test
+data:
+  memory: "1Gi"
+`
+
+var _ = ginkgo.Describe("Overlay tests", func() {
+
+	ginkgo.It("Should be able to apply an overlay", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		overlay, err := NewOverlay([]byte(prodOverlay))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(overlay.AddPatch([]byte(prodPatch))).Should(gomega.Succeed())
+
+		result, err := app.ApplyOverlay(overlay)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(result.GetNames()).Should(gomega.HaveKey("prod-application"))
+		gomega.Expect(result.apps["prod-application"].Metadata.Labels).Should(gomega.HaveKeyWithValue("env", "prod"))
+
+		components, err := result.apps["prod-application"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components[0].Properties).Should(gomega.HaveKeyWithValue("image", "registry.example.com/nginx:1.21.0"))
+		gomega.Expect(components[0].Traits).Should(gomega.HaveLen(1))
+		gomega.Expect(components[0].Traits[0].Properties).Should(gomega.HaveKeyWithValue("replicas", float64(3)))
+
+		_, entities, err := result.ToYAML()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entities).Should(gomega.HaveLen(1))
+		_, cmObj, err := getGVK(entities[0])
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(cmObj.GetName()).Should(gomega.Equal("prod-cm-test"))
+		gomega.Expect(cmObj.Object["data"]).Should(gomega.HaveKeyWithValue("memory", "1Gi"))
+		gomega.Expect(cmObj.Object["data"]).Should(gomega.HaveKeyWithValue("cpu", "0.50"))
+
+		// the base application is not modified
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("application"))
+	})
+
+	ginkgo.It("Should be able to apply an overlay stored in a directory", func() {
+		dir, err := os.MkdirTemp("", "overlay")
+		gomega.Expect(err).Should(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		gomega.Expect(os.WriteFile(filepath.Join(dir, OverlayFile), []byte(prodOverlay), 0644)).Should(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(dir, "patch.yaml"), []byte(prodPatch), 0644)).Should(gomega.Succeed())
+
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		result, err := app.ApplyOverlayDirectory(dir)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(result.GetNames()).Should(gomega.HaveKey("prod-application"))
+
+		tgz, err := result.ToTGZ()
+		gomega.Expect(err).Should(gomega.Succeed())
+		fromTGZ, err := NewApplicationFromTGZ(tgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(fromTGZ.GetNames()).Should(gomega.HaveKey("prod-application"))
+		gomega.Expect(fromTGZ.entities).Should(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("Should keep the comments, the parameters metadata and the metadata", func() {
+		commented := "# memory settings\n" + strings.Replace(cm, "memory:", "# limit of the container\n  memory:", 1)
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(annotatedApplication + "---" + commented)},
+			{FileName: "metadata.yaml", Content: []byte(metadata)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		overlay, err := NewOverlay([]byte(prodOverlay))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(overlay.AddPatch([]byte(prodPatch))).Should(gomega.Succeed())
+		result, err := app.ApplyOverlay(overlay)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		gomega.Expect(result.GetParametersMetadata()["prod-annotated"]).Should(gomega.HaveLen(3))
+		parameters, err := result.GetParameters()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parameters["prod-annotated"]).Should(gomega.ContainSubstring("# @param description=\"Image of the container\""))
+		gomega.Expect(parameters["prod-annotated"]).Should(gomega.ContainSubstring("image: registry.example.com/nginx:1.21.0"))
+		gomega.Expect(string(result.entities[0])).Should(gomega.ContainSubstring("# limit of the container"))
+		gomega.Expect(string(result.entities[0])).Should(gomega.ContainSubstring("memory: 1Gi"))
+		gomega.Expect(result.metadata).Should(gomega.Equal(app.metadata))
+	})
+
+	ginkgo.It("Should only rename the applications and the workload entities and update their references", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(referencingApplication)},
+			{FileName: "entities.yaml", Content: []byte(referencedEntities)},
+			{FileName: "component.yaml", Content: []byte(componentDefinition)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		result, err := app.ApplyOverlay(&Overlay{NameSuffix: "-prod"})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(result.GetNames()).Should(gomega.HaveKey("refs-app-prod"))
+		definitions, err := result.GetDefinitions()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(definitions["ComponentDefinition"]).Should(gomega.HaveKey("simple-service"))
+
+		resolution, err := result.ResolveEntities()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(resolution.Entities).Should(gomega.Equal(map[string][]EntityID{"refs-app-prod": {
+			{Kind: "Secret", Name: "db-credentials-prod"},
+			{Kind: "ConfigMap", Name: "settings-prod"},
+			{Kind: "ConfigMap", Name: "shared-config-prod"},
+			{Kind: "Secret", Name: "registry-prod"},
+			{Kind: "CustomResourceDefinition", Name: "widgets.example.com"},
+			{Kind: "Widget", Name: "sample"},
+			{Kind: "ConfigMap", Name: "annotated-prod"},
+		}}))
+		gomega.Expect(resolution.Orphaned).Should(gomega.Equal([]EntityID{
+			{Kind: "ConfigMap", Name: "orphan-prod"},
+			{Kind: "ComponentDefinition", Name: "simple-service"},
+		}))
+	})
+
+	ginkgo.It("Should override the replicas of an existing scaler trait", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(fileWithWorkflow)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		result, err := app.ApplyOverlay(&Overlay{Replicas: []ReplicaOverride{{Name: "component2", Count: 5}}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		components, err := result.apps["appWithWorkflow"].getComponents()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components[1].Traits).Should(gomega.HaveLen(1))
+		gomega.Expect(components[1].Traits[0].Properties).Should(gomega.HaveKeyWithValue("replicas", float64(5)))
+	})
+
+	ginkgo.It("Should override the replicas of the workload entities without replicas", func() {
+		deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.20.0
+`
+		service := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+spec:
+  ports:
+  - port: 80
+`
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile), []byte(deployment), []byte(service)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		result, err := app.ApplyOverlay(&Overlay{Replicas: []ReplicaOverride{{Name: "nginx", Count: 3}}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		for _, entity := range result.entities {
+			_, obj, err := getGVK(entity)
+			gomega.Expect(err).Should(gomega.Succeed())
+			replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(found).Should(gomega.Equal(obj.GetKind() == "Deployment"))
+			if found {
+				gomega.Expect(replicas).Should(gomega.Equal(int64(3)))
+			}
+		}
+	})
+
+	ginkgo.It("Should not be able to apply a patch without target", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(fileWithWorkflow)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		overlay := &Overlay{}
+		gomega.Expect(overlay.AddPatch([]byte(prodPatch))).Should(gomega.Succeed())
+		_, err = app.ApplyOverlay(overlay)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to split image references", func() {
+		name, tag, digest := splitImageReference("localhost:5000/nginx:1.20.0")
+		gomega.Expect(name).Should(gomega.Equal("localhost:5000/nginx"))
+		gomega.Expect(tag).Should(gomega.Equal("1.20.0"))
+		gomega.Expect(digest).Should(gomega.BeEmpty())
+
+		name, tag, digest = splitImageReference("nginx@sha256:abc")
+		gomega.Expect(name).Should(gomega.Equal("nginx"))
+		gomega.Expect(tag).Should(gomega.BeEmpty())
+		gomega.Expect(digest).Should(gomega.Equal("sha256:abc"))
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Select returns a new application with the OAM applications named `applicationNames`, the entities and the
+// metadata of the catalog application. The content is shared with the original application as in Clone.
+func (a *Application) Select(applicationNames ...string) (*Application, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	for _, name := range applicationNames {
+		if _, exists := a.apps[name]; !exists {
+			return nil, nerrors.NewNotFoundError("application %s not found", name)
+		}
+	}
+	return a.subset(applicationNames, a.entities, a.metadata), nil
+}
+
+// SelectByLabels returns a new application (see Select) with the OAM applications whose labels match a
+// Kubernetes label selector (e.g. "tier=frontend,env in (staging, production)"). It returns a NotFound error if
+// no application matches.
+func (a *Application) SelectByLabels(selector string) (*Application, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid label selector: %s", err.Error())
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	names := make([]string, 0)
+	for name, app := range a.apps {
+		if parsed.Matches(labels.Set(app.Metadata.Labels)) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nerrors.NewNotFoundError("no application matches the selector %s", selector)
+	}
+	return a.subset(names, a.entities, a.metadata), nil
+}
+
+// Extract returns a new application with the OAM application named `applicationName`, only the entities it
+// uses (see ResolveEntities) and the metadata of the catalog application. If the catalog application has several
+// OAM applications, the name of the metadata is replaced by `applicationName`.
+func (a *Application) Extract(applicationName string) (*Application, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	resolution, err := a.resolveEntities()
+	if err != nil {
+		return nil, err
+	}
+	return a.extract(applicationName, resolution)
+}
+
+// Split returns a new application (see Extract) for each OAM application of the catalog application indexed by
+// application name
+func (a *Application) Split() (map[string]*Application, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	resolution, err := a.resolveEntities()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*Application, len(a.apps))
+	for name := range a.apps {
+		extracted, err := a.extract(name, resolution)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = extracted
+	}
+	return result, nil
+}
+
+// extract returns the application named `applicationName` with the entities it uses in the resolution
+func (a *Application) extract(applicationName string, resolution *EntityResolution) (*Application, error) {
+	if _, exists := a.apps[applicationName]; !exists {
+		return nil, nerrors.NewNotFoundError("application %s not found", applicationName)
+	}
+	used := make(map[EntityID]bool, len(resolution.Entities[applicationName]))
+	for _, id := range resolution.Entities[applicationName] {
+		used[id] = true
+	}
+	entities := make([][]byte, 0)
+	for _, entity := range a.entities {
+		gvk, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading entity")
+		}
+		if used[EntityID{Kind: gvk.Kind, Name: obj.GetName()}] {
+			entities = append(entities, entity)
+		}
+	}
+	metadata := a.metadata
+	if metadata != nil && len(a.apps) > 1 {
+		renamed, err := setMetadataField(metadata, "name", applicationName)
+		if err != nil {
+			return nil, err
+		}
+		metadata = renamed
+	}
+	return a.subset([]string{applicationName}, entities, metadata), nil
+}
+
+// subset returns a new application with some of the OAM applications and the entities and metadata received.
+// The applications, components spec and entities are shared as in Clone.
+func (a *Application) subset(applicationNames []string, entities [][]byte, metadata []byte) *Application {
+	apps := make(map[string]*ApplicationDefinition, len(applicationNames))
+	nodes := make(map[string]*ComponentsNode, len(applicationNames))
+	parametersMetadata := make(map[string][]*ParameterMetadata, len(applicationNames))
+	for _, name := range applicationNames {
+		apps[name] = a.apps[name]
+		if node, exists := a.componentsYAML[name]; exists {
+			nodes[name] = node
+		}
+		if parameters, exists := a.parametersMetadata[name]; exists {
+			parametersMetadata[name] = parameters
+		}
+	}
+	return &Application{
+		apps:               apps,
+		entities:           entities,
+		componentsYAML:     nodes,
+		metadata:           metadata,
+		parametersMetadata: parametersMetadata,
+		logger:             a.logger,
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// packageDefinitions with the definitions of the types used by the applications of completeApplication
+const packageDefinitions = `
+apiVersion: core.oam.dev/v1beta1
+kind: ComponentDefinition
+metadata:
+  name: worker
+---
+apiVersion: core.oam.dev/v1beta1
+kind: TraitDefinition
+metadata:
+  name: scaler
+---
+apiVersion: core.oam.dev/v1beta1
+kind: ComponentDefinition
+metadata:
+  name: unused
+`
+
+// labeledApplications returns completeApplication with labels in the applications
+func labeledApplications() string {
+	content := strings.Replace(completeApplication, "name: app1\n", "name: app1\n  labels:\n    tier: frontend\n", 1)
+	return strings.Replace(content, "name: app2\n", "name: app2\n  labels:\n    tier: backend\n", 1)
+}
+
+var _ = ginkgo.Describe("Package tests", func() {
+
+	var app *Application
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		app, err = NewApplication([]*ApplicationFile{
+			{FileName: "apps.yaml", Content: []byte(labeledApplications())},
+			{FileName: "definitions.yaml", Content: []byte(packageDefinitions)},
+			{FileName: "metadata.yaml", Content: []byte(metadata)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("Should select applications by name", func() {
+		selected, err := app.Select("app2")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(selected.GetNames()).Should(gomega.Equal(map[string]string{"app2": "app2"}))
+		gomega.Expect(selected.entities).Should(gomega.HaveLen(len(app.entities)))
+		gomega.Expect(selected.metadata).Should(gomega.Equal(app.metadata))
+		gomega.Expect(app.GetNames()).Should(gomega.HaveLen(2))
+
+		_, err = app.Select("app1", "unknown")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+	})
+
+	ginkgo.It("Should select applications by labels", func() {
+		selected, err := app.SelectByLabels("tier=frontend")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(selected.GetNames()).Should(gomega.Equal(map[string]string{"app1": "app1"}))
+
+		selected, err = app.SelectByLabels("tier in (frontend, backend)")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(selected.GetNames()).Should(gomega.HaveLen(2))
+
+		_, err = app.SelectByLabels("tier=database")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		_, err = app.SelectByLabels("tier in (")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+
+	ginkgo.It("Should extract an application with the entities it references", func() {
+		extracted, err := app.Extract("app1")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(extracted.GetNames()).Should(gomega.Equal(map[string]string{"app1": "app1"}))
+		gomega.Expect(extracted.entities).Should(gomega.BeEmpty())
+		metadata, err := extracted.GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Name).Should(gomega.Equal("app1"))
+		original, err := app.GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Version).Should(gomega.Equal(original.Version))
+
+		extracted, err = app.Extract("app2")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entityNames(extracted)).Should(gomega.Equal([]string{"worker", "scaler"}))
+
+		// the extracted application is independent of the original one
+		err = extracted.ApplyParameters("app2", "", spec)
+		gomega.Expect(err).Should(gomega.Succeed())
+		parameters, err := app.GetParameters()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parameters["app2"]).ShouldNot(gomega.ContainSubstring("webservice"))
+
+		_, err = app.Extract("unknown")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+	})
+
+	ginkgo.It("Should split a package in an application per OAM application", func() {
+		packages, err := app.Split()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(packages).Should(gomega.HaveLen(2))
+		gomega.Expect(packages["app1"].GetNames()).Should(gomega.Equal(map[string]string{"app1": "app1"}))
+		gomega.Expect(packages["app2"].GetNames()).Should(gomega.Equal(map[string]string{"app2": "app2"}))
+		gomega.Expect(entityNames(packages["app2"])).Should(gomega.Equal([]string{"worker", "scaler"}))
+		metadata, err := packages["app2"].GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Name).Should(gomega.Equal("app2"))
+
+		// a package with a single application keeps the name of the metadata
+		single, err := packages["app2"].Extract("app2")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(single.metadata).Should(gomega.Equal(packages["app2"].metadata))
+	})
+
+	ginkgo.It("Should not modify the names received", func() {
+		names := []string{"app2", "app1"}
+		selected, err := app.Select(names...)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(selected.GetNames()).Should(gomega.HaveLen(2))
+		gomega.Expect(names).Should(gomega.Equal([]string{"app2", "app1"}))
+	})
+})
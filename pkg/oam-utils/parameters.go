@@ -0,0 +1,351 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// jsonSchemaVersion with the JSON Schema dialect of the generated schemas
+const jsonSchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+
+// usageDirective with the prefix used by the definitions to document the parameters
+const usageDirective = "+usage="
+
+// JSONSchema with the subset of JSON Schema used to describe the parameters document
+type JSONSchema struct {
+	// Schema with the JSON Schema dialect
+	Schema string `json:"$schema,omitempty"`
+	// Title of the schema
+	Title string `json:"title,omitempty"`
+	// Description of the value
+	Description string `json:"description,omitempty"`
+	// Type of the value (object, array, string, integer, number or boolean)
+	Type string `json:"type,omitempty"`
+	// Properties with the schema of the fields of an object
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	// Required with the required fields of an object
+	Required []string `json:"required,omitempty"`
+	// PrefixItems with the schema of each element of an array
+	PrefixItems []*JSONSchema `json:"prefixItems,omitempty"`
+	// Items with the schema of the elements of an array
+	Items *JSONSchema `json:"items,omitempty"`
+	// Enum with the allowed values
+	Enum []interface{} `json:"enum,omitempty"`
+	// Minimum with the minimum value of a number
+	Minimum *float64 `json:"minimum,omitempty"`
+	// Maximum with the maximum value of a number
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Default with the default (current) value
+	Default interface{} `json:"default,omitempty"`
+}
+
+// GetParametersJSON returns the components spec of an application in JSON indexed by application name
+func (a *Application) GetParametersJSON() (map[string]string, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	parameters := make(map[string]string, 0)
+	for appName := range a.componentsYAML {
+		document, err := a.getParametersDocument(appName)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(document)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error getting the parameters of %s application", appName)
+		}
+		parameters[appName] = string(raw)
+	}
+	return parameters, nil
+}
+
+// GetParametersSchema returns the JSON Schema of the parameters document (see GetParametersJSON) indexed by
+// application name. The schema is inferred from the current values and, if the application bundles the
+// definition of a component or a trait, from the parameters declared in the definition.
+func (a *Application) GetParametersSchema() (map[string]*JSONSchema, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	definitions, err := a.getDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*JSONSchema, 0)
+	for appName := range a.componentsYAML {
+		document, err := a.getParametersDocument(appName)
+		if err != nil {
+			return nil, err
+		}
+		components, _ := document["components"].([]interface{})
+		componentsSchema := &JSONSchema{Type: "array", Items: &JSONSchema{Type: "object"}}
+		componentSchemas := make(map[string]*JSONSchema, 0)
+		for _, component := range components {
+			componentMap, ok := component.(map[string]interface{})
+			if !ok {
+				componentsSchema.PrefixItems = append(componentsSchema.PrefixItems, inferSchema(component))
+				continue
+			}
+			componentSchema, err := getComponentSchema(componentMap, definitions)
+			if err != nil {
+				return nil, err
+			}
+			componentsSchema.PrefixItems = append(componentsSchema.PrefixItems, componentSchema)
+			if componentName, ok := componentMap["name"].(string); ok {
+				componentSchemas[componentName] = componentSchema
+			}
+		}
+		for _, parameter := range a.parametersMetadata[appName] {
+			if componentSchema, exists := componentSchemas[parameter.Component]; exists {
+				applyParametersMetadata(componentSchema, parameter)
+			}
+		}
+		schemas[appName] = &JSONSchema{
+			Schema:     jsonSchemaVersion,
+			Title:      fmt.Sprintf("%s parameters", a.apps[appName].Metadata.Name),
+			Type:       "object",
+			Properties: map[string]*JSONSchema{"components": componentsSchema},
+			Required:   []string{"components"},
+		}
+	}
+	return schemas, nil
+}
+
+// getParametersDocument returns the components spec of an application as generic values
+func (a *Application) getParametersDocument(appName string) (map[string]interface{}, error) {
+	node, exists := a.componentsYAML[appName]
+	if !exists {
+		return nil, nerrors.NewNotFoundError("application %s not found", appName)
+	}
+	var components interface{}
+	if node.Spec.Components.Kind != 0 {
+		if err := node.Spec.Components.Decode(&components); err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error getting the parameters of %s application", appName)
+		}
+	}
+	// normalize the values using the JSON representation
+	raw, err := json.Marshal(map[string]interface{}{"components": components})
+	if err != nil {
+		return nil, nerrors.NewInternalError("error getting the parameters of %s application", appName)
+	}
+	document := make(map[string]interface{}, 0)
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, nerrors.NewInternalError("error getting the parameters of %s application", appName)
+	}
+	return document, nil
+}
+
+// getComponentSchema returns the schema of a component of the parameters document
+func getComponentSchema(component map[string]interface{}, definitions map[string]map[string]*Definition) (*JSONSchema, error) {
+	schema := inferSchema(component)
+	componentType, _ := component["type"].(string)
+	if definition, exists := definitions[componentDefinitionGVK[0].Kind][componentType]; exists {
+		properties, err := getDefinitionSchema(definition)
+		if err != nil {
+			return nil, err
+		}
+		schema.Properties["properties"] = mergeDefaults(properties, component["properties"])
+	}
+
+	traits, _ := component["traits"].([]interface{})
+	traitsSchema, hasTraits := schema.Properties["traits"]
+	for i, trait := range traits {
+		traitMap, ok := trait.(map[string]interface{})
+		if !ok || !hasTraits || i >= len(traitsSchema.PrefixItems) {
+			continue
+		}
+		traitType, _ := traitMap["type"].(string)
+		if definition, exists := definitions[traitDefinitionGVK[0].Kind][traitType]; exists {
+			properties, err := getDefinitionSchema(definition)
+			if err != nil {
+				return nil, err
+			}
+			traitsSchema.PrefixItems[i].Properties["properties"] = mergeDefaults(properties, traitMap["properties"])
+		}
+	}
+	schema.Required = []string{"name", "type"}
+	return schema, nil
+}
+
+// getDefinitionSchema returns the schema of the parameters declared in a definition
+func getDefinitionSchema(definition *Definition) (*JSONSchema, error) {
+	value, err := evaluateTemplate(cuecontext.New(), definition.Template, nil, map[string]interface{}{
+		"name":      "",
+		"appName":   "",
+		"namespace": defaultRenderNamespace,
+	})
+	if err != nil {
+		return nil, nerrors.NewInternalError("error reading the parameters of %s: %s", definition.Name, err.Error())
+	}
+	parameter := value.LookupPath(cue.ParsePath("parameter"))
+	if !parameter.Exists() {
+		return &JSONSchema{Type: "object"}, nil
+	}
+	return cueToSchema(parameter), nil
+}
+
+// cueToSchema converts a CUE value into a JSON Schema
+func cueToSchema(value cue.Value) *JSONSchema {
+	schema := &JSONSchema{Description: getCueDescription(value)}
+	if defaultValue, exists := value.Default(); exists {
+		if converted, err := toInterface(defaultValue); err == nil {
+			schema.Default = converted
+		}
+	}
+	if op, args := value.Expr(); op == cue.OrOp {
+		enum := make([]interface{}, 0, len(args))
+		for _, arg := range args {
+			converted, err := toInterface(arg)
+			if err != nil {
+				enum = nil
+				break
+			}
+			enum = append(enum, converted)
+		}
+		schema.Enum = enum
+	}
+
+	switch kind := value.IncompleteKind(); {
+	case kind == cue.StructKind:
+		schema.Type = "object"
+		schema.Properties = make(map[string]*JSONSchema, 0)
+		iter, err := value.Fields(cue.Optional(true))
+		if err != nil {
+			return schema
+		}
+		for iter.Next() {
+			label := iter.Label()
+			schema.Properties[label] = cueToSchema(iter.Value())
+			if _, hasDefault := iter.Value().Default(); !iter.IsOptional() && !hasDefault {
+				schema.Required = append(schema.Required, label)
+			}
+		}
+	case kind == cue.ListKind:
+		schema.Type = "array"
+		if elem := value.LookupPath(cue.MakePath(cue.AnyIndex)); elem.Exists() {
+			schema.Items = cueToSchema(elem)
+		}
+	case kind == cue.StringKind:
+		schema.Type = "string"
+	case kind == cue.IntKind:
+		schema.Type = "integer"
+	case kind&cue.NumberKind != 0 && kind&^cue.NumberKind == 0:
+		schema.Type = "number"
+	case kind == cue.BoolKind:
+		schema.Type = "boolean"
+	}
+	return schema
+}
+
+// getCueDescription returns the documentation of a CUE field. The `+usage=` directive used by KubeVela
+// definitions takes precedence over the rest of the comments.
+func getCueDescription(value cue.Value) string {
+	lines := make([]string, 0)
+	for _, group := range value.Doc() {
+		for _, line := range strings.Split(strings.TrimSpace(group.Text()), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, usageDirective) {
+				return strings.TrimPrefix(line, usageDirective)
+			}
+			if line != "" && !strings.HasPrefix(line, "+") {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// inferSchema returns the schema of a value using the value as default
+func inferSchema(value interface{}) *JSONSchema {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema, 0)}
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			schema.Properties[key] = inferSchema(typed[key])
+		}
+		return schema
+	case []interface{}:
+		schema := &JSONSchema{Type: "array"}
+		for _, element := range typed {
+			schema.PrefixItems = append(schema.PrefixItems, inferSchema(element))
+		}
+		if len(typed) > 0 {
+			schema.Items = inferSchema(typed[0])
+			clearDefaults(schema.Items)
+		}
+		return schema
+	case string:
+		return &JSONSchema{Type: "string", Default: typed}
+	case bool:
+		return &JSONSchema{Type: "boolean", Default: typed}
+	case float64:
+		if typed == math.Trunc(typed) {
+			return &JSONSchema{Type: "integer", Default: typed}
+		}
+		return &JSONSchema{Type: "number", Default: typed}
+	default:
+		return &JSONSchema{}
+	}
+}
+
+// clearDefaults removes the defaults of a schema
+func clearDefaults(schema *JSONSchema) {
+	schema.Default = nil
+	for _, property := range schema.Properties {
+		clearDefaults(property)
+	}
+	for _, item := range schema.PrefixItems {
+		clearDefaults(item)
+	}
+	if schema.Items != nil {
+		clearDefaults(schema.Items)
+	}
+}
+
+// mergeDefaults sets the current values as defaults of a schema. The fields not declared in the schema are inferred.
+func mergeDefaults(schema *JSONSchema, value interface{}) *JSONSchema {
+	if value == nil {
+		return schema
+	}
+	valueMap, isMap := value.(map[string]interface{})
+	if !isMap || schema.Type != "object" {
+		schema.Default = value
+		return schema
+	}
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*JSONSchema, 0)
+	}
+	for key, field := range valueMap {
+		if property, exists := schema.Properties[key]; exists {
+			schema.Properties[key] = mergeDefaults(property, field)
+		} else {
+			schema.Properties[key] = inferSchema(field)
+		}
+	}
+	return schema
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"encoding/json"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const documentedComponentDefinition = `
+apiVersion: core.oam.dev/v1beta1
+kind: ComponentDefinition
+metadata:
+  name: simple-service
+spec:
+  schematic:
+    cue:
+      template: |
+        output: {
+          apiVersion: "apps/v1"
+          kind:       "Deployment"
+          metadata: name: context.name
+          spec: template: spec: containers: [{
+            name:  context.name
+            image: parameter.image
+          }]
+        }
+        parameter: {
+          // +usage=Image of the container
+          image: string
+          // +usage=Port exposed by the service
+          port: *80 | int
+          protocol: *"TCP" | "UDP"
+          env?: [...{name: string, value: string}]
+        }
+`
+
+var _ = ginkgo.Describe("Parameters tests", func() {
+
+	ginkgo.It("Should be able to return the parameters in JSON", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(fileWithWorkflow)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		parameters, err := app.GetParametersJSON()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parameters).Should(gomega.HaveKey("appWithWorkflow"))
+
+		var document map[string]interface{}
+		gomega.Expect(json.Unmarshal([]byte(parameters["appWithWorkflow"]), &document)).Should(gomega.Succeed())
+		gomega.Expect(document["components"]).Should(gomega.HaveLen(2))
+
+		// the JSON document can be applied as parameters
+		gomega.Expect(app.ApplyParameters("appWithWorkflow", "", parameters["appWithWorkflow"])).Should(gomega.Succeed())
+		components, err := app.GetComponents("appWithWorkflow")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components).Should(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("Should be able to infer the schema from the current values", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		schemas, err := app.GetParametersSchema()
+		gomega.Expect(err).Should(gomega.Succeed())
+		schema := schemas["application"]
+		gomega.Expect(schema.Schema).Should(gomega.Equal(jsonSchemaVersion))
+
+		components := schema.Properties["components"]
+		gomega.Expect(components.PrefixItems).Should(gomega.HaveLen(1))
+		properties := components.PrefixItems[0].Properties["properties"]
+		gomega.Expect(properties.Properties["image"].Type).Should(gomega.Equal("string"))
+		gomega.Expect(properties.Properties["image"].Default).Should(gomega.Equal("nginx:1.20.0"))
+		port := properties.Properties["ports"].PrefixItems[0].Properties["port"]
+		gomega.Expect(port.Type).Should(gomega.Equal("integer"))
+
+		_, err = json.Marshal(schema)
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to use the bundled definitions in the schema", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(customApplication)},
+			{FileName: "component.yaml", Content: []byte(documentedComponentDefinition)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		schemas, err := app.GetParametersSchema()
+		gomega.Expect(err).Should(gomega.Succeed())
+		properties := schemas["custom"].Properties["components"].PrefixItems[0].Properties["properties"]
+		gomega.Expect(properties.Required).Should(gomega.ConsistOf("image"))
+		gomega.Expect(properties.Properties["image"].Description).Should(gomega.Equal("Image of the container"))
+		gomega.Expect(properties.Properties["image"].Default).Should(gomega.Equal("nginx:1.20.0"))
+		gomega.Expect(properties.Properties["port"].Type).Should(gomega.Equal("integer"))
+		gomega.Expect(properties.Properties["port"].Default).Should(gomega.Equal(float64(8080)))
+		gomega.Expect(properties.Properties["protocol"].Enum).Should(gomega.ConsistOf("TCP", "UDP"))
+		gomega.Expect(properties.Properties["env"].Type).Should(gomega.Equal("array"))
+		gomega.Expect(properties.Properties["env"].Items.Type).Should(gomega.Equal("object"))
+	})
+})
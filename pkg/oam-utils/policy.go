@@ -0,0 +1,437 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// PrivilegedRule reports the containers running in privileged mode
+	PrivilegedRule = "privileged"
+	// HostPathRule reports the volumes that mount a path of the host not allowed by the policy
+	HostPathRule = "host-path"
+	// HostNetworkRule reports the pods that use the network of the host
+	HostNetworkRule = "host-network"
+	// RunAsRootRule reports the containers that may run as root (runAsNonRoot is not set and runAsUser is not set or is 0)
+	RunAsRootRule = "run-as-root"
+	// MissingResourceLimitsRule reports the containers without cpu or memory limits
+	MissingResourceLimitsRule = "missing-resource-limits"
+	// WildcardRBACRule reports the Roles and ClusterRoles with * in the apiGroups, resources or verbs of a rule
+	WildcardRBACRule = "wildcard-rbac"
+)
+
+const (
+	// ErrorSeverity is used by the violations that must block the application
+	ErrorSeverity = "error"
+	// WarningSeverity is used by the violations that should be reviewed
+	WarningSeverity = "warning"
+)
+
+// defaultRuleSeverities with the severity of the rules if the policy does not change it
+var defaultRuleSeverities = map[string]string{
+	PrivilegedRule:            ErrorSeverity,
+	HostPathRule:              ErrorSeverity,
+	HostNetworkRule:           ErrorSeverity,
+	RunAsRootRule:             WarningSeverity,
+	MissingResourceLimitsRule: WarningSeverity,
+	WildcardRBACRule:          ErrorSeverity,
+}
+
+// podSpecPaths with the location of the pod spec in the Kubernetes workloads indexed by kind
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// rbacRoleKinds with the kinds of the RBAC roles
+var rbacRoleKinds = map[string]bool{
+	"Role":        true,
+	"ClusterRole": true,
+}
+
+// RuleConfig with the configuration of a rule in a security policy
+type RuleConfig struct {
+	// Disabled is true if the rule is not checked
+	Disabled bool `json:"disabled,omitempty"`
+	// Severity overrides the default severity of the rule (error or warning)
+	Severity string `json:"severity,omitempty"`
+}
+
+// SecurityPolicy with the security rules checked in the workloads of an application. The zero value checks all
+// the rules with their default severity.
+type SecurityPolicy struct {
+	// Rules with the configuration of the rules indexed by rule name
+	Rules map[string]RuleConfig `json:"rules,omitempty"`
+	// AllowedHostPaths with the host paths (and their subdirectories) that can be mounted
+	AllowedHostPaths []string `json:"allowedHostPaths,omitempty"`
+}
+
+// PolicyViolation with a breach of a security rule and its location
+type PolicyViolation struct {
+	// Rule with the name of the rule
+	Rule string
+	// Severity of the violation (error or warning)
+	Severity string
+	// Message describing the violation
+	Message string
+	// Application with the name of the OAM application (empty if the violation is in an entity)
+	Application string
+	// Component with the name of the component (empty if the violation is in an entity)
+	Component string
+	// EntityKind with the kind of the entity or of the resource generated by the component
+	EntityKind string
+	// EntityName with the name of the entity or of the resource generated by the component
+	EntityName string
+	// Path with the location of the violation in the entity or the component
+	// (e.g. spec.template.spec.containers[0].securityContext.privileged)
+	Path string
+}
+
+// NewSecurityPolicy reads a security policy from YAML or JSON. For example:
+//
+//	rules:
+//	  run-as-root:
+//	    severity: error
+//	  missing-resource-limits:
+//	    disabled: true
+//	allowedHostPaths:
+//	- /var/log
+func NewSecurityPolicy(content []byte) (*SecurityPolicy, error) {
+	policy := &SecurityPolicy{}
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, nerrors.NewInvalidArgumentError("invalid security policy: %s", err.Error())
+	}
+	for rule, config := range policy.Rules {
+		if _, exists := defaultRuleSeverities[rule]; !exists {
+			return nil, nerrors.NewInvalidArgumentError("invalid security policy: unknown rule %s", rule)
+		}
+		if config.Severity != "" && config.Severity != ErrorSeverity && config.Severity != WarningSeverity {
+			return nil, nerrors.NewInvalidArgumentError("invalid security policy: invalid severity %s of rule %s", config.Severity, rule)
+		}
+	}
+	return policy, nil
+}
+
+// severity returns the severity of a rule, or an empty string if the rule is disabled
+func (sp *SecurityPolicy) severity(rule string) string {
+	config := sp.Rules[rule]
+	if config.Disabled {
+		return ""
+	}
+	if config.Severity != "" {
+		return config.Severity
+	}
+	return defaultRuleSeverities[rule]
+}
+
+// isAllowedHostPath returns true if a host path can be mounted
+func (sp *SecurityPolicy) isAllowedHostPath(path string) bool {
+	for _, allowed := range sp.AllowedHostPaths {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if path == allowed || strings.HasPrefix(path, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSecurityPolicy evaluates the workloads of the application against the rules of a security policy.
+// The components whose definitions (and trait definitions) are bundled in the application are rendered and
+// the generated resources are checked; the rest of the components are checked using the properties of the
+// webservice and worker types. The bundled entities are checked as they are. A nil policy checks all the rules
+// with their default severity.
+func (a *Application) CheckSecurityPolicy(policy *SecurityPolicy) ([]*PolicyViolation, error) {
+	return a.CheckSecurityPolicyContext(context.Background(), policy)
+}
+
+// CheckSecurityPolicyContext is CheckSecurityPolicy with a context. The context is checked before checking each
+// component and entity, and the Canceled or DeadlineExceeded error is returned when it is done.
+func (a *Application) CheckSecurityPolicyContext(ctx context.Context, policy *SecurityPolicy) ([]*PolicyViolation, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if policy == nil {
+		policy = &SecurityPolicy{}
+	}
+	definitions, err := a.getDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	violations := make([]*PolicyViolation, 0)
+
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		app := a.apps[appName]
+		components, err := app.getComponents()
+		if err != nil {
+			return nil, err
+		}
+		for i, component := range components {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			report := func(violation *PolicyViolation) {
+				violation.Application = app.Metadata.Name
+				violation.Component = component.Name
+				violations = append(violations, violation)
+			}
+			if !isRenderable(component, definitions) {
+				checkComponentProperties(policy, component, fmt.Sprintf("spec.components[%d].properties", i), report)
+				continue
+			}
+			rendered, err := renderComponent(app.Metadata.Name, component, definitions)
+			if err != nil {
+				return nil, err
+			}
+			if rendered.Output != nil {
+				checkResource(policy, rendered.Output.Object, "output", report)
+			}
+			outputNames := make([]string, 0, len(rendered.Outputs))
+			for name := range rendered.Outputs {
+				outputNames = append(outputNames, name)
+			}
+			sort.Strings(outputNames)
+			for _, name := range outputNames {
+				checkResource(policy, rendered.Outputs[name].Object, fmt.Sprintf("outputs.%s", name), report)
+			}
+		}
+	}
+
+	for _, entity := range a.entities {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		_, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading entity")
+		}
+		checkResource(policy, obj.Object, "", func(violation *PolicyViolation) {
+			violations = append(violations, violation)
+		})
+	}
+	return violations, nil
+}
+
+// isRenderable returns true if the definitions of a component and its traits are bundled in the application
+func isRenderable(component Component, definitions map[string]map[string]*Definition) bool {
+	if _, exists := definitions[componentDefinitionGVK[0].Kind][component.Type]; !exists {
+		return false
+	}
+	for _, trait := range component.Traits {
+		if _, exists := definitions[traitDefinitionGVK[0].Kind][trait.Type]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// checkComponentProperties checks the properties of the webservice and worker components
+func checkComponentProperties(policy *SecurityPolicy, component Component, path string, report func(*PolicyViolation)) {
+	if component.Type != webserviceComponentType && component.Type != workerComponentType {
+		return
+	}
+	if severity := policy.severity(MissingResourceLimitsRule); severity != "" {
+		for _, resource := range []string{"cpu", "memory"} {
+			if _, exists := component.Properties[resource]; !exists {
+				report(&PolicyViolation{
+					Rule:     MissingResourceLimitsRule,
+					Severity: severity,
+					Message:  fmt.Sprintf("component %s without %s limit", component.Name, resource),
+					Path:     joinPath(path, resource),
+				})
+			}
+		}
+	}
+	if severity := policy.severity(HostPathRule); severity != "" {
+		volumeMounts, _ := component.Properties["volumeMounts"].(map[string]interface{})
+		hostPaths, _ := volumeMounts["hostPath"].([]interface{})
+		for i, volume := range hostPaths {
+			volumeMap, _ := volume.(map[string]interface{})
+			hostPath, _ := volumeMap["path"].(string)
+			if !policy.isAllowedHostPath(hostPath) {
+				report(&PolicyViolation{
+					Rule:     HostPathRule,
+					Severity: severity,
+					Message:  fmt.Sprintf("host path %s is not allowed", hostPath),
+					Path:     fmt.Sprintf("%s.volumeMounts.hostPath[%d].path", path, i),
+				})
+			}
+		}
+	}
+}
+
+// checkResource checks a Kubernetes resource: the pod spec of the workloads and the rules of the RBAC roles
+func checkResource(policy *SecurityPolicy, resource map[string]interface{}, path string, report func(*PolicyViolation)) {
+	kind, _ := resource["kind"].(string)
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	locatedReport := func(violation *PolicyViolation) {
+		violation.EntityKind = kind
+		violation.EntityName = name
+		report(violation)
+	}
+
+	if rbacRoleKinds[kind] {
+		checkRBACRules(policy, resource, path, locatedReport)
+		return
+	}
+	specPath, isWorkload := podSpecPaths[kind]
+	if !isWorkload {
+		return
+	}
+	var podSpec interface{} = resource
+	for _, key := range specPath {
+		current, _ := podSpec.(map[string]interface{})
+		podSpec = current[key]
+		path = joinPath(path, key)
+	}
+	if podSpecMap, ok := podSpec.(map[string]interface{}); ok {
+		checkPodSpec(policy, podSpecMap, path, locatedReport)
+	}
+}
+
+// checkPodSpec checks the host settings, the volumes and the containers of a pod spec
+func checkPodSpec(policy *SecurityPolicy, podSpec map[string]interface{}, path string, report func(*PolicyViolation)) {
+	if severity := policy.severity(HostNetworkRule); severity != "" && podSpec["hostNetwork"] == true {
+		report(&PolicyViolation{
+			Rule:     HostNetworkRule,
+			Severity: severity,
+			Message:  "pod uses the host network",
+			Path:     joinPath(path, "hostNetwork"),
+		})
+	}
+
+	if severity := policy.severity(HostPathRule); severity != "" {
+		volumes, _ := podSpec["volumes"].([]interface{})
+		for i, volume := range volumes {
+			volumeMap, _ := volume.(map[string]interface{})
+			hostPath, isHostPath := volumeMap["hostPath"].(map[string]interface{})
+			if !isHostPath {
+				continue
+			}
+			mountedPath, _ := hostPath["path"].(string)
+			if !policy.isAllowedHostPath(mountedPath) {
+				report(&PolicyViolation{
+					Rule:     HostPathRule,
+					Severity: severity,
+					Message:  fmt.Sprintf("host path %s is not allowed", mountedPath),
+					Path:     fmt.Sprintf("%s.volumes[%d].hostPath.path", path, i),
+				})
+			}
+		}
+	}
+
+	podSecurityContext, _ := podSpec["securityContext"].(map[string]interface{})
+	for _, listKey := range []string{"initContainers", "containers"} {
+		containers, _ := podSpec[listKey].([]interface{})
+		for i, container := range containers {
+			if containerMap, ok := container.(map[string]interface{}); ok {
+				checkContainer(policy, containerMap, podSecurityContext, fmt.Sprintf("%s.%s[%d]", path, listKey, i), report)
+			}
+		}
+	}
+}
+
+// checkContainer checks the security context and the resources of a container
+func checkContainer(policy *SecurityPolicy, container map[string]interface{}, podSecurityContext map[string]interface{}, path string, report func(*PolicyViolation)) {
+	containerName, _ := container["name"].(string)
+	securityContext, _ := container["securityContext"].(map[string]interface{})
+
+	if severity := policy.severity(PrivilegedRule); severity != "" && securityContext["privileged"] == true {
+		report(&PolicyViolation{
+			Rule:     PrivilegedRule,
+			Severity: severity,
+			Message:  fmt.Sprintf("container %s runs in privileged mode", containerName),
+			Path:     joinPath(path, "securityContext.privileged"),
+		})
+	}
+
+	if severity := policy.severity(RunAsRootRule); severity != "" {
+		runAsNonRoot, runAsUser := podSecurityContext["runAsNonRoot"], podSecurityContext["runAsUser"]
+		if value, exists := securityContext["runAsNonRoot"]; exists {
+			runAsNonRoot = value
+		}
+		if value, exists := securityContext["runAsUser"]; exists {
+			runAsUser = value
+		}
+		isRoot := runAsUser != nil && fmt.Sprint(runAsUser) == "0"
+		if isRoot || (runAsNonRoot != true && runAsUser == nil) {
+			report(&PolicyViolation{
+				Rule:     RunAsRootRule,
+				Severity: severity,
+				Message:  fmt.Sprintf("container %s may run as root", containerName),
+				Path:     joinPath(path, "securityContext"),
+			})
+		}
+	}
+
+	if severity := policy.severity(MissingResourceLimitsRule); severity != "" {
+		resources, _ := container["resources"].(map[string]interface{})
+		limits, _ := resources["limits"].(map[string]interface{})
+		for _, resource := range []string{"cpu", "memory"} {
+			if _, exists := limits[resource]; !exists {
+				report(&PolicyViolation{
+					Rule:     MissingResourceLimitsRule,
+					Severity: severity,
+					Message:  fmt.Sprintf("container %s without %s limit", containerName, resource),
+					Path:     joinPath(path, "resources.limits."+resource),
+				})
+			}
+		}
+	}
+}
+
+// checkRBACRules checks the rules of a Role or a ClusterRole
+func checkRBACRules(policy *SecurityPolicy, role map[string]interface{}, path string, report func(*PolicyViolation)) {
+	severity := policy.severity(WildcardRBACRule)
+	if severity == "" {
+		return
+	}
+	rules, _ := role["rules"].([]interface{})
+	for i, rule := range rules {
+		ruleMap, _ := rule.(map[string]interface{})
+		for _, field := range []string{"apiGroups", "resources", "verbs"} {
+			values, _ := ruleMap[field].([]interface{})
+			for _, value := range values {
+				if value == "*" {
+					report(&PolicyViolation{
+						Rule:     WildcardRBACRule,
+						Severity: severity,
+						Message:  fmt.Sprintf("rule with * in %s", field),
+						Path:     fmt.Sprintf("%s.%s", joinPath(path, fmt.Sprintf("rules[%d]", i)), field),
+					})
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const insecureEntities = `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    spec:
+      hostNetwork: true
+      securityContext:
+        runAsNonRoot: true
+      volumes:
+      - name: logs
+        hostPath:
+          path: /var/log/pods
+      - name: docker
+        hostPath:
+          path: /var/run/docker.sock
+      containers:
+      - name: agent
+        image: agent:1.0.0
+        securityContext:
+          privileged: true
+        resources:
+          limits:
+            cpu: 100m
+            memory: 128Mi
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: agent
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list"]
+- apiGroups: ["*"]
+  resources: ["*"]
+  verbs: ["get"]
+`
+
+// violationKeys returns the rule and location of the violations
+func violationKeys(violations []*PolicyViolation) []string {
+	keys := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		location := violation.EntityKind + "/" + violation.EntityName
+		if violation.Component != "" {
+			location = violation.Component + ":" + location
+		}
+		keys = append(keys, violation.Rule+" "+violation.Severity+" "+location+" "+violation.Path)
+	}
+	return keys
+}
+
+var _ = ginkgo.Describe("Security policy tests", func() {
+
+	ginkgo.It("Should check the bundled entities", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(insecureEntities)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		violations, err := app.CheckSecurityPolicy(nil)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(violationKeys(violations)).Should(gomega.ConsistOf(
+			"host-network error DaemonSet/agent spec.template.spec.hostNetwork",
+			"host-path error DaemonSet/agent spec.template.spec.volumes[0].hostPath.path",
+			"host-path error DaemonSet/agent spec.template.spec.volumes[1].hostPath.path",
+			"privileged error DaemonSet/agent spec.template.spec.containers[0].securityContext.privileged",
+			"wildcard-rbac error ClusterRole/agent rules[1].apiGroups",
+			"wildcard-rbac error ClusterRole/agent rules[1].resources",
+		))
+	})
+
+	ginkgo.It("Should apply the configuration of the policy", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(insecureEntities)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		policy, err := NewSecurityPolicy([]byte(`
+rules:
+  host-network:
+    disabled: true
+  wildcard-rbac:
+    severity: warning
+allowedHostPaths:
+- /var/log/
+`))
+		gomega.Expect(err).Should(gomega.Succeed())
+		violations, err := app.CheckSecurityPolicy(policy)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(violationKeys(violations)).Should(gomega.ConsistOf(
+			"host-path error DaemonSet/agent spec.template.spec.volumes[1].hostPath.path",
+			"privileged error DaemonSet/agent spec.template.spec.containers[0].securityContext.privileged",
+			"wildcard-rbac warning ClusterRole/agent rules[1].apiGroups",
+			"wildcard-rbac warning ClusterRole/agent rules[1].resources",
+		))
+	})
+
+	ginkgo.It("Should fail with invalid policies", func() {
+		_, err := NewSecurityPolicy([]byte("rules:\n  unknown: {}\n"))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		_, err = NewSecurityPolicy([]byte("rules:\n  privileged:\n    severity: fatal\n"))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should check the rendered components", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(customApplication)},
+			{FileName: "component.yaml", Content: []byte(componentDefinition)},
+			{FileName: "trait.yaml", Content: []byte(traitDefinition)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		violations, err := app.CheckSecurityPolicy(&SecurityPolicy{})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(violationKeys(violations)).Should(gomega.ConsistOf(
+			"run-as-root warning frontend:Deployment/frontend output.spec.template.spec.containers[0].securityContext",
+			"missing-resource-limits warning frontend:Deployment/frontend output.spec.template.spec.containers[0].resources.limits.cpu",
+			"missing-resource-limits warning frontend:Deployment/frontend output.spec.template.spec.containers[0].resources.limits.memory",
+		))
+		gomega.Expect(violations[0].Application).Should(gomega.Equal("custom"))
+	})
+
+	ginkgo.It("Should check the properties of the built-in components", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		violations, err := app.CheckSecurityPolicy(nil)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(violationKeys(violations)).Should(gomega.ConsistOf(
+			"missing-resource-limits warning component1:/ spec.components[0].properties.cpu",
+			"missing-resource-limits warning component1:/ spec.components[0].properties.memory",
+		))
+	})
+})
@@ -0,0 +1,468 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// EntitiesAnnotation with the annotation of the OAM applications that lists the bundled entities they use
+	// separated by commas (e.g. "ConfigMap/settings, Secret/credentials")
+	EntitiesAnnotation = "oam-utils.napptive.com/entities"
+	// ApplicationsAnnotation with the annotation of the entities that lists the OAM applications that use them
+	// separated by commas
+	ApplicationsAnnotation = "oam-utils.napptive.com/applications"
+)
+
+const (
+	configMapKind                = "ConfigMap"
+	secretKind                   = "Secret"
+	persistentVolumeClaimKind    = "PersistentVolumeClaim"
+	customResourceDefinitionKind = "CustomResourceDefinition"
+	// storageTrait with the type of the trait that mounts ConfigMaps, Secrets and PVCs, creating them unless
+	// mountOnly is set
+	storageTrait = "storage"
+	// imagePullSecretsKey with the field that contains the secrets used to pull the images
+	imagePullSecretsKey = "imagePullSecrets"
+)
+
+// referenceNameKeys with the fields whose value is the name of an entity indexed by field name
+var referenceNameKeys = map[string]string{
+	"cmName":        configMapKind,
+	"configMapName": configMapKind,
+	"secretName":    secretKind,
+	"claimName":     persistentVolumeClaimKind,
+}
+
+// referenceObjectKeys with the fields whose value is an object with the name of an entity (e.g. the
+// configMapKeyRef of an environment variable or the configMap of a volume) indexed by field name
+var referenceObjectKeys = map[string]string{
+	"configMap":       configMapKind,
+	"configMapRef":    configMapKind,
+	"configMapKeyRef": configMapKind,
+	"secretRef":       secretKind,
+	"secretKeyRef":    secretKind,
+}
+
+// storageTraitKeys with the lists of the storage trait indexed by the kind of their entities
+var storageTraitKeys = map[string]string{
+	"configMap": configMapKind,
+	"secret":    secretKind,
+	"pvc":       persistentVolumeClaimKind,
+}
+
+// EntityID identifies a bundled entity
+type EntityID struct {
+	// Kind of the entity
+	Kind string
+	// Name of the entity
+	Name string
+}
+
+// String returns the entity as Kind/name
+func (id EntityID) String() string {
+	return fmt.Sprintf("%s/%s", id.Kind, id.Name)
+}
+
+// EntityReference with a reference of an OAM application to an entity
+type EntityReference struct {
+	// Application with the name of the OAM application
+	Application string
+	// Component with the name of the component (empty if the reference is an annotation of the application)
+	Component string
+	// Kind of the referenced entity
+	Kind string
+	// Name of the referenced entity
+	Name string
+	// Path with the location of the reference in the application (e.g. spec.components[0].properties.env[0].valueFrom.secretKeyRef.name)
+	Path string
+}
+
+// EntityResolution with the relationship between the OAM applications and the bundled entities
+type EntityResolution struct {
+	// References with the references to entities found in the OAM applications
+	References []*EntityReference
+	// Entities with the bundled entities used by each OAM application indexed by application name
+	Entities map[string][]EntityID
+	// Orphaned with the bundled entities that are not used by any OAM application
+	Orphaned []EntityID
+	// Missing with the references to entities that are not bundled in the catalog application
+	Missing []*EntityReference
+}
+
+// ResolveEntities returns the bundled entities used by each OAM application. An application uses:
+//   - The entities referenced by its components, traits, policies and workflow steps: ConfigMaps and Secrets of
+//     environment variables and volumes, image pull secrets, persistent volume claims, and the existing entities
+//     mounted by the storage trait.
+//   - The entities listed in its EntitiesAnnotation, and the entities whose ApplicationsAnnotation includes it.
+//   - The definitions of its component, trait, policy and workflow step types.
+//   - The CustomResourceDefinitions of the custom resources it uses and of the workloads of its component definitions.
+//
+// The references to entities that are not bundled (except the definitions of the types) are reported as missing,
+// and the entities that are not used by any application as orphaned.
+func (a *Application) ResolveEntities() (*EntityResolution, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.resolveEntities()
+}
+
+// bundledEntity with the information of an entity required to resolve the references
+type bundledEntity struct {
+	id  EntityID
+	gvk *schema.GroupVersionKind
+	obj *unstructured.Unstructured
+}
+
+// resolveEntities is ResolveEntities without locking the application
+func (a *Application) resolveEntities() (*EntityResolution, error) {
+	resolution := &EntityResolution{
+		References: make([]*EntityReference, 0),
+		Entities:   make(map[string][]EntityID, len(a.apps)),
+		Orphaned:   make([]EntityID, 0),
+		Missing:    make([]*EntityReference, 0),
+	}
+
+	entities := make([]*bundledEntity, 0, len(a.entities))
+	bundled := make(map[EntityID]bool, len(a.entities))
+	crds := make(map[schema.GroupKind]EntityID, 0)
+	for _, entity := range a.entities {
+		gvk, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading entity")
+		}
+		id := EntityID{Kind: gvk.Kind, Name: obj.GetName()}
+		entities = append(entities, &bundledEntity{id: id, gvk: gvk, obj: obj})
+		bundled[id] = true
+		if gvk.Kind == customResourceDefinitionKind {
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			crds[schema.GroupKind{Group: group, Kind: kind}] = id
+		}
+	}
+
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	used := make(map[EntityID]bool, len(entities))
+	for _, appName := range appNames {
+		app := a.apps[appName]
+		references, definitions, err := getEntityReferences(app)
+		if err != nil {
+			return nil, err
+		}
+		appEntities := make(map[EntityID]bool, 0)
+		for _, reference := range references {
+			resolution.References = append(resolution.References, reference)
+			id := EntityID{Kind: reference.Kind, Name: reference.Name}
+			if bundled[id] {
+				appEntities[id] = true
+			} else {
+				resolution.Missing = append(resolution.Missing, reference)
+			}
+		}
+		for _, entity := range entities {
+			if definitions[entity.id] && isOAMGroup(entity.gvk.Group) {
+				appEntities[entity.id] = true
+			}
+			for _, name := range splitAnnotation(entity.obj.GetAnnotations()[ApplicationsAnnotation]) {
+				if name == app.Metadata.Name {
+					appEntities[entity.id] = true
+				}
+			}
+		}
+		for _, entity := range entities {
+			if !appEntities[entity.id] {
+				continue
+			}
+			if crd, exists := crds[entity.gvk.GroupKind()]; exists {
+				appEntities[crd] = true
+			}
+			// the workload of a component definition might be a custom resource
+			if entity.gvk.Kind == componentDefinitionGVK[0].Kind && isOAMGroup(entity.gvk.Group) {
+				if crd, exists := crds[getWorkloadGroupKind(entity.obj)]; exists {
+					appEntities[crd] = true
+				}
+			}
+		}
+
+		// the entities are returned in the order of the catalog application
+		ids := make([]EntityID, 0, len(appEntities))
+		for _, entity := range entities {
+			if appEntities[entity.id] {
+				ids = append(ids, entity.id)
+				used[entity.id] = true
+			}
+		}
+		resolution.Entities[appName] = ids
+	}
+
+	for _, entity := range entities {
+		if !used[entity.id] {
+			resolution.Orphaned = append(resolution.Orphaned, entity.id)
+		}
+	}
+	return resolution, nil
+}
+
+// getEntityReferences returns the references to entities of an OAM application and the definitions of the types
+// it uses
+func getEntityReferences(app *ApplicationDefinition) ([]*EntityReference, map[EntityID]bool, error) {
+	references := make([]*EntityReference, 0)
+	definitions := make(map[EntityID]bool, 0)
+
+	for _, value := range splitAnnotation(app.Metadata.Annotations[EntitiesAnnotation]) {
+		parts := strings.SplitN(value, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, nerrors.NewInvalidArgumentError("invalid entity %s in the %s annotation of %s application, expected Kind/name", value, EntitiesAnnotation, app.Metadata.Name)
+		}
+		references = append(references, &EntityReference{
+			Application: app.Metadata.Name,
+			Kind:        parts[0],
+			Name:        parts[1],
+			Path:        fmt.Sprintf("metadata.annotations[%s]", EntitiesAnnotation),
+		})
+	}
+
+	var content map[string]interface{}
+	if err := convertToMap(app, &content); err != nil {
+		return nil, nil, err
+	}
+	walkApplicationReferences(content, func(component string, path string, kind string, name string) string {
+		references = append(references, &EntityReference{
+			Application: app.Metadata.Name,
+			Component:   component,
+			Kind:        kind,
+			Name:        name,
+			Path:        path,
+		})
+		return name
+	})
+	components, err := getRawComponents(app)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, raw := range components {
+		component, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if componentType, ok := component["type"].(string); ok {
+			definitions[EntityID{Kind: componentDefinitionGVK[0].Kind, Name: componentType}] = true
+		}
+		traits, _ := component["traits"].([]interface{})
+		for _, raw := range traits {
+			if trait, ok := raw.(map[string]interface{}); ok {
+				traitType, _ := trait["type"].(string)
+				definitions[EntityID{Kind: traitDefinitionGVK[0].Kind, Name: traitType}] = true
+			}
+		}
+	}
+
+	for _, policy := range app.Spec.Policies {
+		definitions[EntityID{Kind: policyDefinitionGVK[0].Kind, Name: policy.Type}] = true
+	}
+	if app.Spec.Workflow != nil && len(app.Spec.Workflow.Raw) > 0 {
+		var workflow struct {
+			Steps []struct {
+				Type string `json:"type"`
+			} `json:"steps"`
+		}
+		if err := json.Unmarshal(app.Spec.Workflow.Raw, &workflow); err != nil {
+			return nil, nil, nerrors.NewInternalErrorFrom(err, "error reading the workflow of %s application", app.Metadata.Name)
+		}
+		for _, step := range workflow.Steps {
+			definitions[EntityID{Kind: workflowStepDefinitionGVK[0].Kind, Name: step.Type}] = true
+		}
+	}
+	return references, definitions, nil
+}
+
+// walkApplicationReferences calls fn for each reference to an entity found in an OAM application: the properties
+// and the traits of its components, the properties of its policies and the properties of its workflow steps and
+// their sub-steps. The name of the entity is replaced with the returned value. The component is empty for the
+// references of the policies and the workflow.
+func walkApplicationReferences(app map[string]interface{}, fn func(component string, path string, kind string, name string) string) {
+	walkReference := func(path string, kind string, name string) string {
+		return fn("", path, kind, name)
+	}
+	if components, ok, _ := unstructured.NestedFieldNoCopy(app, "spec", "components"); ok {
+		if list, ok := components.([]interface{}); ok {
+			walkComponentsReferences(list, fn)
+		}
+	}
+	if policies, ok, _ := unstructured.NestedFieldNoCopy(app, "spec", "policies"); ok {
+		if list, ok := policies.([]interface{}); ok {
+			for i, raw := range list {
+				if policy, ok := raw.(map[string]interface{}); ok {
+					walkEntityReferences(policy["properties"], fmt.Sprintf("spec.policies[%d].properties", i), walkReference)
+				}
+			}
+		}
+	}
+	if steps, ok, _ := unstructured.NestedFieldNoCopy(app, "spec", "workflow", "steps"); ok {
+		if list, ok := steps.([]interface{}); ok {
+			for i, raw := range list {
+				step, ok := raw.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				path := fmt.Sprintf("spec.workflow.steps[%d]", i)
+				walkEntityReferences(step["properties"], joinPath(path, "properties"), walkReference)
+				subSteps, _ := step["subSteps"].([]interface{})
+				for j, raw := range subSteps {
+					if subStep, ok := raw.(map[string]interface{}); ok {
+						walkEntityReferences(subStep["properties"], fmt.Sprintf("%s.subSteps[%d].properties", path, j), walkReference)
+					}
+				}
+			}
+		}
+	}
+}
+
+// walkComponentsReferences calls fn for each reference to an entity found in the properties and the traits of the
+// components (spec.components) of an OAM application, replacing the name of the entity with the returned value
+func walkComponentsReferences(components []interface{}, fn func(component string, path string, kind string, name string) string) {
+	for i, raw := range components {
+		component, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		componentName, _ := component["name"].(string)
+		walkReference := func(path string, kind string, name string) string {
+			return fn(componentName, path, kind, name)
+		}
+		walkEntityReferences(component["properties"], fmt.Sprintf("spec.components[%d].properties", i), walkReference)
+		traits, _ := component["traits"].([]interface{})
+		for j, raw := range traits {
+			trait, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			path := fmt.Sprintf("spec.components[%d].traits[%d].properties", i, j)
+			if properties, ok := trait["properties"].(map[string]interface{}); ok && trait["type"] == storageTrait {
+				walkStorageReferences(properties, path, walkReference)
+				continue
+			}
+			walkEntityReferences(trait["properties"], path, walkReference)
+		}
+	}
+}
+
+// walkEntityReferences calls fn for each reference to an entity found in the properties of a component or a trait,
+// replacing the name of the entity with the returned value
+func walkEntityReferences(value interface{}, path string, fn func(path string, kind string, name string) string) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := joinPath(path, key)
+			if kind, isReference := referenceNameKeys[key]; isReference {
+				if name, ok := typed[key].(string); ok && name != "" {
+					typed[key] = fn(childPath, kind, name)
+					continue
+				}
+			}
+			if kind, isReference := referenceObjectKeys[key]; isReference {
+				if object, ok := typed[key].(map[string]interface{}); ok {
+					if name, ok := object["name"].(string); ok && name != "" {
+						object["name"] = fn(joinPath(childPath, "name"), kind, name)
+						continue
+					}
+				}
+			}
+			if list, ok := typed[key].([]interface{}); ok && key == imagePullSecretsKey {
+				for i, item := range list {
+					itemPath := fmt.Sprintf("%s[%d]", childPath, i)
+					if name, ok := item.(string); ok && name != "" {
+						list[i] = fn(itemPath, secretKind, name)
+					} else if object, ok := item.(map[string]interface{}); ok {
+						if name, ok := object["name"].(string); ok && name != "" {
+							object["name"] = fn(joinPath(itemPath, "name"), secretKind, name)
+						}
+					}
+				}
+				continue
+			}
+			walkEntityReferences(typed[key], childPath, fn)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			walkEntityReferences(child, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
+
+// walkStorageReferences calls fn for each existing entity mounted by a storage trait, replacing the name of the
+// entity with the returned value. The entities without mountOnly are created by the trait, so they are not references.
+func walkStorageReferences(properties map[string]interface{}, path string, fn func(path string, kind string, name string) string) {
+	keys := make([]string, 0, len(storageTraitKeys))
+	for key := range storageTraitKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		list, _ := properties[key].([]interface{})
+		for i, item := range list {
+			volume, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := volume["name"].(string)
+			if mountOnly, _ := volume["mountOnly"].(bool); mountOnly && name != "" {
+				volume["name"] = fn(fmt.Sprintf("%s.%s[%d].name", path, key, i), storageTraitKeys[key], name)
+			}
+		}
+	}
+}
+
+// getWorkloadGroupKind returns the group and kind of the workload of a component definition
+// (spec.workload.definition)
+func getWorkloadGroupKind(definition *unstructured.Unstructured) schema.GroupKind {
+	apiVersion, _, _ := unstructured.NestedString(definition.Object, "spec", "workload", "definition", "apiVersion")
+	kind, _, _ := unstructured.NestedString(definition.Object, "spec", "workload", "definition", "kind")
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil || kind == "" {
+		return schema.GroupKind{}
+	}
+	return schema.GroupKind{Group: groupVersion.Group, Kind: kind}
+}
+
+// splitAnnotation returns the values of an annotation separated by commas
+func splitAnnotation(annotation string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(annotation, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// referencingApplication with an application that references entities from its components, traits and annotations
+const referencingApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: refs-app
+  annotations:
+    oam-utils.napptive.com/entities: "Widget/sample"
+spec:
+  components:
+    - name: api
+      type: webservice
+      properties:
+        image: my-api:1.0.0
+        imagePullSecrets: ["registry"]
+        env:
+        - name: DB_PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: db-credentials
+              key: password
+        - name: LEVEL
+          valueFrom:
+            configMapKeyRef:
+              name: settings
+              key: level
+        volumeMounts:
+          pvc:
+          - name: data
+            mountPath: /data
+            claimName: data
+      traits:
+      - type: storage
+        properties:
+          configMap:
+          - name: shared-config
+            mountPath: /etc/shared
+            mountOnly: true
+          secret:
+          - name: generated
+            mountPath: /etc/generated
+`
+
+// referencedEntities with the entities bundled with referencingApplication
+const referencedEntities = `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db-credentials
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: orphan
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared-config
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: registry
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: sample
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: annotated
+  annotations:
+    oam-utils.napptive.com/applications: "other, refs-app"
+`
+
+// workflowApplication with an application that references entities from its policies and workflow steps and uses
+// a component definition whose workload is a custom resource
+const workflowApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: workflow-app
+spec:
+  components:
+    - name: widget
+      type: widget-component
+  policies:
+    - name: notify
+      type: notification
+      properties:
+        secretRef:
+          name: webhook
+  workflow:
+    steps:
+      - name: deploy
+        type: deploy
+        properties:
+          configMapName: deploy-settings
+      - name: group
+        type: step-group
+        subSteps:
+          - name: backup
+            type: backup
+            properties:
+              claimName: backups
+`
+
+// workflowEntities with the entities bundled with workflowApplication
+const workflowEntities = `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: webhook
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: deploy-settings
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: backups
+---
+apiVersion: core.oam.dev/v1beta1
+kind: ComponentDefinition
+metadata:
+  name: widget-component
+spec:
+  workload:
+    definition:
+      apiVersion: example.com/v1
+      kind: Widget
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+`
+
+var _ = ginkgo.Describe("Entity references tests", func() {
+
+	ginkgo.It("Should resolve the entities used by the applications", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(referencingApplication)},
+			{FileName: "entities.yaml", Content: []byte(referencedEntities)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		resolution, err := app.ResolveEntities()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(resolution.Entities).Should(gomega.Equal(map[string][]EntityID{"refs-app": {
+			{Kind: "Secret", Name: "db-credentials"},
+			{Kind: "ConfigMap", Name: "settings"},
+			{Kind: "ConfigMap", Name: "shared-config"},
+			{Kind: "Secret", Name: "registry"},
+			{Kind: "CustomResourceDefinition", Name: "widgets.example.com"},
+			{Kind: "Widget", Name: "sample"},
+			{Kind: "ConfigMap", Name: "annotated"},
+		}}))
+		gomega.Expect(resolution.Orphaned).Should(gomega.Equal([]EntityID{{Kind: "ConfigMap", Name: "orphan"}}))
+		gomega.Expect(resolution.Missing).Should(gomega.Equal([]*EntityReference{{
+			Application: "refs-app",
+			Component:   "api",
+			Kind:        "PersistentVolumeClaim",
+			Name:        "data",
+			Path:        "spec.components[0].properties.volumeMounts.pvc[0].claimName",
+		}}))
+		gomega.Expect(resolution.References).Should(gomega.ContainElement(&EntityReference{
+			Application: "refs-app",
+			Component:   "api",
+			Kind:        "Secret",
+			Name:        "db-credentials",
+			Path:        "spec.components[0].properties.env[0].valueFrom.secretKeyRef.name",
+		}))
+		gomega.Expect(resolution.References).Should(gomega.HaveLen(6))
+	})
+
+	ginkgo.It("Should include the definitions of the types used", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "apps.yaml", Content: []byte(completeApplication)},
+			{FileName: "definitions.yaml", Content: []byte(packageDefinitions)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		resolution, err := app.ResolveEntities()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(resolution.Entities["app1"]).Should(gomega.BeEmpty())
+		gomega.Expect(resolution.Entities["app2"]).Should(gomega.Equal([]EntityID{
+			{Kind: "ComponentDefinition", Name: "worker"}, {Kind: "TraitDefinition", Name: "scaler"}}))
+		gomega.Expect(resolution.Orphaned).Should(gomega.Equal([]EntityID{
+			{Kind: "ConfigMap", Name: "cm-test"}, {Kind: "ComponentDefinition", Name: "unused"}}))
+		gomega.Expect(resolution.Missing).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("Should resolve the entities used by the policies, the workflow and the workloads", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(workflowApplication)},
+			{FileName: "entities.yaml", Content: []byte(workflowEntities)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		resolution, err := app.ResolveEntities()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(resolution.Entities).Should(gomega.Equal(map[string][]EntityID{"workflow-app": {
+			{Kind: "Secret", Name: "webhook"},
+			{Kind: "ConfigMap", Name: "deploy-settings"},
+			{Kind: "PersistentVolumeClaim", Name: "backups"},
+			{Kind: "ComponentDefinition", Name: "widget-component"},
+			{Kind: "CustomResourceDefinition", Name: "widgets.example.com"},
+		}}))
+		gomega.Expect(resolution.Orphaned).Should(gomega.BeEmpty())
+		gomega.Expect(resolution.Missing).Should(gomega.BeEmpty())
+		gomega.Expect(resolution.References).Should(gomega.ContainElement(&EntityReference{
+			Application: "workflow-app",
+			Kind:        "PersistentVolumeClaim",
+			Name:        "backups",
+			Path:        "spec.workflow.steps[1].subSteps[0].properties.claimName",
+		}))
+	})
+
+	ginkgo.It("Should extract an application with the entities it uses", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(referencingApplication)},
+			{FileName: "apps.yaml", Content: []byte(completeApplication)},
+			{FileName: "entities.yaml", Content: []byte(referencedEntities)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		extracted, err := app.Extract("refs-app")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entityNames(extracted)).Should(gomega.Equal([]string{
+			"db-credentials", "settings", "shared-config", "registry", "widgets.example.com", "sample", "annotated"}))
+		extracted, err = app.Extract("app1")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(extracted.entities).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("Should fail with invalid entities annotations", func() {
+		app, err := NewApplication([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(strings.Replace(referencingApplication, "Widget/sample", "sample", 1))}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = app.ResolveEntities()
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+})
@@ -0,0 +1,316 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"context"
+	"encoding/json"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// defaultRenderNamespace with the namespace passed to the templates in context.namespace
+const defaultRenderNamespace = "default"
+
+// Definition with a ComponentDefinition or a TraitDefinition bundled in the catalog application
+type Definition struct {
+	// Name of the definition (the type used in the components or traits)
+	Name string
+	// Kind of the definition (ComponentDefinition or TraitDefinition)
+	Kind string
+	// Template with the CUE template of the definition
+	Template string
+}
+
+// RenderedComponent with the resources generated by a component
+type RenderedComponent struct {
+	// Name of the component
+	Name string
+	// Type of the component
+	Type string
+	// Output with the workload generated by the component
+	Output *unstructured.Unstructured
+	// Outputs with the auxiliary resources generated by the component and its traits indexed by output name
+	Outputs map[string]*unstructured.Unstructured
+}
+
+// GetDefinitions returns the component and trait definitions bundled in the application indexed by kind and name
+func (a *Application) GetDefinitions() (map[string]map[string]*Definition, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.getDefinitions()
+}
+
+// getDefinitions is GetDefinitions without locking the application
+func (a *Application) getDefinitions() (map[string]map[string]*Definition, error) {
+	definitions := map[string]map[string]*Definition{
+		componentDefinitionGVK[0].Kind: {},
+		traitDefinitionGVK[0].Kind:     {},
+	}
+	for _, entity := range a.entities {
+		gvk, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading definitions")
+		}
+		if !validateType(gvk, componentDefinitionGVK) && !validateType(gvk, traitDefinitionGVK) {
+			continue
+		}
+		template, found, err := unstructured.NestedString(obj.Object, "spec", "schematic", "cue", "template")
+		if err != nil || !found {
+			a.getLogger().Warn().Str("kind", gvk.Kind).Str("name", obj.GetName()).Msg("definition without cue template")
+			continue
+		}
+		definitions[gvk.Kind][obj.GetName()] = &Definition{
+			Name:     obj.GetName(),
+			Kind:     gvk.Kind,
+			Template: template,
+		}
+	}
+	return definitions, nil
+}
+
+// Render evaluates the definitions bundled in the catalog application and returns the resources
+// generated by the components indexed by application name
+func (a *Application) Render() (map[string][]*RenderedComponent, error) {
+	return a.RenderContext(context.Background())
+}
+
+// RenderContext is Render with a context. The context is checked before rendering each component, and the
+// Canceled or DeadlineExceeded error is returned when it is done.
+func (a *Application) RenderContext(ctx context.Context) (map[string][]*RenderedComponent, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	rendered := make(map[string][]*RenderedComponent, 0)
+	for appName := range a.apps {
+		components, err := a.renderApplication(ctx, appName)
+		if err != nil {
+			return nil, err
+		}
+		rendered[appName] = components
+	}
+	return rendered, nil
+}
+
+// RenderApplication evaluates the definitions bundled in the catalog application and returns the resources
+// generated by the components of the application named `applicationName`
+func (a *Application) RenderApplication(applicationName string) ([]*RenderedComponent, error) {
+	return a.RenderApplicationContext(context.Background(), applicationName)
+}
+
+// RenderApplicationContext is RenderApplication with a context. The context is checked before rendering each
+// component, and the Canceled or DeadlineExceeded error is returned when it is done.
+func (a *Application) RenderApplicationContext(ctx context.Context, applicationName string) ([]*RenderedComponent, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.renderApplication(ctx, applicationName)
+}
+
+// renderApplication is RenderApplicationContext without locking the application
+func (a *Application) renderApplication(ctx context.Context, applicationName string) ([]*RenderedComponent, error) {
+	app, exists := a.apps[applicationName]
+	if !exists {
+		return nil, nerrors.NewNotFoundError("application %s not found", applicationName)
+	}
+	definitions, err := a.getDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	components, err := app.getComponents()
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]*RenderedComponent, 0)
+	for _, component := range components {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		result, err := renderComponent(app.Metadata.Name, component, definitions)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, result)
+	}
+	return rendered, nil
+}
+
+// renderComponent evaluates the definition of a component and the definitions of its traits
+func renderComponent(appName string, component Component, definitions map[string]map[string]*Definition) (*RenderedComponent, error) {
+	definition, exists := definitions[componentDefinitionGVK[0].Kind][component.Type]
+	if !exists {
+		return nil, nerrors.NewNotFoundError("component definition %s not found in the application", component.Type)
+	}
+
+	cueCtx := cuecontext.New()
+	templateContext := map[string]interface{}{
+		"name":      component.Name,
+		"appName":   appName,
+		"namespace": defaultRenderNamespace,
+	}
+	value, err := evaluateTemplate(cueCtx, definition.Template, component.Properties, templateContext)
+	if err != nil {
+		return nil, nerrors.NewInternalError("error rendering component %s: %s", component.Name, err.Error())
+	}
+
+	output := value.LookupPath(cue.ParsePath("output"))
+	outputs := make(map[string]cue.Value, 0)
+	if err := collectOutputs(value, outputs); err != nil {
+		return nil, nerrors.NewInternalError("error rendering component %s: %s", component.Name, err.Error())
+	}
+
+	for _, trait := range component.Traits {
+		traitDefinition, exists := definitions[traitDefinitionGVK[0].Kind][trait.Type]
+		if !exists {
+			return nil, nerrors.NewNotFoundError("trait definition %s not found in the application", trait.Type)
+		}
+		traitContext := map[string]interface{}{
+			"name":      component.Name,
+			"appName":   appName,
+			"namespace": defaultRenderNamespace,
+		}
+		if output.Exists() {
+			workload, err := toInterface(output)
+			if err != nil {
+				return nil, nerrors.NewInternalError("error rendering trait %s of component %s: %s", trait.Type, component.Name, err.Error())
+			}
+			traitContext["output"] = workload
+		}
+		traitValue, err := evaluateTemplate(cueCtx, traitDefinition.Template, trait.Properties, traitContext)
+		if err != nil {
+			return nil, nerrors.NewInternalError("error rendering trait %s of component %s: %s", trait.Type, component.Name, err.Error())
+		}
+		if patch := traitValue.LookupPath(cue.ParsePath("patch")); patch.Exists() && output.Exists() {
+			output = output.Unify(patch)
+			if err := output.Err(); err != nil {
+				return nil, nerrors.NewInternalError("error patching component %s with trait %s: %s", component.Name, trait.Type, err.Error())
+			}
+		}
+		if err := collectOutputs(traitValue, outputs); err != nil {
+			return nil, nerrors.NewInternalError("error rendering trait %s of component %s: %s", trait.Type, component.Name, err.Error())
+		}
+	}
+
+	result := &RenderedComponent{
+		Name:    component.Name,
+		Type:    component.Type,
+		Outputs: make(map[string]*unstructured.Unstructured, 0),
+	}
+	if output.Exists() {
+		obj, err := toUnstructured(output)
+		if err != nil {
+			return nil, nerrors.NewInternalError("error rendering output of component %s: %s", component.Name, err.Error())
+		}
+		result.Output = obj
+	}
+	for name, value := range outputs {
+		obj, err := toUnstructured(value)
+		if err != nil {
+			return nil, nerrors.NewInternalError("error rendering output %s of component %s: %s", name, component.Name, err.Error())
+		}
+		result.Outputs[name] = obj
+	}
+	return result, nil
+}
+
+// evaluateTemplate compiles a CUE template filling the parameter and the context values
+func evaluateTemplate(cueCtx *cue.Context, template string, parameters map[string]interface{}, templateContext map[string]interface{}) (cue.Value, error) {
+	if parameters == nil {
+		parameters = make(map[string]interface{}, 0)
+	}
+	scope, err := encodeValue(cueCtx, map[string]interface{}{"context": templateContext})
+	if err != nil {
+		return cue.Value{}, err
+	}
+	value := cueCtx.CompileString(template, cue.Scope(scope))
+	if err := value.Err(); err != nil {
+		return cue.Value{}, err
+	}
+	parameterValue, err := encodeValue(cueCtx, parameters)
+	if err != nil {
+		return cue.Value{}, err
+	}
+	value = value.FillPath(cue.ParsePath("parameter"), parameterValue)
+	if err := value.Err(); err != nil {
+		return cue.Value{}, err
+	}
+	return value, nil
+}
+
+// encodeValue converts a go value into a CUE value through its JSON representation, so
+// integer numbers are not converted into floats
+func encodeValue(cueCtx *cue.Context, x interface{}) (cue.Value, error) {
+	raw, err := json.Marshal(x)
+	if err != nil {
+		return cue.Value{}, err
+	}
+	value := cueCtx.CompileBytes(raw)
+	if err := value.Err(); err != nil {
+		return cue.Value{}, err
+	}
+	return value, nil
+}
+
+// collectOutputs adds the resources defined in the `outputs` field of a template
+func collectOutputs(value cue.Value, outputs map[string]cue.Value) error {
+	auxiliary := value.LookupPath(cue.ParsePath("outputs"))
+	if !auxiliary.Exists() {
+		return nil
+	}
+	iter, err := auxiliary.Fields()
+	if err != nil {
+		return err
+	}
+	for iter.Next() {
+		outputs[iter.Label()] = iter.Value()
+	}
+	return nil
+}
+
+// toInterface converts a concrete CUE value into its go representation
+func toInterface(value cue.Value) (interface{}, error) {
+	if err := value.Validate(cue.Concrete(true)); err != nil {
+		return nil, err
+	}
+	raw, err := value.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var converted interface{}
+	if err := json.Unmarshal(raw, &converted); err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
+
+// toUnstructured converts a concrete CUE value into an *unstructured.Unstructured
+func toUnstructured(value cue.Value) (*unstructured.Unstructured, error) {
+	if err := value.Validate(cue.Concrete(true)); err != nil {
+		return nil, err
+	}
+	raw, err := value.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
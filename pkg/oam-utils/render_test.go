@@ -0,0 +1,184 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const componentDefinition = `
+apiVersion: core.oam.dev/v1beta1
+kind: ComponentDefinition
+metadata:
+  name: simple-service
+spec:
+  workload:
+    definition:
+      apiVersion: apps/v1
+      kind: Deployment
+  schematic:
+    cue:
+      template: |
+        output: {
+          apiVersion: "apps/v1"
+          kind:       "Deployment"
+          metadata: name: context.name
+          spec: {
+            replicas: parameter.replicas
+            template: spec: containers: [{
+              name:  context.name
+              image: parameter.image
+            }]
+          }
+        }
+        outputs: service: {
+          apiVersion: "v1"
+          kind:       "Service"
+          metadata: name: context.name
+          spec: ports: [{port: parameter.port}]
+        }
+        parameter: {
+          image:    string
+          port:     *80 | int
+          replicas: *1 | int
+        }
+`
+
+const traitDefinition = `
+apiVersion: core.oam.dev/v1beta1
+kind: TraitDefinition
+metadata:
+  name: labels
+spec:
+  schematic:
+    cue:
+      template: |
+        patch: metadata: labels: parameter
+        outputs: "labels-cm": {
+          apiVersion: "v1"
+          kind:       "ConfigMap"
+          metadata: name: context.name + "-labels"
+          data: parameter
+        }
+        parameter: [string]: string
+`
+
+const customApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: custom
+spec:
+  components:
+    - name: frontend
+      type: simple-service
+      properties:
+        image: nginx:1.20.0
+        port: 8080
+      traits:
+        - type: labels
+          properties:
+            tier: frontend
+`
+
+const unknownTypeApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: unknown
+spec:
+  components:
+    - name: frontend
+      type: not-bundled
+      properties:
+        image: nginx:1.20.0
+`
+
+var _ = ginkgo.Describe("Rendering tests", func() {
+
+	ginkgo.It("Should be able to return the bundled definitions", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(customApplication)},
+			{FileName: "component.yaml", Content: []byte(componentDefinition)},
+			{FileName: "trait.yaml", Content: []byte(traitDefinition)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		definitions, err := app.GetDefinitions()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(definitions["ComponentDefinition"]).Should(gomega.HaveKey("simple-service"))
+		gomega.Expect(definitions["TraitDefinition"]).Should(gomega.HaveKey("labels"))
+	})
+
+	ginkgo.It("Should be able to render a component with traits", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(customApplication)},
+			{FileName: "component.yaml", Content: []byte(componentDefinition)},
+			{FileName: "trait.yaml", Content: []byte(traitDefinition)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		rendered, err := app.Render()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(rendered["custom"]).Should(gomega.HaveLen(1))
+
+		component := rendered["custom"][0]
+		gomega.Expect(component.Output).ShouldNot(gomega.BeNil())
+		gomega.Expect(component.Output.GetKind()).Should(gomega.Equal("Deployment"))
+		gomega.Expect(component.Output.GetName()).Should(gomega.Equal("frontend"))
+		gomega.Expect(component.Output.GetLabels()).Should(gomega.HaveKeyWithValue("tier", "frontend"))
+		replicas, _, err := unstructured.NestedInt64(component.Output.Object, "spec", "replicas")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(replicas).Should(gomega.Equal(int64(1)))
+
+		gomega.Expect(component.Outputs).Should(gomega.HaveKey("service"))
+		gomega.Expect(component.Outputs).Should(gomega.HaveKey("labels-cm"))
+		ports, _, err := unstructured.NestedSlice(component.Outputs["service"].Object, "spec", "ports")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(ports[0]).Should(gomega.HaveKeyWithValue("port", int64(8080)))
+	})
+
+	ginkgo.It("Should not be able to render a component without its definition", func() {
+		files := []*ApplicationFile{{FileName: "app.yaml", Content: []byte(unknownTypeApplication)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		_, err = app.Render()
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should not be able to render a component with missing parameters", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(`
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: missing
+spec:
+  components:
+    - name: frontend
+      type: simple-service
+`)},
+			{FileName: "component.yaml", Content: []byte(componentDefinition)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		_, err = app.RenderApplication("missing")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
@@ -0,0 +1,367 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+const (
+	// packageExtension with the extension of the packages stored in a repository
+	packageExtension = ".tgz"
+	// versionAnnotation with the annotation of the OAM applications that contains the version
+	versionAnnotation = "version"
+	// referenceSeparator with the separator between the name and the version in a package reference
+	referenceSeparator = ":"
+)
+
+// invalidFileNameRegex matches the characters replaced in the file names of the packages
+var invalidFileNameRegex = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// RepositoryEntry with the indexed information of a package stored in a repository
+type RepositoryEntry struct {
+	// Name of the catalog application (the name of the metadata or the names of the OAM applications)
+	Name string `json:"name"`
+	// Version of the catalog application (the version of the metadata or the version annotation of the OAM applications)
+	Version string `json:"version,omitempty"`
+	// Description of the catalog application
+	Description string `json:"description,omitempty"`
+	// Keywords of the catalog application
+	Keywords []string `json:"keywords,omitempty"`
+	// Applications with the names of the OAM applications
+	Applications []string `json:"applications"`
+	// ComponentTypes with the types of the components
+	ComponentTypes []string `json:"componentTypes"`
+	// Labels with the labels of the OAM applications
+	Labels map[string]string `json:"labels,omitempty"`
+	// File with the path of the package relative to the repository directory
+	File string `json:"file"`
+	// Digest with the content digest of the application (see Application.Digest)
+	Digest string `json:"digest"`
+}
+
+// SearchQuery with the filters of a repository search. Empty filters match all the packages.
+type SearchQuery struct {
+	// Keyword contained (case insensitive) in the name, description, keywords or application names
+	Keyword string
+	// ComponentType used by a component
+	ComponentType string
+	// Labels that the applications must have
+	Labels map[string]string
+}
+
+// Repository with a directory of packaged catalog applications (tgz files) and the index of their metadata
+type Repository struct {
+	// mutex protecting the entries
+	mutex sync.RWMutex
+	// directory with the packages
+	directory string
+	// entries with the indexed packages
+	entries []*RepositoryEntry
+	// options used to load the packages
+	options []LoadOption
+}
+
+// NewRepository opens a repository indexing the packages (tgz files) stored in a directory and its
+// subdirectories. The directory is created if it does not exist. The packages are loaded with the options received.
+func NewRepository(directory string, opts ...LoadOption) (*Repository, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating repository in %s", directory)
+	}
+	repository := &Repository{directory: directory, entries: make([]*RepositoryEntry, 0), options: opts}
+	if err := repository.Reindex(); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// Reindex reads again the packages stored in the repository directory
+func (r *Repository) Reindex() error {
+	logger := newLoadOptions(r.options).getLogger()
+	entries := make([]*RepositoryEntry, 0)
+	err := filepath.Walk(r.directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), packageExtension) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		app, err := NewApplicationFromTGZ(content, r.options...)
+		if err != nil {
+			logger.Warn().Err(err).Str("file", path).Msg("skipping invalid package")
+			return nil
+		}
+		relative, err := filepath.Rel(r.directory, path)
+		if err != nil {
+			return err
+		}
+		entry, err := newRepositoryEntry(app, filepath.ToSlash(relative))
+		if err != nil {
+			logger.Warn().Err(err).Str("file", path).Msg("skipping invalid package")
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error indexing repository %s", r.directory)
+	}
+	sortRepositoryEntries(entries)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = entries
+	return nil
+}
+
+// Add stores an application in the repository as <name>-<version>.tgz and indexes it. A package with
+// the same name and version is replaced.
+func (r *Repository) Add(app *Application) (*RepositoryEntry, error) {
+	raw, err := app.ToTGZ()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := newRepositoryEntry(app, "")
+	if err != nil {
+		return nil, err
+	}
+	fileName := strings.ToLower(entry.Name)
+	if entry.Version != "" {
+		fileName = fmt.Sprintf("%s-%s", fileName, strings.ToLower(entry.Version))
+	}
+	entry.File = invalidFileNameRegex.ReplaceAllString(fileName, "-") + packageExtension
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entries := make([]*RepositoryEntry, 0, len(r.entries)+1)
+	for _, existing := range r.entries {
+		if existing.Name == entry.Name && existing.Version == entry.Version {
+			if existing.File != entry.File {
+				if err := os.Remove(filepath.Join(r.directory, existing.File)); err != nil && !os.IsNotExist(err) {
+					return nil, nerrors.NewInternalErrorFrom(err, "error replacing package %s", existing.File)
+				}
+			}
+			continue
+		}
+		if existing.File != entry.File {
+			entries = append(entries, existing)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(r.directory, entry.File), raw, 0644); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error writing package %s", entry.File)
+	}
+	entries = append(entries, entry)
+	sortRepositoryEntries(entries)
+	r.entries = entries
+	return entry, nil
+}
+
+// Entries returns the indexed packages sorted by name and version (newest first)
+func (r *Repository) Entries() []*RepositoryEntry {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]*RepositoryEntry{}, r.entries...)
+}
+
+// Search returns the packages that match all the filters of the query
+func (r *Repository) Search(query SearchQuery) []*RepositoryEntry {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	keyword := strings.ToLower(query.Keyword)
+	result := make([]*RepositoryEntry, 0)
+	for _, entry := range r.entries {
+		if keyword != "" && !entryContainsKeyword(entry, keyword) {
+			continue
+		}
+		if query.ComponentType != "" && !containsString(entry.ComponentTypes, query.ComponentType) {
+			continue
+		}
+		matchesLabels := true
+		for key, value := range query.Labels {
+			if entry.Labels[key] != value {
+				matchesLabels = false
+			}
+		}
+		if matchesLabels {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Versions returns the versions of a catalog application sorted from the newest
+func (r *Repository) Versions(name string) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	versions := make([]string, 0)
+	for _, entry := range r.entries {
+		if entry.Name == name {
+			versions = append(versions, entry.Version)
+		}
+	}
+	return versions
+}
+
+// Resolve returns the package of a reference: name (the newest version), name:version or name:range
+// (the newest version satisfying the range, see ParseVersionConstraint)
+func (r *Repository) Resolve(reference string) (*RepositoryEntry, error) {
+	name, version := reference, ""
+	if index := strings.LastIndex(reference, referenceSeparator); index != -1 {
+		name, version = reference[:index], reference[index+1:]
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var constraint *VersionConstraint
+	for _, entry := range r.entries {
+		if entry.Name != name {
+			continue
+		}
+		if version == "" || entry.Version == version {
+			return entry, nil
+		}
+		if constraint == nil {
+			var err error
+			if constraint, err = ParseVersionConstraint(version); err != nil {
+				return nil, err
+			}
+		}
+		if parsed, err := ParseVersion(entry.Version); err == nil && constraint.Check(parsed) {
+			return entry, nil
+		}
+	}
+	return nil, nerrors.NewNotFoundError("package %s not found", reference)
+}
+
+// Load returns the application of a reference (see Resolve)
+func (r *Repository) Load(reference string) (*Application, error) {
+	entry, err := r.Resolve(reference)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filepath.Join(r.directory, entry.File))
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error reading package %s", entry.File)
+	}
+	return NewApplicationFromTGZ(content, r.options...)
+}
+
+// newRepositoryEntry returns the indexed information of an application
+func newRepositoryEntry(app *Application, file string) (*RepositoryEntry, error) {
+	app = app.Clone()
+	metadata, err := app.getOCIMetadata()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := app.digest()
+	if err != nil {
+		return nil, err
+	}
+	entry := &RepositoryEntry{
+		Name:           metadata.Name,
+		Version:        metadata.Version,
+		Description:    metadata.Description,
+		Keywords:       metadata.Keywords,
+		Applications:   make([]string, 0),
+		ComponentTypes: make([]string, 0),
+		Labels:         make(map[string]string, 0),
+		File:           file,
+		Digest:         digest,
+	}
+
+	appNames := make([]string, 0, len(app.apps))
+	for appName := range app.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		definition := app.apps[appName]
+		entry.Applications = append(entry.Applications, definition.Metadata.Name)
+		if entry.Version == "" {
+			entry.Version = definition.Metadata.Annotations[versionAnnotation]
+		}
+		for key, value := range definition.Metadata.Labels {
+			entry.Labels[key] = value
+		}
+		components, err := definition.getComponents()
+		if err != nil {
+			return nil, err
+		}
+		for _, component := range components {
+			if !containsString(entry.ComponentTypes, component.Type) {
+				entry.ComponentTypes = append(entry.ComponentTypes, component.Type)
+			}
+		}
+	}
+	sort.Strings(entry.ComponentTypes)
+	return entry, nil
+}
+
+// sortRepositoryEntries sorts the entries by name and version (newest first). The versions that are not
+// semantic versions are sorted after the rest.
+func sortRepositoryEntries(entries []*RepositoryEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		first, firstErr := ParseVersion(entries[i].Version)
+		second, secondErr := ParseVersion(entries[j].Version)
+		switch {
+		case firstErr == nil && secondErr == nil:
+			return first.Compare(second) > 0
+		case firstErr == nil || secondErr == nil:
+			return firstErr == nil
+		default:
+			return entries[i].Version > entries[j].Version
+		}
+	})
+}
+
+// entryContainsKeyword returns true if the name, description, keywords or applications of an entry
+// contain a keyword (in lower case)
+func entryContainsKeyword(entry *RepositoryEntry, keyword string) bool {
+	texts := append([]string{entry.Name, entry.Description}, entry.Keywords...)
+	texts = append(texts, entry.Applications...)
+	for _, text := range texts {
+		if strings.Contains(strings.ToLower(text), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if a list contains a value
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// versionedApplication returns an application with metadata with the name and version received
+func versionedApplication(name string, version string, extra ...string) *Application {
+	metadata := strings.Replace(strings.Replace(completeMetadata, `"Nginx"`, name, 1), "1.2.0", version, 1)
+	files := [][]byte{[]byte(metadata)}
+	for _, file := range extra {
+		files = append(files, []byte(file))
+	}
+	app, err := NewApplicationFromYAML(files)
+	gomega.Expect(err).Should(gomega.Succeed())
+	return app
+}
+
+var _ = ginkgo.Describe("Repository tests", func() {
+
+	var dir string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "repository")
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	ginkgo.It("Should be able to add and index packages", func() {
+		repository, err := NewRepository(dir)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(repository.Entries()).Should(gomega.BeEmpty())
+
+		for _, version := range []string{"1.0.0", "1.2.0", "2.0.0", "1.10.0"} {
+			_, err := repository.Add(versionedApplication("nginx", version, applicationFile))
+			gomega.Expect(err).Should(gomega.Succeed())
+		}
+		entry, err := repository.Add(versionedApplication("shop", "0.1.0", customApplication))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entry.File).Should(gomega.Equal("shop-0.1.0.tgz"))
+		gomega.Expect(entry.ComponentTypes).Should(gomega.Equal([]string{"simple-service"}))
+		gomega.Expect(filepath.Join(dir, "nginx-1.10.0.tgz")).Should(gomega.BeAnExistingFile())
+
+		gomega.Expect(repository.Versions("nginx")).Should(gomega.Equal([]string{"2.0.0", "1.10.0", "1.2.0", "1.0.0"}))
+
+		// a new repository reads the stored packages
+		reopened, err := NewRepository(dir)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(reopened.Entries()).Should(gomega.Equal(repository.Entries()))
+
+		// the same version is replaced
+		_, err = repository.Add(versionedApplication("nginx", "2.0.0", fileWithWorkflow))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(repository.Versions("nginx")).Should(gomega.HaveLen(4))
+		latest, err := repository.Load("nginx")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(latest.GetNames()).Should(gomega.HaveKey("appWithWorkflow"))
+	})
+
+	ginkgo.It("Should be able to search packages", func() {
+		repository, err := NewRepository(dir)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = repository.Add(versionedApplication("nginx", "1.0.0", applicationFile))
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = repository.Add(versionedApplication("shop", "0.1.0", customApplication))
+		gomega.Expect(err).Should(gomega.Succeed())
+		labeled := strings.Replace(fileWithWorkflow, "  name: appWithWorkflow", "  name: appWithWorkflow\n  labels:\n    tier: backend", 1)
+		_, err = repository.Add(versionedApplication("jobs", "3.0.0", labeled))
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		gomega.Expect(repository.Search(SearchQuery{})).Should(gomega.HaveLen(3))
+		gomega.Expect(repository.Search(SearchQuery{Keyword: "SHO"})).Should(gomega.HaveLen(1))
+		gomega.Expect(repository.Search(SearchQuery{Keyword: "customized"})).Should(gomega.HaveLen(3))
+		gomega.Expect(repository.Search(SearchQuery{Keyword: "workflow"})).Should(gomega.HaveLen(1))
+		gomega.Expect(repository.Search(SearchQuery{ComponentType: "worker"})[0].Name).Should(gomega.Equal("jobs"))
+		gomega.Expect(repository.Search(SearchQuery{Labels: map[string]string{"tier": "backend"}})).Should(gomega.HaveLen(1))
+		gomega.Expect(repository.Search(SearchQuery{Keyword: "shop", ComponentType: "worker"})).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("Should be able to resolve references", func() {
+		repository, err := NewRepository(dir)
+		gomega.Expect(err).Should(gomega.Succeed())
+		for _, version := range []string{"1.0.0", "1.2.0", "1.3.0-rc.1", "2.0.0"} {
+			_, err := repository.Add(versionedApplication("nginx", version, applicationFile))
+			gomega.Expect(err).Should(gomega.Succeed())
+		}
+
+		cases := map[string]string{
+			"nginx":              "2.0.0",
+			"nginx:1.0.0":        "1.0.0",
+			"nginx:^1.0":         "1.2.0",
+			"nginx:~1.0.0":       "1.0.0",
+			"nginx:>=1.3.0-rc.0": "2.0.0",
+			"nginx:1.3.0-rc.1":   "1.3.0-rc.1",
+		}
+		for reference, expected := range cases {
+			entry, err := repository.Resolve(reference)
+			gomega.Expect(err).Should(gomega.Succeed(), reference)
+			gomega.Expect(entry.Version).Should(gomega.Equal(expected), reference)
+		}
+
+		_, err = repository.Resolve("nginx:^3.0")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		_, err = repository.Load("unknown")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		app, err := repository.Load("nginx:^1.0")
+		gomega.Expect(err).Should(gomega.Succeed())
+		metadata, err := app.GetMetadata()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(metadata.Version).Should(gomega.Equal("1.2.0"))
+	})
+})
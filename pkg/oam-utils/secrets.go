@@ -0,0 +1,418 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	yamlV3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RedactedValue with the value that replaces the secrets
+const RedactedValue = "REDACTED"
+
+const (
+	// SecretDataReason is reported for the values of the Secret entities
+	SecretDataReason = "secret data"
+	// SensitiveKeyReason is reported for the values of fields and environment variables with a sensitive name
+	SensitiveKeyReason = "sensitive key"
+	// KnownPatternReason is reported for the values that match the format of a well known credential
+	KnownPatternReason = "known secret pattern"
+	// HighEntropyReason is reported for the random looking values
+	HighEntropyReason = "high entropy string"
+)
+
+const (
+	// minEntropyLength with the minimum length of the strings checked by entropy
+	minEntropyLength = 20
+	// minEntropy with the minimum Shannon entropy (bits per character) of a random looking string
+	minEntropy = 4.0
+)
+
+// sensitiveKeyRegex matches the names of fields and environment variables that usually contain credentials
+var sensitiveKeyRegex = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credential)`)
+
+// referenceKeySuffixes with the suffixes of the sensitive keys that reference a credential instead of containing it
+// (e.g. secretName or secretKeyRef)
+var referenceKeySuffixes = []string{"name", "ref", "file", "path"}
+
+// knownSecretRegexes with the formats of well known credentials
+var knownSecretRegexes = []*regexp.Regexp{
+	// AWS access key
+	regexp.MustCompile(`AKIA[0-9A-Z]{16}`),
+	// PEM private key
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	// GitHub token
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36}`),
+	// Slack token
+	regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]{10,}`),
+	// JSON Web Token
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	// URL with credentials
+	regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s:@]+@`),
+}
+
+// hexRegex matches the hexadecimal strings (hashes and digests)
+var hexRegex = regexp.MustCompile(`^[0-9a-fA-F-]+$`)
+
+// SecretFinding with a value of the application that looks like a secret
+type SecretFinding struct {
+	// Application with the name of the OAM application (empty if the secret is in an entity)
+	Application string
+	// Component with the name of the component (empty if the secret is in an entity)
+	Component string
+	// EntityKind with the kind of the entity (empty if the secret is in a component)
+	EntityKind string
+	// EntityName with the name of the entity (empty if the secret is in a component)
+	EntityName string
+	// Path with the location of the secret in the application or the entity (e.g. spec.components[0].properties.password)
+	Path string
+	// Reason why the value is considered a secret
+	Reason string
+}
+
+// secretContext with the location of a value in a Secret entity
+type secretContext int
+
+const (
+	// noSecret for values outside Secret entities
+	noSecret secretContext = iota
+	// secretEntity for the root of a Secret entity
+	secretEntity
+	// secretData for the values of the data and stringData fields of a Secret entity
+	secretData
+)
+
+// secretVisitor is called for each secret found. It returns the new value of the secret.
+type secretVisitor func(path string, reason string, value string) string
+
+// FindSecrets returns the values of the components and the bundled entities that look like secrets: the data of
+// Secret entities, the values of fields with a sensitive name (e.g. password or DB_TOKEN environment variables),
+// well known credential formats and high entropy strings.
+func (a *Application) FindSecrets() ([]*SecretFinding, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.findSecrets()
+}
+
+// findSecrets is FindSecrets without locking the application
+func (a *Application) findSecrets() ([]*SecretFinding, error) {
+	findings := make([]*SecretFinding, 0)
+
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		components, err := getRawComponents(a.apps[appName])
+		if err != nil {
+			return nil, err
+		}
+		for i, component := range components {
+			componentName, _ := component.(map[string]interface{})["name"].(string)
+			walkSecrets(component, fmt.Sprintf("spec.components[%d]", i), "", noSecret, func(path string, reason string, value string) string {
+				findings = append(findings, &SecretFinding{
+					Application: a.apps[appName].Metadata.Name,
+					Component:   componentName,
+					Path:        path,
+					Reason:      reason,
+				})
+				return value
+			})
+		}
+	}
+
+	for _, entity := range a.entities {
+		_, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error reading entity")
+		}
+		walkSecrets(obj.Object, "", "", getSecretContext(obj.GetAPIVersion(), obj.GetKind()), func(path string, reason string, value string) string {
+			findings = append(findings, &SecretFinding{
+				EntityKind: obj.GetKind(),
+				EntityName: obj.GetName(),
+				Path:       path,
+				Reason:     reason,
+			})
+			return value
+		})
+	}
+	return findings, nil
+}
+
+// RedactSecrets returns a new application where the values found by FindSecrets are replaced with RedactedValue
+// (encoded in base64 in the data of Secret entities), so the output of its ToYAML, ToTGZ and GetParameters does
+// not contain them, and the redacted findings. The original application is not modified and shares the content
+// without secrets with the new one as in Clone.
+func (a *Application) RedactSecrets() (*Application, []*SecretFinding, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	findings, err := a.findSecrets()
+	if err != nil {
+		return nil, nil, err
+	}
+	redact := func(path string, reason string, value string) string {
+		if reason == SecretDataReason && strings.HasPrefix(path, "data.") {
+			return base64.StdEncoding.EncodeToString([]byte(RedactedValue))
+		}
+		return RedactedValue
+	}
+
+	// the content shared with the original application is not modified, the redacted copies replace it
+	apps := make(map[string]*ApplicationDefinition, len(a.apps))
+	nodes := make(map[string]*ComponentsNode, len(a.componentsYAML))
+	for appName, node := range a.componentsYAML {
+		nodes[appName] = node
+	}
+	for appName, original := range a.apps {
+		app := original.copy()
+		apps[appName] = app
+		components, err := getRawComponents(app)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, component := range components {
+			walkSecrets(component, "", "", noSecret, redact)
+		}
+		raw, err := json.Marshal(components)
+		if err != nil {
+			return nil, nil, nerrors.NewInternalErrorFrom(err, "error redacting secrets of %s application", appName)
+		}
+		app.Spec.Components = &runtime.RawExtension{Raw: raw}
+
+		if node, exists := nodes[appName]; exists {
+			node = node.copy()
+			for _, component := range node.Spec.Components.Content {
+				walkSecretNodes(component, "", "", noSecret, redact)
+			}
+			nodes[appName] = node
+		}
+	}
+
+	entities := append([][]byte{}, a.entities...)
+	for i, entity := range entities {
+		_, obj, err := getGVK(entity)
+		if err != nil {
+			return nil, nil, nerrors.NewInternalErrorFrom(err, "error reading entity")
+		}
+		var node yamlV3.Node
+		if err := yamlV3.Unmarshal(entity, &node); err != nil {
+			return nil, nil, nerrors.NewInternalErrorFrom(err, "error redacting secrets of entity: %s", err.Error())
+		}
+		if !walkSecretNodes(&node, "", "", getSecretContext(obj.GetAPIVersion(), obj.GetKind()), redact) {
+			continue
+		}
+		redacted, err := encodeYAMLNode(&node)
+		if err != nil {
+			return nil, nil, nerrors.NewInternalErrorFrom(err, "error redacting secrets of entity: %s", err.Error())
+		}
+		entities[i] = redacted
+	}
+	return &Application{
+		apps:               apps,
+		entities:           entities,
+		componentsYAML:     nodes,
+		metadata:           a.metadata,
+		parametersMetadata: a.parametersMetadata,
+		logger:             a.logger,
+	}, findings, nil
+}
+
+// getSecretContext returns the context of the root of an entity
+func getSecretContext(apiVersion string, kind string) secretContext {
+	if apiVersion == "v1" && kind == "Secret" {
+		return secretEntity
+	}
+	return noSecret
+}
+
+// getChildSecretContext returns the context of a field
+func getChildSecretContext(context secretContext, key string) secretContext {
+	switch {
+	case context == secretData:
+		return secretData
+	case context == secretEntity && (key == "data" || key == "stringData"):
+		return secretData
+	default:
+		return noSecret
+	}
+}
+
+// detectSecret returns the reason why a value looks like a secret, or an empty string if it does not.
+// The key is the name of the field or, for name/value pairs such as environment variables, the name of the pair.
+func detectSecret(key string, value string, context secretContext) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	if context == secretData {
+		return SecretDataReason
+	}
+	if isSensitiveKey(key) {
+		return SensitiveKeyReason
+	}
+	for _, regex := range knownSecretRegexes {
+		if regex.MatchString(value) {
+			return KnownPatternReason
+		}
+	}
+	if key != "image" && isHighEntropy(value) {
+		return HighEntropyReason
+	}
+	return ""
+}
+
+// isSensitiveKey returns true if a key usually contains credentials
+func isSensitiveKey(key string) bool {
+	if !sensitiveKeyRegex.MatchString(key) {
+		return false
+	}
+	lowerKey := strings.ToLower(key)
+	for _, suffix := range referenceKeySuffixes {
+		if strings.HasSuffix(lowerKey, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// isHighEntropy returns true if a string looks random. Short strings, strings with spaces, hexadecimal
+// strings (hashes and identifiers), URLs and paths are not checked.
+func isHighEntropy(value string) bool {
+	if len(value) < minEntropyLength || strings.ContainsAny(value, " \t\n") || hexRegex.MatchString(value) ||
+		strings.Contains(value, "://") || strings.HasPrefix(value, "/") {
+		return false
+	}
+	return shannonEntropy(value) >= minEntropy
+}
+
+// shannonEntropy returns the Shannon entropy of a string in bits per character
+func shannonEntropy(value string) float64 {
+	frequencies := make(map[rune]float64, 0)
+	total := 0.0
+	for _, char := range value {
+		frequencies[char]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range frequencies {
+		probability := count / total
+		entropy -= probability * math.Log2(probability)
+	}
+	return entropy
+}
+
+// pairKey returns the key used to check the value field of a name/value pair (e.g. environment variables)
+func pairKey(key string, name interface{}) string {
+	if nameValue, ok := name.(string); ok && key == "value" {
+		return nameValue
+	}
+	return key
+}
+
+// walkSecrets calls fn for each secret found in a value, replacing the secret with the returned value
+func walkSecrets(value interface{}, path string, key string, context secretContext, fn secretVisitor) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for childKey := range typed {
+			keys = append(keys, childKey)
+		}
+		sort.Strings(keys)
+		for _, childKey := range keys {
+			childPath := joinPath(path, childKey)
+			childContext := getChildSecretContext(context, childKey)
+			if text, ok := typed[childKey].(string); ok {
+				if reason := detectSecret(pairKey(childKey, typed["name"]), text, childContext); reason != "" {
+					typed[childKey] = fn(childPath, reason, text)
+				}
+				continue
+			}
+			walkSecrets(typed[childKey], childPath, childKey, childContext, fn)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			if text, ok := child.(string); ok {
+				if reason := detectSecret(key, text, context); reason != "" {
+					typed[i] = fn(childPath, reason, text)
+				}
+				continue
+			}
+			walkSecrets(child, childPath, key, context, fn)
+		}
+	}
+}
+
+// walkSecretNodes calls fn for each secret found in a YAML node, replacing the secret with the returned value.
+// It returns true if any secret has been changed.
+func walkSecretNodes(node *yamlV3.Node, path string, key string, context secretContext, fn secretVisitor) bool {
+	changed := false
+	visit := func(value *yamlV3.Node, valuePath string, valueKey string, valueContext secretContext) {
+		if value.ShortTag() != "!!str" {
+			return
+		}
+		if reason := detectSecret(valueKey, value.Value, valueContext); reason != "" {
+			if newValue := fn(valuePath, reason, value.Value); newValue != value.Value {
+				value.Value = newValue
+				value.Style = 0
+				changed = true
+			}
+		}
+	}
+	switch node.Kind {
+	case yamlV3.DocumentNode:
+		for _, child := range node.Content {
+			changed = walkSecretNodes(child, path, key, context, fn) || changed
+		}
+	case yamlV3.MappingNode:
+		var name interface{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "name" && node.Content[i+1].Kind == yamlV3.ScalarNode {
+				name = node.Content[i+1].Value
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childKey, value := node.Content[i].Value, node.Content[i+1]
+			childPath := joinPath(path, childKey)
+			childContext := getChildSecretContext(context, childKey)
+			if value.Kind == yamlV3.ScalarNode {
+				visit(value, childPath, pairKey(childKey, name), childContext)
+				continue
+			}
+			changed = walkSecretNodes(value, childPath, childKey, childContext, fn) || changed
+		}
+	case yamlV3.SequenceNode:
+		for i, child := range node.Content {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			if child.Kind == yamlV3.ScalarNode {
+				visit(child, childPath, key, context)
+				continue
+			}
+			changed = walkSecretNodes(child, childPath, key, context, fn) || changed
+		}
+	}
+	return changed
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// Version with a semantic version (https://semver.org)
+type Version struct {
+	// Major version
+	Major uint64
+	// Minor version
+	Minor uint64
+	// Patch version
+	Patch uint64
+	// Prerelease with the pre-release identifiers (e.g. rc.1)
+	Prerelease string
+	// Build with the build metadata
+	Build string
+}
+
+// ParseVersion parses a semantic version. The v prefix is accepted and the missing minor and patch numbers
+// are considered 0 (e.g. v1.2 is 1.2.0).
+func ParseVersion(version string) (*Version, error) {
+	result, wildcards, err := parsePartialVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if wildcards > 0 && strings.ContainsAny(version, "xX*") {
+		return nil, nerrors.NewInvalidArgumentError("invalid version %s", version)
+	}
+	return result, nil
+}
+
+// parsePartialVersion parses a version that may have missing or wildcard (x, X or *) numbers. It returns the
+// number of missing or wildcard numbers (counted from the patch number).
+func parsePartialVersion(version string) (*Version, int, error) {
+	value := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	result := &Version{}
+	if index := strings.Index(value, "+"); index != -1 {
+		value, result.Build = value[:index], value[index+1:]
+	}
+	if index := strings.Index(value, "-"); index != -1 {
+		value, result.Prerelease = value[:index], value[index+1:]
+		if result.Prerelease == "" {
+			return nil, 0, nerrors.NewInvalidArgumentError("invalid version %s", version)
+		}
+	}
+	parts := strings.Split(value, ".")
+	if value == "" || len(parts) > 3 {
+		return nil, 0, nerrors.NewInvalidArgumentError("invalid version %s", version)
+	}
+	numbers := []*uint64{&result.Major, &result.Minor, &result.Patch}
+	wildcards := 3 - len(parts)
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcards = 3 - i
+			break
+		}
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, 0, nerrors.NewInvalidArgumentError("invalid version %s", version)
+		}
+		*numbers[i] = number
+	}
+	return result, wildcards, nil
+}
+
+// String returns the version in the major.minor.patch[-prerelease][+build] format
+func (v *Version) String() string {
+	result := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		result = fmt.Sprintf("%s-%s", result, v.Prerelease)
+	}
+	if v.Build != "" {
+		result = fmt.Sprintf("%s+%s", result, v.Build)
+	}
+	return result
+}
+
+// Compare returns -1, 0 or 1 if the version is lower, equal or greater than other. The build metadata is ignored.
+func (v *Version) Compare(other *Version) int {
+	for _, pair := range [][2]uint64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// comparePrerelease compares two pre-release identifiers following the semver precedence rules
+func comparePrerelease(first string, second string) int {
+	switch {
+	case first == second:
+		return 0
+	case first == "":
+		return 1
+	case second == "":
+		return -1
+	}
+	firstParts, secondParts := strings.Split(first, "."), strings.Split(second, ".")
+	for i := 0; i < len(firstParts) && i < len(secondParts); i++ {
+		firstNumber, firstErr := strconv.ParseUint(firstParts[i], 10, 64)
+		secondNumber, secondErr := strconv.ParseUint(secondParts[i], 10, 64)
+		switch {
+		case firstErr == nil && secondErr == nil:
+			if firstNumber != secondNumber {
+				if firstNumber < secondNumber {
+					return -1
+				}
+				return 1
+			}
+		case firstErr == nil:
+			return -1
+		case secondErr == nil:
+			return 1
+		default:
+			if comparison := strings.Compare(firstParts[i], secondParts[i]); comparison != 0 {
+				return comparison
+			}
+		}
+	}
+	switch {
+	case len(firstParts) < len(secondParts):
+		return -1
+	case len(firstParts) > len(secondParts):
+		return 1
+	}
+	return 0
+}
+
+// versionComparator with an operator and the version it is applied to
+type versionComparator struct {
+	operator string
+	version  *Version
+}
+
+// check returns true if a version satisfies the comparator
+func (vc *versionComparator) check(version *Version) bool {
+	comparison := version.Compare(vc.version)
+	switch vc.operator {
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	case "!=":
+		return comparison != 0
+	default:
+		return comparison == 0
+	}
+}
+
+// constraintOperators with the operators of the comparators (the longest ones first)
+var constraintOperators = []string{">=", "<=", "!=", ">", "<", "=", "^", "~"}
+
+// VersionConstraint with a version range. The ranges are sets of comparators separated by || where all the
+// comparators of a set (separated by spaces or commas) must be satisfied. The operators can be followed by spaces
+// (>= 1.2.3). Supported comparators:
+//
+//	1.2.3, =1.2.3, !=1.2.3, >1.2.3, >=1.2.3, <1.2.3, <=1.2.3
+//	^1.2.3   compatible versions: >=1.2.3 <2.0.0 (>=0.2.3 <0.3.0 for 0.x versions)
+//	~1.2.3   patch updates: >=1.2.3 <1.3.0
+//	1.2.x, 1.2, 1.x, *   any version matching the numbers received
+//
+// Pre-release versions only satisfy the sets with a comparator of the same major.minor.patch with pre-release.
+type VersionConstraint struct {
+	// original text of the constraint
+	original string
+	// sets of comparators
+	sets [][]*versionComparator
+}
+
+// ParseVersionConstraint parses a version range
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+	result := &VersionConstraint{original: constraint}
+	for _, set := range strings.Split(constraint, "||") {
+		comparators := make([]*versionComparator, 0)
+		terms := strings.Fields(strings.ReplaceAll(set, ",", " "))
+		for i := 0; i < len(terms); i++ {
+			term := terms[i]
+			// the operators can be separated from the version by spaces (>= 1.2.3)
+			if containsString(constraintOperators, term) && i+1 < len(terms) {
+				term += terms[i+1]
+				i++
+			}
+			parsed, err := parseComparators(term)
+			if err != nil {
+				return nil, nerrors.NewInvalidArgumentError("invalid version constraint %s: %s", constraint, err.Error())
+			}
+			comparators = append(comparators, parsed...)
+		}
+		result.sets = append(result.sets, comparators)
+	}
+	return result, nil
+}
+
+// parseComparators converts a term of a range into comparators
+func parseComparators(term string) ([]*versionComparator, error) {
+	operator := ""
+	for _, candidate := range constraintOperators {
+		if strings.HasPrefix(term, candidate) {
+			operator = candidate
+			break
+		}
+	}
+	version, wildcards, err := parsePartialVersion(strings.TrimPrefix(term, operator))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case operator == "^":
+		upper := &Version{Major: version.Major + 1}
+		if version.Major == 0 && wildcards < 2 {
+			upper = &Version{Minor: version.Minor + 1}
+			if version.Minor == 0 && wildcards == 0 {
+				upper = &Version{Patch: version.Patch + 1}
+			}
+		}
+		return []*versionComparator{{">=", version}, {"<", upper}}, nil
+	case operator == "~":
+		upper := &Version{Major: version.Major, Minor: version.Minor + 1}
+		if wildcards >= 2 {
+			upper = &Version{Major: version.Major + 1}
+		}
+		return []*versionComparator{{">=", version}, {"<", upper}}, nil
+	case wildcards > 0 && (operator == "" || operator == "="):
+		upper := &Version{Major: version.Major, Minor: version.Minor + 1}
+		switch wildcards {
+		case 2:
+			upper = &Version{Major: version.Major + 1}
+		case 3:
+			return []*versionComparator{}, nil
+		}
+		return []*versionComparator{{">=", version}, {"<", upper}}, nil
+	case operator == "":
+		return []*versionComparator{{"=", version}}, nil
+	default:
+		return []*versionComparator{{operator, version}}, nil
+	}
+}
+
+// Check returns true if a version satisfies the constraint
+func (vc *VersionConstraint) Check(version *Version) bool {
+	for _, set := range vc.sets {
+		satisfied := true
+		prereleaseAllowed := version.Prerelease == ""
+		for _, comparator := range set {
+			if !comparator.check(version) {
+				satisfied = false
+				break
+			}
+			if comparator.version.Prerelease != "" && comparator.version.Major == version.Major &&
+				comparator.version.Minor == version.Minor && comparator.version.Patch == version.Patch {
+				prereleaseAllowed = true
+			}
+		}
+		if satisfied && prereleaseAllowed {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the constraint as it was parsed
+func (vc *VersionConstraint) String() string {
+	return vc.original
+}
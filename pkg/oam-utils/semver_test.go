@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Semantic version tests", func() {
+
+	ginkgo.It("Should be able to parse and compare versions", func() {
+		version, err := ParseVersion("v1.2.3-rc.1+build.5")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*version).Should(gomega.Equal(Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1", Build: "build.5"}))
+		gomega.Expect(version.String()).Should(gomega.Equal("1.2.3-rc.1+build.5"))
+
+		short, err := ParseVersion("1.2")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(short.String()).Should(gomega.Equal("1.2.0"))
+
+		for _, invalid := range []string{"", "a.b.c", "1.2.3.4", "1.x", "1.2.3-"} {
+			_, err := ParseVersion(invalid)
+			gomega.Expect(err).ShouldNot(gomega.Succeed(), invalid)
+		}
+
+		ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0", "2.0.0"}
+		for i := 0; i+1 < len(ordered); i++ {
+			first, err := ParseVersion(ordered[i])
+			gomega.Expect(err).Should(gomega.Succeed())
+			second, err := ParseVersion(ordered[i+1])
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(first.Compare(second)).Should(gomega.Equal(-1), ordered[i])
+			gomega.Expect(second.Compare(first)).Should(gomega.Equal(1), ordered[i])
+		}
+	})
+
+	ginkgo.It("Should be able to check version constraints", func() {
+		cases := map[string]map[string]bool{
+			"^1.2.3":           {"1.2.3": true, "1.9.0": true, "2.0.0": false, "1.2.2": false, "2.0.0-rc.1": false},
+			"^0.2.3":           {"0.2.9": true, "0.3.0": false},
+			"~1.2.3":           {"1.2.9": true, "1.3.0": false},
+			"1.2.x":            {"1.2.0": true, "1.2.7": true, "1.3.0": false},
+			"1.x":              {"1.9.9": true, "2.0.0": false},
+			"*":                {"0.0.1": true, "9.0.0": true},
+			">=1.0.0 <2.0.0":   {"1.5.0": true, "2.0.0": false},
+			"<1.0.0 || >=3.0":  {"0.9.0": true, "2.0.0": false, "3.1.0": true},
+			"!=1.0.0":          {"1.0.0": false, "1.0.1": true},
+			">=1.0.0-rc.1":     {"1.0.0-rc.2": true, "1.0.1-rc.1": false, "1.0.1": true},
+			"1.2.3":            {"1.2.3": true, "1.2.4": false},
+			">= 1.2.3":         {"1.2.3": true, "1.2.2": false},
+			">= 1.0, < 2.0":    {"1.5.0": true, "2.0.0": false},
+			"^ 1.2 || = 0.9.0": {"1.3.0": true, "0.9.0": true, "0.9.1": false},
+		}
+		for constraint, versions := range cases {
+			parsed, err := ParseVersionConstraint(constraint)
+			gomega.Expect(err).Should(gomega.Succeed(), constraint)
+			for version, expected := range versions {
+				parsedVersion, err := ParseVersion(version)
+				gomega.Expect(err).Should(gomega.Succeed())
+				gomega.Expect(parsed.Check(parsedVersion)).Should(gomega.Equal(expected), constraint+" "+version)
+			}
+		}
+
+		_, err := ParseVersionConstraint(">=a.b")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		_, err = ParseVersionConstraint("1.0.0 >=")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
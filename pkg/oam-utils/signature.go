@@ -0,0 +1,226 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// SignatureFile with the name of the detached signature file stored in the tgz
+	SignatureFile = "signature.json"
+	// ed25519Algorithm with the name of the ed25519 signature algorithm
+	ed25519Algorithm = "ed25519"
+	// digestAlgorithm with the prefix of the content digests
+	digestAlgorithm = "sha256"
+)
+
+// Signature with the detached signature of the content digest of an application
+type Signature struct {
+	// Algorithm with the signature algorithm (ed25519)
+	Algorithm string `json:"algorithm"`
+	// KeyID with the identifier of the public key that verifies the signature (see PublicKeyID)
+	KeyID string `json:"keyId"`
+	// Digest with the signed content digest (see Application.Digest)
+	Digest string `json:"digest"`
+	// Signature with the signature of the digest encoded in base64
+	Signature string `json:"signature"`
+}
+
+// PublicKeyID returns the identifier of a public key: the first 16 hexadecimal characters of its sha256 hash
+func PublicKeyID(publicKey ed25519.PublicKey) string {
+	hash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// Digest returns the canonical content digest of the application (sha256:<hex>). The digest is computed from
+// the metadata, the OAM applications and the entities converted into JSON with sorted keys, so it does not
+// depend on the order of the files or the YAML formatting. The OAM applications are also included with the
+// comments of their components (see GetParameters), as the parameter annotations change what ApplyParameters
+// accepts.
+func (a *Application) Digest() (string, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.digest()
+}
+
+// digest is Digest without locking the application
+func (a *Application) digest() (string, error) {
+	documents := make([]string, 0, len(a.apps)+len(a.entities))
+	if a.metadata != nil {
+		canonical, err := canonicalJSON(a.metadata)
+		if err != nil {
+			return "", nerrors.NewInternalErrorFrom(err, "error computing the digest of the metadata")
+		}
+		documents = append(documents, canonical)
+	}
+	for appName, app := range a.apps {
+		raw, err := json.Marshal(app)
+		if err != nil {
+			return "", nerrors.NewInternalErrorFrom(err, "error computing the digest of %s application", appName)
+		}
+		canonical, err := canonicalJSON(raw)
+		if err != nil {
+			return "", nerrors.NewInternalErrorFrom(err, "error computing the digest of %s application", appName)
+		}
+		documents = append(documents, canonical)
+		// the comments of the components are included as they contain the parameter annotations
+		withComments, err := a.applicationToYAML(appName)
+		if err != nil {
+			return "", err
+		}
+		documents = append(documents, string(withComments))
+	}
+	for _, entity := range a.entities {
+		canonical, err := canonicalJSON(entity)
+		if err != nil {
+			return "", nerrors.NewInternalErrorFrom(err, "error computing the digest of an entity")
+		}
+		documents = append(documents, canonical)
+	}
+	sort.Strings(documents)
+
+	hash := sha256.New()
+	for _, document := range documents {
+		hash.Write([]byte(document))
+		hash.Write([]byte("\n"))
+	}
+	return fmt.Sprintf("%s:%s", digestAlgorithm, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// canonicalJSON converts a YAML or JSON document into JSON with sorted keys and without spaces
+func canonicalJSON(document []byte) (string, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(document, &value); err != nil {
+		return "", err
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(canonical), nil
+}
+
+// Sign returns the signature of the content digest of the application
+func (a *Application) Sign(privateKey ed25519.PrivateKey) (*Signature, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.sign(privateKey)
+}
+
+// sign is Sign without locking the application
+func (a *Application) sign(privateKey ed25519.PrivateKey) (*Signature, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, nerrors.NewInvalidArgumentError("invalid ed25519 private key")
+	}
+	digest, err := a.digest()
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		Algorithm: ed25519Algorithm,
+		KeyID:     PublicKeyID(privateKey.Public().(ed25519.PublicKey)),
+		Digest:    digest,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(digest))),
+	}, nil
+}
+
+// Verify checks that the signature is valid for the content of the application and has been created with one
+// of the trusted keys
+func (a *Application) Verify(signature *Signature, trustedKeys []ed25519.PublicKey) error {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if signature == nil {
+		return nerrors.NewPermissionDeniedError("the application is not signed")
+	}
+	if signature.Algorithm != ed25519Algorithm {
+		return nerrors.NewInvalidArgumentError("unsupported signature algorithm %s", signature.Algorithm)
+	}
+	digest, err := a.digest()
+	if err != nil {
+		return err
+	}
+	if signature.Digest != digest {
+		return nerrors.NewPermissionDeniedError("the signature does not match the content of the application")
+	}
+	rawSignature, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return nerrors.NewInvalidArgumentError("invalid signature encoding: %s", err.Error())
+	}
+	for _, key := range trustedKeys {
+		if PublicKeyID(key) == signature.KeyID && ed25519.Verify(key, []byte(digest), rawSignature) {
+			return nil
+		}
+	}
+	return nerrors.NewPermissionDeniedError("the application is not signed by a trusted key")
+}
+
+// ToSignedTGZ packages the application in a tgz file (see ToTGZ) including the detached signature file
+func (a *Application) ToSignedTGZ(privateKey ed25519.PrivateKey) ([]byte, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	signature, err := a.sign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	rawSignature, err := json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error writing the signature")
+	}
+	files, err := a.toFiles()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, &ApplicationFile{FileName: SignatureFile, Content: rawSignature})
+	return writeTGZ(files)
+}
+
+// NewApplicationFromVerifiedTGZ receives a tgz file with a detached signature file and returns the application
+// if the signature is valid and has been created with one of the trusted keys
+func NewApplicationFromVerifiedTGZ(rawApplication []byte, trustedKeys []ed25519.PublicKey, opts ...LoadOption) (*Application, error) {
+	files, err := readTGZFiles(rawApplication, newLoadOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	var signature *Signature
+	for _, file := range files {
+		if file.FileName != SignatureFile {
+			continue
+		}
+		signature = &Signature{}
+		if err := json.Unmarshal(file.Content, signature); err != nil {
+			return nil, nerrors.NewInvalidArgumentError("invalid signature file: %s", err.Error())
+		}
+	}
+	app, err := NewApplication(files, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.Verify(signature, trustedKeys); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
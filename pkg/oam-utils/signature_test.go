@@ -0,0 +1,145 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// reformattedConfigMap with the cm entity using a different YAML format
+const reformattedConfigMap = `
+# configuration
+kind: ConfigMap
+apiVersion: v1
+data: {memory: 250Mi, cpu: "0.50"}
+metadata: {name: cm-test}
+`
+
+var _ = ginkgo.Describe("Signature tests", func() {
+
+	var publicKey ed25519.PublicKey
+	var privateKey ed25519.PrivateKey
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("Should compute a digest independent of the order and the format", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(fileWithWorkflow), []byte(cm)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		digest, err := app.Digest()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(digest).Should(gomega.HavePrefix("sha256:"))
+
+		reordered, err := NewApplicationFromYAML([][]byte{[]byte(reformattedConfigMap), []byte(fileWithWorkflow)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(reordered.Digest()).Should(gomega.Equal(digest))
+
+		changed, err := NewApplicationFromYAML([][]byte{[]byte(fileWithWorkflow), []byte(strings.Replace(cm, "250Mi", "500Mi", 1))})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changed.Digest()).ShouldNot(gomega.Equal(digest))
+	})
+
+	ginkgo.It("Should be able to sign and verify an application", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		signature, err := app.Sign(privateKey)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(signature.KeyID).Should(gomega.Equal(PublicKeyID(publicKey)))
+		gomega.Expect(app.Verify(signature, []ed25519.PublicKey{publicKey})).Should(gomega.Succeed())
+
+		otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.Verify(signature, []ed25519.PublicKey{otherKey})).ShouldNot(gomega.Succeed())
+		gomega.Expect(app.Verify(nil, []ed25519.PublicKey{publicKey})).ShouldNot(gomega.Succeed())
+
+		gomega.Expect(app.ApplyParameters("application", "renamed", "")).Should(gomega.Succeed())
+		gomega.Expect(app.Verify(signature, []ed25519.PublicKey{publicKey})).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should load a signed tgz file with a trusted key", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		signed, err := app.ToSignedTGZ(privateKey)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		loaded, err := NewApplicationFromVerifiedTGZ(signed, []ed25519.PublicKey{publicKey})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(loaded.GetNames()).Should(gomega.HaveKey("application"))
+
+		// the signature file is ignored by the unverified loader
+		_, err = NewApplicationFromTGZ(signed)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewApplicationFromVerifiedTGZ(signed, []ed25519.PublicKey{otherKey})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		unsigned, err := app.ToTGZ()
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewApplicationFromVerifiedTGZ(unsigned, []ed25519.PublicKey{publicKey})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should reject a tampered tgz file", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		signature, err := app.Sign(privateKey)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		rawSignature := []byte(`{"algorithm":"ed25519","keyId":"` + signature.KeyID + `","digest":"` + signature.Digest + `","signature":"` + signature.Signature + `"}`)
+		tampered, err := writeTGZ([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(strings.Replace(applicationFile, "nginx:1.20.0", "evil:latest", 1))},
+			{FileName: SignatureFile, Content: rawSignature},
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewApplicationFromVerifiedTGZ(tampered, []ed25519.PublicKey{publicKey})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should reject a tgz file with modified parameter annotations", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(annotatedApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		signature, err := app.Sign(privateKey)
+		gomega.Expect(err).Should(gomega.Succeed())
+		rawSignature := []byte(`{"algorithm":"ed25519","keyId":"` + signature.KeyID + `","digest":"` + signature.Digest + `","signature":"` + signature.Signature + `"}`)
+
+		original, err := writeTGZ([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(annotatedApplication)},
+			{FileName: SignatureFile, Content: rawSignature},
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewApplicationFromVerifiedTGZ(original, []ed25519.PublicKey{publicKey})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		tampered, err := writeTGZ([]*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(strings.Replace(annotatedApplication, "# @param min=1 max=10", "# @param min=1 max=1000", 1))},
+			{FileName: SignatureFile, Content: rawSignature},
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewApplicationFromVerifiedTGZ(tampered, []ed25519.PublicKey{publicKey})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
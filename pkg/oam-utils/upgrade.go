@@ -0,0 +1,406 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ChangeLevel with the semantic version number that a change requires to increase
+type ChangeLevel int
+
+const (
+	// NoChange when the applications have the same content
+	NoChange ChangeLevel = iota
+	// PatchChange when a value is modified keeping the parameters and their types
+	PatchChange
+	// MinorChange when a backwards compatible element (application, component, trait or optional parameter) is added
+	MinorChange
+	// MajorChange when an element is removed or renamed, a type changes or a required parameter is added
+	MajorChange
+)
+
+// String returns the name of the change level
+func (cl ChangeLevel) String() string {
+	switch cl {
+	case PatchChange:
+		return "patch"
+	case MinorChange:
+		return "minor"
+	case MajorChange:
+		return "major"
+	default:
+		return "none"
+	}
+}
+
+// Change with a difference between two versions of a catalog application
+type Change struct {
+	// Level of the change
+	Level ChangeLevel
+	// Application with the name of the OAM application (empty for the entities)
+	Application string
+	// Component with the name of the component (empty for the application changes)
+	Component string
+	// Path of the parameter in the component (e.g. properties.ports[0].port)
+	Path string
+	// Description of the change
+	Description string
+}
+
+// String returns the change in a human readable format
+func (c *Change) String() string {
+	location := c.Application
+	if c.Component != "" {
+		location = fmt.Sprintf("%s/%s", location, c.Component)
+	}
+	if c.Path != "" {
+		location = fmt.Sprintf("%s:%s", location, c.Path)
+	}
+	return fmt.Sprintf("[%s] %s: %s", c.Level, location, c.Description)
+}
+
+// GetVersion returns the semantic version of the application. The version is read from the application metadata
+// or, if there is no metadata version, from the version annotation of the OAM applications.
+func (a *Application) GetVersion() (*Version, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if metadata, err := a.getMetadata(); err == nil && metadata.Version != "" {
+		return ParseVersion(metadata.Version)
+	}
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		if version, exists := a.apps[appName].Metadata.Annotations[versionAnnotation]; exists {
+			return ParseVersion(version)
+		}
+	}
+	return nil, nerrors.NewNotFoundError("the application has no version")
+}
+
+// CompareVersion returns -1, 0 or 1 if the version of the application is lower, equal or greater than the
+// version of other
+func (a *Application) CompareVersion(other *Application) (int, error) {
+	version, err := a.GetVersion()
+	if err != nil {
+		return 0, err
+	}
+	otherVersion, err := other.GetVersion()
+	if err != nil {
+		return 0, err
+	}
+	return version.Compare(otherVersion), nil
+}
+
+// CompareApplications returns the changes between two versions of a catalog application sorted by application,
+// component and path. Renamed applications, components or parameters are reported as a removal and an addition.
+// The lists are compared as values, unless the parameters metadata describes their elements, and the traits of
+// the same type are compared by position.
+func CompareApplications(previous *Application, current *Application) ([]*Change, error) {
+	// the clones are consistent snapshots of the applications
+	previous, current = previous.Clone(), current.Clone()
+	changes := make([]*Change, 0)
+	for appName, previousApp := range previous.apps {
+		currentApp, exists := current.apps[appName]
+		if !exists {
+			changes = append(changes, &Change{Level: MajorChange, Application: appName, Description: "application removed"})
+			continue
+		}
+		appChanges, err := compareApplicationDefinitions(previousApp, currentApp, current.parametersMetadata[appName])
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, appChanges...)
+	}
+	for appName := range current.apps {
+		if _, exists := previous.apps[appName]; !exists {
+			changes = append(changes, &Change{Level: MinorChange, Application: appName, Description: "application added"})
+		}
+	}
+	if !equalEntities(previous.entities, current.entities) {
+		changes = append(changes, &Change{Level: PatchChange, Description: "entities modified"})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Application != changes[j].Application {
+			return changes[i].Application < changes[j].Application
+		}
+		if changes[i].Component != changes[j].Component {
+			return changes[i].Component < changes[j].Component
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// GetChangeLevel returns the highest level of a list of changes
+func GetChangeLevel(changes []*Change) ChangeLevel {
+	level := NoChange
+	for _, change := range changes {
+		if change.Level > level {
+			level = change.Level
+		}
+	}
+	return level
+}
+
+// Bump returns the next version for a change level. A pre-release version is released if the change fits in
+// it (e.g. 1.3.0-rc.1 is bumped to 1.3.0 with a minor change) and the build metadata is removed.
+func (v *Version) Bump(level ChangeLevel) *Version {
+	next := &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	if v.Prerelease != "" {
+		switch {
+		case level == NoChange || level == PatchChange:
+			return next
+		case level == MinorChange && v.Patch == 0:
+			return next
+		case level == MajorChange && v.Minor == 0 && v.Patch == 0:
+			return next
+		}
+	}
+	switch level {
+	case MajorChange:
+		return &Version{Major: v.Major + 1}
+	case MinorChange:
+		return &Version{Major: v.Major, Minor: v.Minor + 1}
+	case PatchChange:
+		next.Patch++
+	}
+	return next
+}
+
+// SuggestNextVersion compares two versions of a catalog application and returns the version that the current
+// one should be published with, together with the changes found
+func SuggestNextVersion(previous *Application, current *Application) (*Version, []*Change, error) {
+	version, err := previous.GetVersion()
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := CompareApplications(previous, current)
+	if err != nil {
+		return nil, nil, err
+	}
+	return version.Bump(GetChangeLevel(changes)), changes, nil
+}
+
+// compareApplicationDefinitions returns the changes between two versions of an OAM application
+func compareApplicationDefinitions(previous *ApplicationDefinition, current *ApplicationDefinition, metadata []*ParameterMetadata) ([]*Change, error) {
+	appName := previous.Metadata.Name
+	previousComponents, err := previous.getComponents()
+	if err != nil {
+		return nil, err
+	}
+	currentComponents, err := current.getComponents()
+	if err != nil {
+		return nil, err
+	}
+	currentByName := make(map[string]Component, len(currentComponents))
+	for _, component := range currentComponents {
+		currentByName[component.Name] = component
+	}
+
+	changes := make([]*Change, 0)
+	previousNames := make(map[string]bool, len(previousComponents))
+	for _, previousComponent := range previousComponents {
+		previousNames[previousComponent.Name] = true
+		currentComponent, exists := currentByName[previousComponent.Name]
+		if !exists {
+			changes = append(changes, &Change{Level: MajorChange, Application: appName, Component: previousComponent.Name, Description: "component removed"})
+			continue
+		}
+		changes = append(changes, compareComponents(appName, previousComponent, currentComponent, metadata)...)
+	}
+	for _, component := range currentComponents {
+		if !previousNames[component.Name] {
+			changes = append(changes, &Change{Level: MinorChange, Application: appName, Component: component.Name, Description: "component added"})
+		}
+	}
+	if !reflect.DeepEqual(previous.Spec.Policies, current.Spec.Policies) || !equalRawExtensions(previous.Spec.Workflow, current.Spec.Workflow) {
+		changes = append(changes, &Change{Level: PatchChange, Application: appName, Description: "policies or workflow modified"})
+	}
+	return changes, nil
+}
+
+// compareComponents returns the changes between two versions of a component
+func compareComponents(appName string, previous Component, current Component, metadata []*ParameterMetadata) []*Change {
+	newChange := func(level ChangeLevel, path string, description string, args ...interface{}) *Change {
+		return &Change{Level: level, Application: appName, Component: previous.Name, Path: path, Description: fmt.Sprintf(description, args...)}
+	}
+	if previous.Type != current.Type {
+		return []*Change{newChange(MajorChange, "type", "component type changed from %s to %s", previous.Type, current.Type)}
+	}
+
+	required := make(map[string]bool, 0)
+	// indexed with the lists compared element by element because they have parameters in the metadata
+	indexed := make(map[string]bool, 0)
+	for _, parameter := range metadata {
+		if parameter.Component != current.Name {
+			continue
+		}
+		if parameter.Required {
+			required[parameter.Path] = true
+		}
+		for i, char := range parameter.Path {
+			if char == '[' {
+				indexed[parameter.Path[:i]] = true
+			}
+		}
+	}
+	changes := make([]*Change, 0)
+	previousParameters := flattenParameters("properties", previous.Properties, indexed, make(map[string]interface{}, 0))
+	currentParameters := flattenParameters("properties", current.Properties, indexed, make(map[string]interface{}, 0))
+	for path, previousValue := range previousParameters {
+		currentValue, exists := currentParameters[path]
+		switch {
+		case !exists:
+			changes = append(changes, newChange(MajorChange, path, "parameter removed"))
+		case parameterType(previousValue) != parameterType(currentValue):
+			changes = append(changes, newChange(MajorChange, path, "parameter type changed from %s to %s", parameterType(previousValue), parameterType(currentValue)))
+		case !reflect.DeepEqual(previousValue, currentValue):
+			changes = append(changes, newChange(PatchChange, path, "parameter value changed"))
+		}
+	}
+	for path := range currentParameters {
+		if _, exists := previousParameters[path]; exists {
+			continue
+		}
+		if required[path] {
+			changes = append(changes, newChange(MajorChange, path, "required parameter added"))
+		} else {
+			changes = append(changes, newChange(MinorChange, path, "optional parameter added"))
+		}
+	}
+
+	previousKeys := getTraitKeys(previous.Traits)
+	previousTraits := make(map[string]ComponentTrait, len(previous.Traits))
+	for i, key := range previousKeys {
+		previousTraits[key] = previous.Traits[i]
+	}
+	currentTraits := make(map[string]bool, len(current.Traits))
+	for i, key := range getTraitKeys(current.Traits) {
+		currentTraits[key] = true
+		previousTrait, exists := previousTraits[key]
+		switch {
+		case !exists:
+			changes = append(changes, newChange(MinorChange, "traits", "trait %s added", key))
+		case !reflect.DeepEqual(previousTrait.Properties, current.Traits[i].Properties):
+			changes = append(changes, newChange(PatchChange, "traits", "trait %s modified", key))
+		}
+	}
+	for _, key := range previousKeys {
+		if !currentTraits[key] {
+			changes = append(changes, newChange(MajorChange, "traits", "trait %s removed", key))
+		}
+	}
+	return changes
+}
+
+// getTraitKeys returns the keys used to compare the traits of a component: the type of the trait, followed by
+// the index among the traits of the same type if it is not the first one (e.g. storage, storage[1])
+func getTraitKeys(traits []ComponentTrait) []string {
+	keys := make([]string, 0, len(traits))
+	found := make(map[string]int, 0)
+	for _, trait := range traits {
+		key := trait.Type
+		if count := found[trait.Type]; count > 0 {
+			key = fmt.Sprintf("%s[%d]", trait.Type, count)
+		}
+		found[trait.Type]++
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// flattenParameters returns the leaf values of a properties tree indexed by their path (see ParameterMetadata).
+// The lists are values, except the indexed ones that are flattened element by element.
+func flattenParameters(path string, value interface{}, indexed map[string]bool, result map[string]interface{}) map[string]interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if len(typed) == 0 {
+			result[path] = typed
+		}
+		for key, child := range typed {
+			flattenParameters(joinPath(path, key), child, indexed, result)
+		}
+	case []interface{}:
+		if len(typed) == 0 || !indexed[path] {
+			result[path] = typed
+			return result
+		}
+		for index, child := range typed {
+			flattenParameters(fmt.Sprintf("%s[%d]", path, index), child, indexed, result)
+		}
+	default:
+		result[path] = value
+	}
+	return result
+}
+
+// parameterType returns the JSON type of a parameter value
+func parameterType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, int, int64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// equalEntities returns true if two lists of entities have the same content regardless of the order and format
+func equalEntities(previous [][]byte, current [][]byte) bool {
+	if len(previous) != len(current) {
+		return false
+	}
+	canonical := func(entities [][]byte) []string {
+		result := make([]string, 0, len(entities))
+		for _, entity := range entities {
+			document, err := canonicalJSON(entity)
+			if err != nil {
+				document = string(entity)
+			}
+			result = append(result, document)
+		}
+		sort.Strings(result)
+		return result
+	}
+	return reflect.DeepEqual(canonical(previous), canonical(current))
+}
+
+// equalRawExtensions returns true if two raw extensions have the same content
+func equalRawExtensions(previous *runtime.RawExtension, current *runtime.RawExtension) bool {
+	if previous == nil || current == nil {
+		return previous == current
+	}
+	previousJSON, previousErr := canonicalJSON(previous.Raw)
+	currentJSON, currentErr := canonicalJSON(current.Raw)
+	return previousErr == nil && currentErr == nil && previousJSON == currentJSON
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// changeLevels returns the level of the changes indexed by component and path
+func changeLevels(changes []*Change) map[string]ChangeLevel {
+	result := make(map[string]ChangeLevel, 0)
+	for _, change := range changes {
+		result[change.Component+":"+change.Path] = change.Level
+	}
+	return result
+}
+
+var _ = ginkgo.Describe("Upgrade tests", func() {
+
+	ginkgo.It("Should be able to read and compare the versions", func() {
+		withMetadata := versionedApplication("nginx", "1.2.0", applicationFile)
+		version, err := withMetadata.GetVersion()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(version.String()).Should(gomega.Equal("1.2.0"))
+
+		// the version annotation is used if there is no metadata
+		withAnnotation, err := NewApplicationFromYAML([][]byte{[]byte(applicationFile)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		version, err = withAnnotation.GetVersion()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(version.String()).Should(gomega.Equal("1.0.0"))
+
+		gomega.Expect(withMetadata.CompareVersion(withAnnotation)).Should(gomega.Equal(1))
+		gomega.Expect(withAnnotation.CompareVersion(withMetadata)).Should(gomega.Equal(-1))
+
+		withoutVersion, err := NewApplicationFromYAML([][]byte{[]byte(customApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = withoutVersion.GetVersion()
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to classify the changes", func() {
+		previous := versionedApplication("nginx", "1.2.0", applicationFile)
+
+		same, changes, err := SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", applicationFile))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changes).Should(gomega.BeEmpty())
+		gomega.Expect(same.String()).Should(gomega.Equal("1.2.0"))
+
+		patched := strings.Replace(applicationFile, "nginx:1.20.0", "nginx:1.21.0", 1)
+		next, changes, err := SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", patched))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changeLevels(changes)).Should(gomega.Equal(map[string]ChangeLevel{"component1:properties.image": PatchChange}))
+		gomega.Expect(next.String()).Should(gomega.Equal("1.2.1"))
+
+		optional := strings.Replace(applicationFile, "          expose: true", "          expose: true\n          protocol: TCP", 1)
+		next, changes, err = SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", optional))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changeLevels(changes)).Should(gomega.Equal(map[string]ChangeLevel{"component1:properties.ports[0].protocol": MinorChange}))
+		gomega.Expect(next.String()).Should(gomega.Equal("1.3.0"))
+
+		required := strings.Replace(optional, "protocol: TCP", "protocol: TCP # @param required", 1)
+		_, changes, err = SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", required))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(GetChangeLevel(changes)).Should(gomega.Equal(MajorChange))
+
+		renamed := strings.Replace(applicationFile, "image: nginx", "containerImage: nginx", 1)
+		next, changes, err = SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", renamed))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changeLevels(changes)).Should(gomega.Equal(map[string]ChangeLevel{
+			"component1:properties.image":          MajorChange,
+			"component1:properties.containerImage": MinorChange,
+		}))
+		gomega.Expect(next.String()).Should(gomega.Equal("2.0.0"))
+
+		retyped := strings.Replace(applicationFile, "port: 80", "port: \"80\"", 1)
+		_, changes, err = SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", retyped))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changeLevels(changes)).Should(gomega.Equal(map[string]ChangeLevel{"component1:properties.ports[0].port": MajorChange}))
+
+		removed := strings.Replace(applicationFile, "- name: component1", "- name: component2", 1)
+		_, changes, err = SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", removed))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changeLevels(changes)).Should(gomega.Equal(map[string]ChangeLevel{"component1:": MajorChange, "component2:": MinorChange}))
+
+		changedType := strings.Replace(applicationFile, "type: webservice", "type: worker", 1)
+		_, changes, err = SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", changedType))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changeLevels(changes)).Should(gomega.Equal(map[string]ChangeLevel{"component1:type": MajorChange}))
+	})
+
+	ginkgo.It("Should compare the lists as values and the traits of the same type by position", func() {
+		withArgs := strings.Replace(applicationFile, "          expose: true", "          expose: true\n        cmd: [\"nginx\", \"-g\"]", 1)
+		previous := versionedApplication("nginx", "1.2.0", withArgs)
+
+		moreArgs := strings.Replace(withArgs, `cmd: ["nginx", "-g"]`, `cmd: ["nginx", "-g", "daemon off;"]`, 1)
+		_, changes, err := SuggestNextVersion(previous, versionedApplication("nginx", "1.2.0", moreArgs))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changeLevels(changes)).Should(gomega.Equal(map[string]ChangeLevel{"component1:properties.cmd": PatchChange}))
+
+		storage := `
+      traits:
+      - type: storage
+        properties:
+          emptyDir:
+          - name: cache
+            mountPath: /cache`
+		withTrait := strings.Replace(withArgs, `cmd: ["nginx", "-g"]`, `cmd: ["nginx", "-g"]`+storage, 1)
+		withTraits := strings.Replace(withArgs, `cmd: ["nginx", "-g"]`, `cmd: ["nginx", "-g"]`+storage+strings.Replace(storage, "      traits:\n", "", 1), 1)
+		_, changes, err = SuggestNextVersion(versionedApplication("nginx", "1.2.0", withTrait), versionedApplication("nginx", "1.2.0", withTraits))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changes).Should(gomega.HaveLen(1))
+		gomega.Expect(changes[0].Level).Should(gomega.Equal(MinorChange))
+		gomega.Expect(changes[0].Description).Should(gomega.Equal("trait storage[1] added"))
+
+		_, changes, err = SuggestNextVersion(versionedApplication("nginx", "1.2.0", withTraits), versionedApplication("nginx", "1.2.0", withTrait))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(changes).Should(gomega.HaveLen(1))
+		gomega.Expect(changes[0].Level).Should(gomega.Equal(MajorChange))
+		gomega.Expect(changes[0].Description).Should(gomega.Equal("trait storage[1] removed"))
+	})
+
+	ginkgo.It("Should be able to bump versions", func() {
+		cases := map[string][]string{
+			"1.2.3":      {"1.2.3", "1.2.4", "1.3.0", "2.0.0"},
+			"1.3.0-rc.1": {"1.3.0", "1.3.0", "1.3.0", "2.0.0"},
+			"2.0.0-rc.1": {"2.0.0", "2.0.0", "2.0.0", "2.0.0"},
+			"1.2.3+b.1":  {"1.2.3", "1.2.4", "1.3.0", "2.0.0"},
+		}
+		for original, expected := range cases {
+			version, err := ParseVersion(original)
+			gomega.Expect(err).Should(gomega.Succeed())
+			for level, next := range expected {
+				gomega.Expect(version.Bump(ChangeLevel(level)).String()).Should(gomega.Equal(next), original)
+			}
+		}
+	})
+})
@@ -17,84 +17,85 @@ limitations under the License.
 package oam_utils
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
-	"io"
-	"strings"
+	"sort"
 
 	"github.com/napptive/nerrors/pkg/nerrors"
-	"github.com/rs/zerolog/log"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/yaml"
 
 	yamlv3 "gopkg.in/yaml.v3"
 	k8syaml "k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 )
 
-// splitYAMLFile returns a list o YAMLs from a multi resource YAML file
-func splitYAMLFile(file []byte) ([][]byte, error) {
+// yamlSeparator with the prefix of the lines that separate the documents of a multi-document YAML file
+const yamlSeparator = "---"
 
+// splitYAMLFile returns a list o YAMLs from a multi resource YAML file. The documents are slices of the file
+// (their content is not copied) and the empty documents are skipped.
+func splitYAMLFile(file []byte) ([][]byte, error) {
 	resources := make([][]byte, 0)
-	decoder := yaml.NewDocumentDecoder(io.NopCloser(bytes.NewReader(file)))
-	defer decoder.Close()
-
-	for {
-		b := make([]byte, len(file))
-
-		n, err := decoder.Read(b)
-		if err != nil && err != io.EOF {
-			log.Error().Err(err).Msg("error reading yaml file")
-			return nil, nerrors.NewInternalError("error reading yaml file")
+	start := 0
+	for offset := 0; offset < len(file); {
+		lineEnd, next := len(file), len(file)
+		if index := bytes.IndexByte(file[offset:], '\n'); index != -1 {
+			lineEnd, next = offset+index, offset+index+1
 		}
-		if n == 0 || err == io.EOF {
-			return resources, nil
-		} else {
-			resources = append(resources, b[0:n])
+		if bytes.HasPrefix(file[offset:lineEnd], []byte(yamlSeparator)) {
+			documentEnd := start
+			if offset > start {
+				documentEnd = offset - 1
+			}
+			resources = appendYAMLDocument(resources, file[start:documentEnd])
+			start = next
 		}
+		offset = next
 	}
+	return appendYAMLDocument(resources, file[start:]), nil
+}
 
+// appendYAMLDocument appends a document to the list if it is not empty. The capacity of the document is limited
+// to its length, so appending to it does not overwrite the next document.
+func appendYAMLDocument(documents [][]byte, document []byte) [][]byte {
+	if len(bytes.TrimSpace(document)) == 0 {
+		return documents
+	}
+	return append(documents, document[:len(document):len(document)])
 }
 
 // convertUnstructured converts an *unstructured.Unstructured into the struct received
 func convertFromUnstructured(unsObj *unstructured.Unstructured, converted interface{}) error {
 	to, err := unsObj.MarshalJSON()
 	if err != nil {
-		log.Error().Err(err).Msg("error marshalling struct")
-		return nerrors.NewInternalError("error converting struct")
+		return nerrors.NewInternalErrorFrom(err, "error converting struct")
 	}
 	if err = json.Unmarshal(to, &converted); err != nil {
-		log.Error().Err(err).Msg("error unmarshalling struct")
-		return nerrors.NewInternalError("error converting struct")
+		return nerrors.NewInternalErrorFrom(err, "error converting struct")
 	}
 	return nil
 }
 
-func isYAMLFile(fileName string) bool {
-	return strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml")
-}
-
 // convertToYAML receives an interface (entity) and return its yaml representation
 func convertToYAML(entry interface{}) ([]byte, error) {
 	jsonStr, err := json.Marshal(entry)
 	if err != nil {
-		log.Error().Err(err).Msg("error parsing to JSON")
-		return nil, nerrors.NewInternalError("error converting to JSON")
+		return nil, nerrors.NewInternalErrorFrom(err, "error converting to JSON")
 	}
 
 	// Convert the JSON to an object.
 	var jsonObj interface{}
 	err = yamlv3.Unmarshal(jsonStr, &jsonObj)
 	if err != nil {
-		log.Error().Err(err).Msg("error in Unmarshal ")
-		return nil, nerrors.NewInternalError("error converting to YAML")
+		return nil, nerrors.NewInternalErrorFrom(err, "error converting to YAML")
 	}
 
 	// Marshal this object into YAML.
 	returned, err := yamlv3.Marshal(jsonObj)
 	if err != nil {
-		log.Error().Err(err).Msg("error in Marshal ")
-		return nil, nerrors.NewInternalError("error converting to YAML")
+		return nil, nerrors.NewInternalErrorFrom(err, "error converting to YAML")
 	}
 
 	return returned, nil
@@ -120,8 +121,7 @@ func getGVK(entity []byte) (*schema.GroupVersionKind, *unstructured.Unstructured
 	unsObj := &unstructured.Unstructured{}
 	_, gvk, err := decUnstructured.Decode(entity, nil, unsObj)
 	if err != nil {
-		log.Error().Err(err).Msg("error getting GVK from an entity")
-		return nil, nil, nerrors.NewInternalError("%s", err.Error())
+		return nil, nil, nerrors.NewInternalErrorFrom(err, "%s", err.Error())
 	}
 	return gvk, unsObj, nil
 }
@@ -136,3 +136,226 @@ func getGVKType(gvk *schema.GroupVersionKind) EntityType {
 	}
 	return EntityType_UNKNOWN
 }
+
+// isOAMGroup checks if an API group is one of the OAM groups
+func isOAMGroup(group string) bool {
+	for _, oamGroup := range oamGroups {
+		if group == oamGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// removeYAMLComments removes the comments of a YAML node and its children
+func removeYAMLComments(node *yamlv3.Node) {
+	node.HeadComment, node.LineComment, node.FootComment = "", "", ""
+	for _, child := range node.Content {
+		removeYAMLComments(child)
+	}
+}
+
+// writeTGZ packs a list of files into a tgz file
+func writeTGZ(files []*ApplicationFile) ([]byte, error) {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, file := range files {
+		header := &tar.Header{
+			Name:     file.FileName,
+			Mode:     0644,
+			Size:     int64(len(file.Content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error creating tgz file")
+		}
+		if _, err := tarWriter.Write(file.Content); err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error creating tgz file")
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating tgz file")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating tgz file")
+	}
+	return buf.Bytes(), nil
+}
+
+// convertToMap converts an entity into a map through its JSON representation
+func convertToMap(entry interface{}, converted *map[string]interface{}) error {
+	jsonStr, err := json.Marshal(entry)
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error converting to JSON")
+	}
+	if err = json.Unmarshal(jsonStr, converted); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error converting struct")
+	}
+	return nil
+}
+
+// joinYAMLFiles returns a multi resource YAML file with the received resources
+func joinYAMLFiles(resources [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, resource := range resources {
+		buf.WriteString("---\n")
+		buf.Write(resource)
+		if !bytes.HasSuffix(resource, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// encodeYAMLNode converts a YAML node (with its comments) into YAML with two spaces indentation
+func encodeYAMLNode(node *yamlv3.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yamlv3.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// getMappingValue returns the value of a key of a YAML mapping node (nil if the node does not have the key)
+func getMappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// withoutYAMLComments returns a YAML document without its comments
+func withoutYAMLComments(document []byte) ([]byte, error) {
+	var node yamlv3.Node
+	if err := yamlv3.Unmarshal(document, &node); err != nil {
+		return nil, err
+	}
+	removeYAMLComments(&node)
+	return encodeYAMLNode(&node)
+}
+
+// copyYAMLNode returns a deep copy of a YAML node. The alias nodes keep pointing to the original anchors.
+func copyYAMLNode(node *yamlv3.Node) *yamlv3.Node {
+	if node == nil {
+		return nil
+	}
+	result := *node
+	if node.Content != nil {
+		result.Content = make([]*yamlv3.Node, 0, len(node.Content))
+		for _, child := range node.Content {
+			result.Content = append(result.Content, copyYAMLNode(child))
+		}
+	}
+	return &result
+}
+
+// copyStringMap returns a copy of a map of strings
+func copyStringMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+// syncYAMLNode returns a YAML node with a value keeping the comments and the style of the original node for the
+// fields and list elements that are still present. The original node is not modified, but the returned node can
+// share the unchanged children with it.
+func syncYAMLNode(original *yamlv3.Node, value interface{}) (*yamlv3.Node, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if original != nil && original.Kind == yamlv3.MappingNode {
+			result := *original
+			result.Content = make([]*yamlv3.Node, 0, len(typed)*2)
+			synced := make(map[string]bool, len(typed))
+			for i := 0; i+1 < len(original.Content); i += 2 {
+				key := original.Content[i].Value
+				child, exists := typed[key]
+				if !exists || synced[key] {
+					continue
+				}
+				node, err := syncYAMLNode(original.Content[i+1], child)
+				if err != nil {
+					return nil, err
+				}
+				result.Content = append(result.Content, original.Content[i], node)
+				synced[key] = true
+			}
+			added := make([]string, 0)
+			for key := range typed {
+				if !synced[key] {
+					added = append(added, key)
+				}
+			}
+			sort.Strings(added)
+			for _, key := range added {
+				node, err := syncYAMLNode(nil, typed[key])
+				if err != nil {
+					return nil, err
+				}
+				result.Content = append(result.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}, node)
+			}
+			return &result, nil
+		}
+	case []interface{}:
+		if original != nil && original.Kind == yamlv3.SequenceNode {
+			result := *original
+			result.Content = make([]*yamlv3.Node, 0, len(typed))
+			for i, child := range typed {
+				var originalChild *yamlv3.Node
+				if i < len(original.Content) {
+					originalChild = original.Content[i]
+				}
+				node, err := syncYAMLNode(originalChild, child)
+				if err != nil {
+					return nil, err
+				}
+				result.Content = append(result.Content, node)
+			}
+			return &result, nil
+		}
+	default:
+		if original != nil && original.Kind == yamlv3.ScalarNode {
+			var decoded interface{}
+			if err := original.Decode(&decoded); err == nil && equalJSONValues(decoded, value) {
+				return original, nil
+			}
+		}
+	}
+	node := &yamlv3.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	if original != nil {
+		node.HeadComment, node.LineComment, node.FootComment = original.HeadComment, original.LineComment, original.FootComment
+	}
+	return node, nil
+}
+
+// equalJSONValues checks if two values have the same JSON representation (e.g. int and float64 numbers)
+func equalJSONValues(first interface{}, second interface{}) bool {
+	firstJSON, err := json.Marshal(first)
+	if err != nil {
+		return false
+	}
+	secondJSON, err := json.Marshal(second)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(firstJSON, secondJSON)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// Validate checks the structure of the OAM applications: every application and component must have a name,
+// component names must be unique inside an application, and components and traits must have a type.
+// The components whose definition is bundled in the application must be renderable.
+func (a *Application) Validate() error {
+	return a.ValidateContext(context.Background())
+}
+
+// ValidateContext is Validate with a context. The context is checked before validating each component, and the
+// Canceled or DeadlineExceeded error is returned when it is done.
+func (a *Application) ValidateContext(ctx context.Context) error {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	problems := make([]string, 0)
+	definitions, err := a.getDefinitions()
+	if err != nil {
+		return err
+	}
+
+	appNames := make([]string, 0, len(a.apps))
+	for appName := range a.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	for _, appName := range appNames {
+		app := a.apps[appName]
+		if app.Metadata.Name == "" {
+			problems = append(problems, "application without name")
+		}
+		components, err := app.getComponents()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid components", appName))
+			continue
+		}
+		if len(components) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: application without components", appName))
+		}
+		names := make(map[string]bool, 0)
+		for i, component := range components {
+			if err := checkContext(ctx); err != nil {
+				return err
+			}
+			if component.Name == "" {
+				problems = append(problems, fmt.Sprintf("%s: component %d without name", appName, i))
+			} else if names[component.Name] {
+				problems = append(problems, fmt.Sprintf("%s: duplicated component %s", appName, component.Name))
+			}
+			names[component.Name] = true
+			if component.Type == "" {
+				problems = append(problems, fmt.Sprintf("%s: component %s without type", appName, component.Name))
+			} else if _, bundled := definitions[componentDefinitionGVK[0].Kind][component.Type]; bundled {
+				if _, err := renderComponent(app.Metadata.Name, component, definitions); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %s", appName, err.Error()))
+				}
+			}
+			for j, trait := range component.Traits {
+				if trait.Type == "" {
+					problems = append(problems, fmt.Sprintf("%s: trait %d of component %s without type", appName, j, component.Name))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nerrors.NewInvalidArgumentError("invalid application: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const invalidApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: invalid
+spec:
+  components:
+    - name: component1
+      type: worker
+      properties:
+        image: busybox
+    - name: component1
+      properties:
+        image: busybox
+      traits:
+        - properties:
+            replicas: 1
+`
+
+var _ = ginkgo.Describe("Validation tests", func() {
+
+	ginkgo.It("Should be able to validate a correct application", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(completeApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.Validate()).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("Should report the problems of an invalid application", func() {
+		app, err := NewApplicationFromYAML([][]byte{[]byte(invalidApplication)})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		err = app.Validate()
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("duplicated component component1"))
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("without type"))
+	})
+
+	ginkgo.It("Should report the components that cannot be rendered with the bundled definitions", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(`
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: missing
+spec:
+  components:
+    - name: frontend
+      type: simple-service
+`)},
+			{FileName: "component.yaml", Content: []byte(componentDefinition)}}
+		app, err := NewApplication(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.Validate()).ShouldNot(gomega.Succeed())
+	})
+})
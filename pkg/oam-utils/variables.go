@@ -0,0 +1,209 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oam_utils
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	yamlV3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// variablePrefix with the characters that open a variable placeholder
+	variablePrefix = "${"
+	// variableSuffix with the character that closes a variable placeholder
+	variableSuffix = "}"
+	// variableDefaultSeparator with the separator between the variable name and its default value
+	variableDefaultSeparator = ":-"
+	// variableEscape with the characters used to write a literal placeholder ($${NAME} is written as ${NAME})
+	variableEscape = "$${"
+)
+
+// SubstituteVariables replaces the variable placeholders of a content with their values:
+//
+//	${NAME}             is replaced with the value of NAME. NAME is required.
+//	${NAME:-default}    is replaced with the value of NAME, or with default if NAME is not defined or empty.
+//	$${NAME}            is written as the literal ${NAME}.
+//
+// Names contain letters, digits, underscores and dots (e.g. ${params.replicas}). The values are inserted as they
+// are, so they must be valid in the place they are used (see WithVariables to substitute the variables of the
+// YAML and JSON files safely). All the required variables without value are reported in the same error.
+func SubstituteVariables(content []byte, variables map[string]string) ([]byte, error) {
+	missing := make(map[string]bool, 0)
+	result, err := substituteText(string(content), variables, missing)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMissingVariables(missing); err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
+
+// substituteDocumentVariables replaces the variable placeholders of the scalars (keys and values) of a YAML or
+// JSON document. The comments are not changed and the values are inserted as scalars, so they cannot change the
+// structure of the document. The plain scalars are resolved again, so `replicas: ${REPLICAS}` is a number if the
+// value is a number. The document is returned as it is if it does not contain placeholders.
+func substituteDocumentVariables(document []byte, variables map[string]string) ([]byte, error) {
+	if !bytes.Contains(document, []byte("$")) {
+		return document, nil
+	}
+	var node yamlV3.Node
+	if err := yamlV3.Unmarshal(document, &node); err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid document: %s", err.Error())
+	}
+	missing := make(map[string]bool, 0)
+	changed, err := substituteNodeVariables(&node, variables, missing)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMissingVariables(missing); err != nil {
+		return nil, err
+	}
+	if !changed {
+		return document, nil
+	}
+	substituted, err := encodeYAMLNode(&node)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error substituting variables")
+	}
+	return substituted, nil
+}
+
+// substituteNodeVariables replaces the variable placeholders of the scalars of a YAML node and its children. It
+// returns true if a scalar changed. The aliases are skipped as their anchors are already substituted.
+func substituteNodeVariables(node *yamlV3.Node, variables map[string]string, missing map[string]bool) (bool, error) {
+	if node.Kind == yamlV3.AliasNode {
+		return false, nil
+	}
+	if node.Kind == yamlV3.ScalarNode {
+		value, err := substituteText(node.Value, variables, missing)
+		if err != nil || value == node.Value {
+			return false, err
+		}
+		node.Value = value
+		if node.Style&(yamlV3.TaggedStyle|yamlV3.SingleQuotedStyle|yamlV3.DoubleQuotedStyle|yamlV3.LiteralStyle|yamlV3.FoldedStyle) == 0 {
+			// the tag of the plain scalars is resolved again from the new value
+			node.Tag = ""
+		}
+		return true, nil
+	}
+	changed := false
+	for _, child := range node.Content {
+		childChanged, err := substituteNodeVariables(child, variables, missing)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || childChanged
+	}
+	return changed, nil
+}
+
+// substituteText replaces the variable placeholders of a text (see SubstituteVariables) adding the required
+// variables without value to missing
+func substituteText(text string, variables map[string]string, missing map[string]bool) (string, error) {
+	var result strings.Builder
+	remaining := text
+	for {
+		start := strings.Index(remaining, "$")
+		if start == -1 {
+			result.WriteString(remaining)
+			break
+		}
+		result.WriteString(remaining[:start])
+		remaining = remaining[start:]
+
+		if strings.HasPrefix(remaining, variableEscape) {
+			result.WriteString(variablePrefix)
+			remaining = remaining[len(variableEscape):]
+			continue
+		}
+		if !strings.HasPrefix(remaining, variablePrefix) {
+			result.WriteString("$")
+			remaining = remaining[1:]
+			continue
+		}
+
+		end := strings.Index(remaining, variableSuffix)
+		if end == -1 {
+			return "", nerrors.NewInvalidArgumentError("unterminated variable %s", firstLine(remaining))
+		}
+		expression := remaining[len(variablePrefix):end]
+		remaining = remaining[end+len(variableSuffix):]
+
+		name, defaultValue, hasDefault := expression, "", false
+		if index := strings.Index(expression, variableDefaultSeparator); index != -1 {
+			name, defaultValue, hasDefault = expression[:index], expression[index+len(variableDefaultSeparator):], true
+		}
+		if !isValidVariableName(name) {
+			return "", nerrors.NewInvalidArgumentError("invalid variable name %q", name)
+		}
+
+		value, exists := variables[name]
+		switch {
+		case exists && value != "":
+			result.WriteString(value)
+		case hasDefault:
+			result.WriteString(defaultValue)
+		case exists:
+			// a required variable defined as empty
+		default:
+			missing[name] = true
+		}
+	}
+	return result.String(), nil
+}
+
+// checkMissingVariables returns an error with the names of the required variables without value
+func checkMissingVariables(missing map[string]bool) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nerrors.NewInvalidArgumentError("required variables without value: %s", strings.Join(names, ", "))
+}
+
+// isValidVariableName checks that a variable name contains only letters, digits, underscores and dots
+// and does not start with a digit
+func isValidVariableName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, char := range name {
+		isLetter := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+		isDigit := char >= '0' && char <= '9'
+		if !isLetter && !isDigit && char != '_' && char != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// firstLine returns the first line of a text
+func firstLine(text string) string {
+	if index := strings.Index(text, "\n"); index != -1 {
+		return text[:index]
+	}
+	return text
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2022 Napptive
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oam_utils
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const templatedApplication = `
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: ${APP_NAME}
+spec:
+  components:
+    - name: ${APP_NAME}-web
+      type: webservice
+      properties:
+        image: nginx:${VERSION:-1.21.0} # Image
+      traits:
+      - type: scaler
+        properties:
+          replicas: ${params.replicas}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  # the name uses ${APP_NAME}
+  name: ${APP_NAME}-config
+  namespace: ${NAMESPACE:-default}
+data:
+  script: echo $HOME $${NOT_A_VARIABLE}
+`
+
+var _ = ginkgo.Describe("Variables tests", func() {
+
+	ginkgo.It("Should be able to substitute the variables", func() {
+		result, err := SubstituteVariables([]byte("a: ${A}\nb: ${B:-two}\nc: ${C:-three}\nd: $${D}\ne: $E\n"),
+			map[string]string{"A": "one", "C": "3"})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(string(result)).Should(gomega.Equal("a: one\nb: two\nc: 3\nd: ${D}\ne: $E\n"))
+	})
+
+	ginkgo.It("Should fail with the required variables without value", func() {
+		_, err := SubstituteVariables([]byte("a: ${A}\nb: ${B}\nc: ${A}\n"), map[string]string{})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("required variables without value: A, B"))
+
+		_, err = SubstituteVariables([]byte("a: ${A\n"), map[string]string{"A": "one"})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		_, err = SubstituteVariables([]byte("a: ${1A}\n"), map[string]string{})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("Should be able to create an application with variables", func() {
+		files := []*ApplicationFile{
+			{FileName: "app.yaml", Content: []byte(templatedApplication)},
+			{FileName: "README.md", Content: []byte("Use ${APP_NAME}")},
+		}
+		app, err := NewApplication(files, WithVariables(map[string]string{"APP_NAME": "shop", "params.replicas": "3"}))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("shop"))
+
+		components, err := app.GetComponents("shop")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components[0].Name).Should(gomega.Equal("shop-web"))
+		gomega.Expect(components[0].Properties["image"]).Should(gomega.Equal("nginx:1.21.0"))
+		gomega.Expect(components[0].Traits[0].Properties["replicas"]).Should(gomega.Equal(3.0))
+
+		parameters, err := app.GetParameters()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(parameters["shop"]).Should(gomega.ContainSubstring("# Image"))
+
+		_, entities, err := app.ToYAML()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entities).Should(gomega.HaveLen(1))
+		gomega.Expect(string(entities[0])).Should(gomega.ContainSubstring("name: shop-config"))
+		gomega.Expect(string(entities[0])).Should(gomega.ContainSubstring("namespace: default"))
+		gomega.Expect(string(entities[0])).Should(gomega.ContainSubstring("echo $HOME ${NOT_A_VARIABLE}"))
+		gomega.Expect(string(entities[0])).Should(gomega.ContainSubstring("# the name uses ${APP_NAME}"))
+	})
+
+	ginkgo.It("Should insert the values as scalars", func() {
+		files := []*ApplicationFile{{FileName: "app.yaml", Content: []byte(templatedApplication)}}
+		app, err := NewApplication(files, WithVariables(map[string]string{
+			"APP_NAME":        "shop",
+			"VERSION":         "1.21.0\nkind: Secret",
+			"NAMESPACE":       "prod\nstringData:\n  password: injected",
+			"params.replicas": "3"}))
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		components, err := app.GetComponents("shop")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(components[0].Properties["image"]).Should(gomega.Equal("nginx:1.21.0\nkind: Secret"))
+
+		_, entities, err := app.ToYAML()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gvk, obj, err := getGVK(entities[0])
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(gvk.Kind).Should(gomega.Equal("ConfigMap"))
+		gomega.Expect(obj.GetNamespace()).Should(gomega.Equal("prod\nstringData:\n  password: injected"))
+		gomega.Expect(obj.Object).ShouldNot(gomega.HaveKey("stringData"))
+	})
+
+	ginkgo.It("Should be able to load a packaged application with variables", func() {
+		tgz, err := writeTGZ([]*ApplicationFile{{FileName: "app.yaml", Content: []byte(templatedApplication)}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		app, err := NewApplicationFromTGZ(tgz, WithVariables(map[string]string{"APP_NAME": "shop", "params.replicas": "3"}))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(app.GetNames()).Should(gomega.HaveKey("shop"))
+	})
+
+	ginkgo.It("Should fail to create an application without the required variables", func() {
+		files := []*ApplicationFile{{FileName: "app.yaml", Content: []byte(templatedApplication)}}
+		_, err := NewApplication(files, WithVariables(map[string]string{"APP_NAME": "shop"}))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("params.replicas"))
+	})
+})